@@ -25,8 +25,9 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
-	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -34,21 +35,34 @@ import (
 func noteAdd(cmd *cobra.Command, args []string) {
 	content := produceNote(args)
 
-	space := viper.GetString(ViperSpace)
-	if err := checkSpaceArgument(space); err != nil {
+	now := time.Now()
+	due, err := parseDateArg(dueArg, now)
+	if err != nil {
+		quitError("arg", err)
+	}
+	remind, err := parseDateArg(remindArg, now)
+	if err != nil {
 		quitError("arg", err)
 	}
 
-	add := db.Note{
-		Space:   viper.GetString(ViperSpace),
-		Content: content,
-		Pinned:  pinnedArg,
+	opts := note.AddOpts{
+		Space:    viper.GetString(ViperSpace),
+		Pinned:   pinnedArg,
+		Due:      due,
+		RemindAt: remind,
+	}
+	if len(tagsArg) > 0 {
+		tags, err := note.ParseTags(strings.Join(tagsArg, ","))
+		if err != nil {
+			quitError("arg", err)
+		}
+		opts.Tags = tags
 	}
 
 	d := dbOpen()
 	defer d.Close()
 
-	id, err := d.AddNote(add, false)
+	id, err := note.Add(cmd.Context(), d, content, opts)
 	if err != nil {
 		quitError("db add", err)
 	}
@@ -74,18 +88,11 @@ func produceNote(args []string) string {
 	}
 
 	// Special case, where no arguments means open an editor to create the note
-	note, err := openInEditor("")
+	content, err := openInEditor("")
 	if err != nil {
 		quitError("open editor", err)
 	}
-	return note
-}
-
-func checkSpaceArgument(space string) error {
-	if strings.Contains(space, ",") {
-		return fmt.Errorf("space cannot contain the following character ','")
-	}
-	return nil
+	return content
 }
 
 func checkAddArguments(args []string) (io.ReadCloser, error) {
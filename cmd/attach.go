@@ -0,0 +1,177 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+)
+
+func noteAttach(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		quitError("parse id", err)
+	}
+
+	// Every file is read before anything is attached
+	attachments := make([]note.Attachment, len(args)-1)
+	for i, path := range args[1:] {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			quitError("read", err)
+		}
+		attachments[i] = note.NewAttachment(path, data)
+		attachments[i].NoteID = id
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	err = d.WithTx(cmd.Context(), func(tx *note.Tx) error {
+		for _, a := range attachments {
+			if _, err := tx.AddAttachment(cmd.Context(), a, forceArg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		quitError("db attach", err)
+	}
+}
+
+func noteAttachments(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		quitError("parse id", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	if _, err := d.GetNote(cmd.Context(), id); err != nil {
+		quitError("db get", err)
+	}
+
+	attachments, err := d.Attachments(cmd.Context(), id, false)
+	if err != nil {
+		quitError("db attachments", err)
+	}
+
+	if listArg {
+		for _, a := range attachments {
+			fmt.Println(a.Filename)
+		}
+		return
+	}
+
+	var (
+		tw      = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		dateFmt = "2006-01-02 15:04:05"
+	)
+
+	fmt.Fprintln(tw, "Filename\tSize\tType\tSHA256\tAttached\t")
+	for _, a := range attachments {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", a.Filename, a.Size, a.MimeType, a.SHA256[:12], a.Created.Format(dateFmt))
+	}
+	tw.Flush()
+}
+
+func noteDetach(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		quitError("parse id", err)
+	}
+
+	filenames := args[1:]
+	if allArg == (len(filenames) > 0) {
+		quit("requires either filenames or --all")
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	if _, err := d.GetNote(cmd.Context(), id); err != nil {
+		quitError("db get", err)
+	}
+	if err := d.RemoveAttachments(cmd.Context(), id, filenames); err != nil {
+		quitError("db detach", err)
+	}
+}
+
+func noteExtract(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		quitError("parse id", err)
+	}
+	dir := args[1]
+
+	d := dbOpen()
+	defer d.Close()
+
+	if _, err := d.GetNote(cmd.Context(), id); err != nil {
+		quitError("db get", err)
+	}
+
+	attachments, err := d.Attachments(cmd.Context(), id, true)
+	if err != nil {
+		quitError("db attachments", err)
+	}
+
+	// Only the named attachments are extracted, if any are given.
+	// The attachments of an encrypted note are only readable by the user.
+	files := make([]note.FileAttachment, 0, len(attachments))
+	private := false
+	for _, name := range args[2:] {
+		found := false
+		for _, a := range attachments {
+			if a.Filename == filepath.Base(name) {
+				files = append(files, note.FromAttachment(a))
+				private = private || a.Encrypted
+				found = true
+			}
+		}
+		if !found {
+			quit(fmt.Sprintf("note %v has no attachment %q", id, name))
+		}
+	}
+	if len(args) == 2 {
+		for _, a := range attachments {
+			files = append(files, note.FromAttachment(a))
+			private = private || a.Encrypted
+		}
+	}
+
+	paths, err := note.WriteAttachments(dir, files, forceArg, private)
+	if err != nil {
+		quitError("extract", err)
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+}
@@ -24,27 +24,46 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func noteClean(cmd *cobra.Command, args []string) {
-	db := dbOpen()
-	defer db.Close()
+	before, err := cleanBefore()
+	if err != nil {
+		quitError("arg", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
 
-	// allInSpaceArg is set and no args provided means find all notes in specific space
-	allNotesInSpace, err := db.SelectNotes([]string{TrashSpace}, true, nil, nil)
+	ids, err := note.TrashedIDs(cmd.Context(), d, before)
+	if err != nil {
+		quitError("db trash", err)
+	}
+	locked, err := d.LockedTrash(cmd.Context(), before)
 	if err != nil {
-		quitError("db list", err)
+		quitError("db trash", err)
 	}
 
-	ids := allNotesInSpace.GetIDs()
 	uniqueIds := removeDuplicates(ids)
 	if len(uniqueIds) == 0 {
-		fmt.Println("Trash is empty")
+		if locked > 0 {
+			printLockedTrash(locked, "removed")
+		} else if before.IsZero() {
+			fmt.Println("Trash is empty")
+		} else {
+			fmt.Println("No notes in trash old enough to remove")
+		}
 		os.Exit(0)
 	}
 
+	warnDanglingLinks(cmd.Context(), d, uniqueIds)
+
 	if !noConfirmArg {
 		fmt.Printf("WARNING: You are about to permanently remove %v note(s).\n", len(uniqueIds))
 		fmt.Printf("Write 'yes' to confirm permanent delete: ")
@@ -54,7 +73,7 @@ func noteClean(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if err := db.PermanentRemoveNotes(uniqueIds); err != nil {
+	if err := note.Remove(cmd.Context(), d, uniqueIds, note.RemoveOpts{Permanent: true}); err != nil {
 		quitError("db remove", err)
 	}
 
@@ -64,4 +83,32 @@ func noteClean(cmd *cobra.Command, args []string) {
 	} else {
 		fmt.Printf("%v notes removed from %v\n", count, TrashSpace)
 	}
+	printLockedTrash(locked, "removed")
+}
+
+// printLockedTrash tells of notes in the trash that were left, as they are locked
+func printLockedTrash(locked int, verb string) {
+	switch {
+	case locked == 1:
+		fmt.Printf("1 locked note was not %v, unlock its space first\n", verb)
+	case locked > 1:
+		fmt.Printf("%v locked notes were not %v, unlock their spaces first\n", locked, verb)
+	}
+}
+
+// cleanBefore is the time before which trashed notes are removed, zero means all notes
+func cleanBefore() (time.Time, error) {
+	olderThan := viper.GetString(ViperTrashRetention)
+	if olderThan == "" {
+		return time.Time{}, nil
+	}
+
+	age, err := db.ParseDuration(olderThan)
+	if err != nil {
+		return time.Time{}, err
+	} else if age == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Now().Add(-age), nil
 }
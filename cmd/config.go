@@ -22,11 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
 
 	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/fatih/color"
 	"github.com/spf13/viper"
 )
@@ -42,7 +44,13 @@ const (
 	ViperStyle  = "style"
 	ViperColor  = "color"
 
+	ViperRevisions      = "revisions"
+	ViperTrashRetention = "trash_retention"
+	ViperServeToken     = "serve_token"
+
 	DefaultSpace = "main"
+
+	DefaultRevisions = 100
 )
 
 func initConfig() {
@@ -55,7 +63,7 @@ func initConfig() {
 		}
 
 		viper.AddConfigPath(cfgDir)
-		viper.SetConfigName(note)
+		viper.SetConfigName(appName)
 		viper.SetConfigType("yaml")
 	}
 
@@ -67,6 +75,7 @@ func initConfig() {
 	viper.SetDefault(ViperDb, dfltStore)
 	viper.SetDefault(ViperEditor, defaultEditor())
 	viper.SetDefault(ViperSpace, DefaultSpace)
+	viper.SetDefault(ViperRevisions, DefaultRevisions)
 
 	viper.AutomaticEnv()
 
@@ -106,27 +115,40 @@ func dbFilename() string {
 	return viper.GetString(ViperDb)
 }
 
-func dbOpen() *db.DB {
-	d, err := db.Open(dbFilename())
+func dbOpen() *note.DB {
+	d, err := note.Open(dbFilename())
+	if err != nil {
+		quitError("db open", err)
+	}
+	unlockCachedKeys(context.Background(), d)
+	return d
+}
+
+func dbOpenUnmigrated() *db.DB {
+	d, err := db.OpenUnmigrated(dbFilename())
 	if err != nil {
 		quitError("db open", err)
 	}
 	return d
 }
 
+func parseStyle(s string) (Style, error) {
+	switch style := Style(s); style {
+	case MinimalStyle, LightStyle, FullStyle:
+		return style, nil
+	}
+	return "", fmt.Errorf("unrecognized style")
+}
+
 func styleColorOpts() (Style, bool, error) {
 	var (
 		style   Style
 		doColor bool
 	)
 
-	styleStr := viper.GetString(ViperStyle)
-	stylized := Style(styleStr)
-	switch stylized {
-	case MinimalStyle, LightStyle, FullStyle:
-		style = stylized
-	default:
-		return "", false, fmt.Errorf("unrecognized style")
+	style, err := parseStyle(viper.GetString(ViperStyle))
+	if err != nil {
+		return "", false, err
 	}
 
 	colorStr := viper.GetString(ViperColor)
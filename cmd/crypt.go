@@ -0,0 +1,252 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// stdinReader reads passphrases when stdin is not a terminal, it is shared
+// so that consecutive prompts do not lose buffered input
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// A derived key, cached so that a space stays unlocked between commands
+type cachedKey struct {
+	Space   string    `json:"space"`
+	ID      int64     `json:"id"`
+	Key     []byte    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+func noteSpaceEncrypt(cmd *cobra.Command, args []string) {
+	space := args[0]
+
+	passphrase := readPassphrase(fmt.Sprintf("New passphrase for %v: ", space))
+	if passphrase != readPassphrase("Repeat passphrase: ") {
+		quit("the passphrases do not match")
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	// The plaintext is also removed from free pages and the search index
+	if err := note.EncryptSpace(cmd.Context(), d, space, passphrase); err != nil {
+		quitError("db encrypt", err)
+	}
+
+	fmt.Printf("Space %v encrypted, use 'note unlock %v' to read its notes\n", space, space)
+}
+
+func noteUnlock(cmd *cobra.Command, args []string) {
+	timeout, err := db.ParseDuration(timeoutArg)
+	if err != nil {
+		quitError("timeout", err)
+	} else if timeout <= 0 {
+		quit("timeout must be positive")
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	var (
+		keys    = loadKeyCache()
+		expires = time.Now().Add(timeout)
+	)
+	for _, space := range removeDuplicates(args) {
+		passphrase := readPassphrase(fmt.Sprintf("Passphrase for %v: ", space))
+		key, err := d.DeriveSpaceKey(cmd.Context(), space, passphrase)
+		if err != nil {
+			quitError("unlock", err)
+		}
+
+		keys = removeCachedKeys(keys, space)
+		keys = append(keys, cachedKey{Space: space, ID: key.ID, Key: key.Key, Expires: expires})
+	}
+
+	if err := saveKeyCache(keys); err != nil {
+		quitError("key cache", err)
+	}
+	fmt.Printf("Unlocked %v for %v\n", strings.Join(args, ", "), timeout)
+}
+
+func noteLock(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		if err := os.Remove(keyCachePath()); err != nil && !os.IsNotExist(err) {
+			quitError("key cache", err)
+		}
+		fmt.Println("All spaces locked")
+		return
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	keys := loadKeyCache()
+	for _, space := range args {
+		if err := d.Lock(cmd.Context(), space); err != nil {
+			quitError("lock", err)
+		}
+		keys = removeCachedKeys(keys, space)
+	}
+
+	if err := saveKeyCache(keys); err != nil {
+		quitError("key cache", err)
+	}
+	fmt.Printf("Locked %v\n", strings.Join(args, ", "))
+}
+
+// unlockCachedKeys unlocks the spaces that were unlocked by 'note unlock'.
+// Keys that have expired, or no longer match the database, are ignored.
+func unlockCachedKeys(ctx context.Context, d *note.DB) {
+	for _, key := range loadKeyCache() {
+		_ = d.Unlock(ctx, note.SpaceKey{ID: key.ID, Key: key.Key})
+	}
+}
+
+// readPassphrase prompts for a passphrase without echoing it, when stdin is a terminal.
+// Otherwise a line is read from stdin, so that the passphrase can be piped.
+func readPassphrase(prompt string) string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		// The last line may lack a newline
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			quitError("read passphrase", err)
+		}
+		return strings.TrimRight(line, "\r\n")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		quitError("read passphrase", err)
+	}
+	return string(passphrase)
+}
+
+// keyCachePath is a file per database, in the runtime directory of the user,
+// which is usually not persisted across reboots.
+func keyCachePath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("note-%d", os.Getuid()))
+	} else {
+		dir = filepath.Join(dir, "note")
+	}
+
+	path, err := filepath.Abs(dbFilename())
+	if err != nil {
+		path = dbFilename()
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadKeyCache returns the keys that have not expired, a missing or unreadable cache is empty,
+// as is a cache in a directory that others have access to
+func loadKeyCache() []cachedKey {
+	path := keyCachePath()
+	if err := checkPrivateDir(filepath.Dir(path)); err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var keys []cachedKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	valid := make([]cachedKey, 0, len(keys))
+	for _, key := range keys {
+		if key.Expires.After(now) {
+			valid = append(valid, key)
+		}
+	}
+	return valid
+}
+
+func saveKeyCache(keys []cachedKey) error {
+	path := keyCachePath()
+	if len(keys) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	// The keys are only written to a directory that no one else has access to
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return err
+	}
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	// The file is replaced, so that it is never readable by others
+	tmp, err := os.CreateTemp(dir, ".keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func removeCachedKeys(keys []cachedKey, space string) []cachedKey {
+	out := make([]cachedKey, 0, len(keys))
+	for _, key := range keys {
+		if key.Space != space {
+			out = append(out, key)
+		}
+	}
+	return out
+}
@@ -0,0 +1,289 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+const (
+	diffEqual diffOp = iota
+	diffInsert
+	diffDelete
+
+	diffContext = 3
+)
+
+type diffOp int
+
+type diffLine struct {
+	Op   diffOp
+	Text string
+
+	// Number of lines, in respective input, before this line
+	A, B int
+}
+
+var (
+	Red = color.New(color.FgRed)
+)
+
+// writeUnifiedDiff writes the difference between the lines of a and b in the unified format
+func writeUnifiedDiff(w io.Writer, fromName, toName string, a, b []string, doColor bool) {
+	lines := diffLines(a, b)
+	hunks := diffHunks(lines, diffContext)
+	if len(hunks) == 0 {
+		return
+	}
+
+	preColor(doColor)
+	defer postColor(doColor)
+
+	fmt.Fprintf(w, "--- %v\n+++ %v\n", fromName, toName)
+	for _, hunk := range hunks {
+		aStart, aLen, bStart, bLen := hunkRange(hunk)
+		if doColor {
+			color.New(color.FgCyan).Fprintf(w, "@@ -%v,%v +%v,%v @@\n", aStart, aLen, bStart, bLen)
+		} else {
+			fmt.Fprintf(w, "@@ -%v,%v +%v,%v @@\n", aStart, aLen, bStart, bLen)
+		}
+
+		for _, line := range hunk {
+			switch {
+			case line.Op == diffInsert && doColor:
+				Green.Fprintf(w, "+%v\n", line.Text)
+			case line.Op == diffDelete && doColor:
+				Red.Fprintf(w, "-%v\n", line.Text)
+			case line.Op == diffInsert:
+				fmt.Fprintf(w, "+%v\n", line.Text)
+			case line.Op == diffDelete:
+				fmt.Fprintf(w, "-%v\n", line.Text)
+			default:
+				fmt.Fprintf(w, " %v\n", line.Text)
+			}
+		}
+	}
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimRight(content, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script, with the linear space variant of the Myers
+// algorithm: the middle of the edit path is found by searching from both ends at once,
+// and the lines before and after it are compared in turn.
+func diffLines(a, b []string) []diffLine {
+	d := &differ{
+		a:   a,
+		b:   b,
+		v1:  make([]int, len(a)+len(b)+3),
+		v2:  make([]int, len(a)+len(b)+3),
+		out: make([]diffLine, 0, max(len(a), len(b))),
+	}
+	d.compare(0, len(a), 0, len(b))
+	return d.out
+}
+
+type differ struct {
+	a, b []string
+
+	// The furthest reaching paths, forwards and backwards, reused by every bisect
+	v1, v2 []int
+
+	out []diffLine
+}
+
+// compare appends the edit script of a[aLo:aHi] and b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.out = append(d.out, diffLine{Op: diffEqual, Text: d.a[aLo], A: aLo, B: bLo})
+		aLo++
+		bLo++
+	}
+
+	// The common suffix is appended last
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	if x, y, ok := d.bisect(aLo, aHi, bLo, bHi); ok {
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	} else {
+		for i := aLo; i < aHi; i++ {
+			d.out = append(d.out, diffLine{Op: diffDelete, Text: d.a[i], A: i, B: bLo})
+		}
+		for j := bLo; j < bHi; j++ {
+			d.out = append(d.out, diffLine{Op: diffInsert, Text: d.b[j], A: aHi, B: j})
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.out = append(d.out, diffLine{Op: diffEqual, Text: d.a[aHi+i], A: aHi + i, B: bHi + i})
+	}
+}
+
+// bisect finds where the forward and backward searches of a shortest edit path meet, and
+// returns the point that splits the path in two. It is not ok if either input is empty,
+// or if the inputs have no lines in common, since then there is nothing to split.
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	var (
+		maxD   = (n + m + 1) / 2
+		offset = maxD
+		v1     = d.v1[:2*maxD+2]
+		v2     = d.v2[:2*maxD+2]
+		delta  = n - m
+		front  = delta%2 != 0 // the forward search finds the overlap, when delta is odd
+
+		// Diagonals that left the edit graph are no longer searched
+		k1start, k1end, k2start, k2end = 0, 0, 0, 0
+	)
+	for i := range v1 {
+		v1[i], v2[i] = -1, -1
+	}
+	v1[offset+1], v2[offset+1] = 0, 0
+
+	for e := 0; e < maxD; e++ {
+		for k1 := -e + k1start; k1 <= e-k1end; k1 += 2 {
+			var x1 int
+			if k1 == -e || (k1 != e && v1[offset+k1-1] < v1[offset+k1+1]) {
+				x1 = v1[offset+k1+1]
+			} else {
+				x1 = v1[offset+k1-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && d.a[aLo+x1] == d.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			v1[offset+k1] = x1
+
+			if x1 > n {
+				k1end += 2
+			} else if y1 > m {
+				k1start += 2
+			} else if front {
+				k2 := offset + delta - k1
+				if k2 >= 0 && k2 < len(v2) && v2[k2] != -1 && x1 >= n-v2[k2] {
+					return aLo + x1, bLo + y1, true
+				}
+			}
+		}
+
+		for k2 := -e + k2start; k2 <= e-k2end; k2 += 2 {
+			var x2 int
+			if k2 == -e || (k2 != e && v2[offset+k2-1] < v2[offset+k2+1]) {
+				x2 = v2[offset+k2+1]
+			} else {
+				x2 = v2[offset+k2-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && d.a[aHi-x2-1] == d.b[bHi-y2-1] {
+				x2++
+				y2++
+			}
+			v2[offset+k2] = x2
+
+			if x2 > n {
+				k2end += 2
+			} else if y2 > m {
+				k2start += 2
+			} else if !front {
+				k1 := offset + delta - k2
+				if k1 >= 0 && k1 < len(v1) && v1[k1] != -1 {
+					x1 := v1[k1]
+					y1 := offset + x1 - k1
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// diffHunks groups changes, with surrounding lines of context
+func diffHunks(lines []diffLine, context int) [][]diffLine {
+	hunks := make([][]diffLine, 0)
+
+	start, end := -1, -1
+	for i, line := range lines {
+		if line.Op == diffEqual {
+			continue
+		}
+
+		lo := max(0, i-context)
+		hi := min(len(lines), i+context+1)
+		if start >= 0 && lo <= end {
+			end = hi // Overlapping context, extend the current hunk
+			continue
+		}
+
+		if start >= 0 {
+			hunks = append(hunks, lines[start:end])
+		}
+		start, end = lo, hi
+	}
+
+	if start >= 0 {
+		hunks = append(hunks, lines[start:end])
+	}
+	return hunks
+}
+
+// hunkRange is the 1-indexed start line and length of the hunk, in both inputs
+func hunkRange(hunk []diffLine) (int, int, int, int) {
+	var aLen, bLen int
+	for _, line := range hunk {
+		if line.Op != diffInsert {
+			aLen++
+		}
+		if line.Op != diffDelete {
+			bLen++
+		}
+	}
+
+	// An empty range starts at the line before it
+	aStart, bStart := hunk[0].A, hunk[0].B
+	if aLen > 0 {
+		aStart++
+	}
+	if bLen > 0 {
+		bStart++
+	}
+	return aStart, aLen, bStart, bLen
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []diffLine
+	}{
+		{"empty", nil, nil, []diffLine{}},
+		{"identical", []string{"a", "b"}, []string{"a", "b"}, []diffLine{
+			{diffEqual, "a", 0, 0},
+			{diffEqual, "b", 1, 1},
+		}},
+		{"insert into empty", nil, []string{"a", "b"}, []diffLine{
+			{diffInsert, "a", 0, 0},
+			{diffInsert, "b", 0, 1},
+		}},
+		{"delete everything", []string{"a", "b"}, nil, []diffLine{
+			{diffDelete, "a", 0, 0},
+			{diffDelete, "b", 1, 0},
+		}},
+		{"insert only", []string{"a", "c"}, []string{"a", "b", "c", "d"}, []diffLine{
+			{diffEqual, "a", 0, 0},
+			{diffInsert, "b", 1, 1},
+			{diffEqual, "c", 1, 2},
+			{diffInsert, "d", 2, 3},
+		}},
+		{"delete only", []string{"a", "b", "c", "d"}, []string{"b", "d"}, []diffLine{
+			{diffDelete, "a", 0, 0},
+			{diffEqual, "b", 1, 0},
+			{diffDelete, "c", 2, 1},
+			{diffEqual, "d", 3, 1},
+		}},
+		{"replace", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []diffLine{
+			{diffEqual, "a", 0, 0},
+			{diffDelete, "b", 1, 1},
+			{diffInsert, "x", 2, 1},
+			{diffEqual, "c", 2, 2},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffLines(test.a, test.b)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("diffLines(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	// The lines in common are interleaved with changes, which a greedy diff would miss
+	a := []string{"a", "b", "c", "a", "b", "b", "a"}
+	b := []string{"c", "b", "a", "b", "a", "c"}
+
+	var edits int
+	var gotA, gotB []string
+	for _, line := range diffLines(a, b) {
+		if line.Op != diffEqual {
+			edits++
+		}
+		if line.Op != diffInsert {
+			gotA = append(gotA, line.Text)
+		}
+		if line.Op != diffDelete {
+			gotB = append(gotB, line.Text)
+		}
+	}
+
+	if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+		t.Errorf("diff does not reproduce inputs: %q, %q", gotA, gotB)
+	}
+	if edits != 5 {
+		t.Errorf("got %v edits, want 5", edits)
+	}
+}
+
+func TestDiffHunks(t *testing.T) {
+	lines := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = fmt.Sprintf("l%v", i+1)
+		}
+		return out
+	}
+	replace := func(s []string, i int, text string) []string {
+		out := slices.Clone(s)
+		out[i] = text
+		return out
+	}
+
+	tests := []struct {
+		name string
+		a, b []string
+		want [][4]int
+	}{
+		{"identical", lines(5), lines(5), [][4]int{}},
+		{"insert into empty", nil, []string{"x"}, [][4]int{{0, 0, 1, 1}}},
+		{"delete everything", []string{"x", "y"}, nil, [][4]int{{1, 2, 0, 0}}},
+		{"insert at start", lines(2), append([]string{"x"}, lines(2)...), [][4]int{{1, 2, 1, 3}}},
+		{"delete at end", lines(6), lines(5), [][4]int{{3, 4, 3, 3}}},
+		{"close changes", lines(10), replace(replace(lines(10), 1, "x"), 8, "y"), [][4]int{{1, 10, 1, 10}}},
+		{"distant changes", lines(12), replace(replace(lines(12), 1, "x"), 10, "y"), [][4]int{
+			{1, 5, 1, 5},
+			{8, 5, 8, 5},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := [][4]int{}
+			for _, hunk := range diffHunks(diffLines(test.a, test.b), diffContext) {
+				aStart, aLen, bStart, bLen := hunkRange(hunk)
+				got = append(got, [4]int{aStart, aLen, bStart, bLen})
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("hunk ranges = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	var buf bytes.Buffer
+	writeUnifiedDiff(&buf, "a", "b", []string{"one", "two"}, []string{"one", "three"}, false)
+
+	want := "--- a\n+++ b\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got diff:\n%v\nwant:\n%v", got, want)
+	}
+
+	buf.Reset()
+	writeUnifiedDiff(&buf, "a", "b", []string{"one"}, []string{"one"}, false)
+	if buf.Len() != 0 {
+		t.Errorf("got diff of identical input: %q", buf.String())
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// Entirely different inputs are the worst case for both time and space
+	a := make([]string, 5000)
+	b := make([]string, 5000)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%v", i)
+		b[i] = fmt.Sprintf("b%v", i)
+	}
+
+	got := diffLines(a, b)
+	if len(got) != len(a)+len(b) {
+		t.Errorf("got %v lines, want %v", len(got), len(a)+len(b))
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Due dates and reminders are entered and shown in local time
+	dateFormat = "Mon 2006-01-02 15:04"
+)
+
+func noteDue(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		quitError("parse id", err)
+	}
+
+	// The date may be given as several arguments, as in: note due 12 next friday 10:00
+	now := time.Now()
+	due, err := parseDateArg(strings.Join(args[1:], " "), now)
+	if err != nil {
+		quitError("args", err)
+	}
+	remind, err := parseDateArg(remindArg, now)
+	if err != nil {
+		quitError("args", err)
+	}
+	if clearArg && (due != nil || remind != nil) {
+		quit("--clear cannot be combined with a date")
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	n, err := d.GetNote(cmd.Context(), id)
+	if err != nil {
+		quitError("db get", err)
+	}
+
+	if due == nil && remind == nil && !clearArg {
+		if n.Due != nil {
+			fmt.Printf("Due: %v\n", formatDate(*n.Due))
+		}
+		if n.RemindAt != nil {
+			fmt.Printf("Remind: %v\n", formatDate(*n.RemindAt))
+		}
+		return
+	}
+
+	err = d.WithTx(cmd.Context(), func(tx *note.Tx) error {
+		if due != nil || clearArg {
+			if err := tx.SetDue(cmd.Context(), []int{id}, due); err != nil {
+				return err
+			}
+		}
+		if remind != nil || clearArg {
+			return tx.SetReminder(cmd.Context(), []int{id}, remind)
+		}
+		return nil
+	})
+	if err != nil {
+		quitError("db due", err)
+	}
+
+	if due != nil {
+		fmt.Printf("Due: %v\n", formatDate(*due))
+	}
+	if remind != nil {
+		fmt.Printf("Remind: %v\n", formatDate(*remind))
+	}
+}
+
+func noteAgenda(cmd *cobra.Command, args []string) {
+	d := dbOpen()
+	defer d.Close()
+
+	filterOpts := &note.FilterOpts{Due: true, Recursive: recursiveArg}
+	notes, err := d.SelectNotes(cmd.Context(), args, allArg, nil, nil, filterOpts)
+	if err != nil {
+		quitError("db select", err)
+	}
+
+	if len(notes) == 0 {
+		fmt.Println("Nothing is due")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	first := true
+	for _, group := range note.Agenda(notes, time.Now()) {
+		if len(group.Notes) == 0 {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(tw)
+		}
+		first = false
+
+		fmt.Fprintf(tw, "%v:\n", group.Name)
+		for _, n := range group.Notes {
+			preview := getPreview(n.Content, int(previewArg))
+			fmt.Fprintf(tw, "  %v\t%v\t%v\t%v\n", n.ID, formatDate(*n.Due), n.Space, preview)
+		}
+	}
+	tw.Flush()
+}
+
+func noteRemind(cmd *cobra.Command, args []string) {
+	d := dbOpen()
+	defer d.Close()
+
+	// Without --check, reminders that are not yet due are listed as well
+	filterOpts := &note.FilterOpts{Reminder: true, Recursive: recursiveArg}
+	if checkArg || dismissArg {
+		filterOpts.RemindUntil = time.Now()
+	}
+	notes, err := d.SelectNotes(cmd.Context(), args, allArg, nil, nil, filterOpts)
+	if err != nil {
+		quitError("db select", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	for _, n := range sortByReminder(notes) {
+		preview := getPreview(n.Content, int(previewArg))
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", n.ID, formatDate(*n.RemindAt), n.Space, preview)
+	}
+	tw.Flush()
+
+	if dismissArg && len(notes) > 0 {
+		if err := d.SetReminder(cmd.Context(), notes.GetIDs(), nil); err != nil {
+			quitError("db dismiss", err)
+		}
+	}
+
+	// Lets scripts and shell prompts test for due reminders
+	if checkArg && len(notes) > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseDateArg parses a due date or reminder, an empty argument is nil
+func parseDateArg(arg string, now time.Time) (*time.Time, error) {
+	if strings.TrimSpace(arg) == "" {
+		return nil, nil
+	}
+	t, err := note.ParseDate(arg, now)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func sortByReminder(notes note.Notes) note.Notes {
+	sorted := append(note.Notes{}, notes...)
+	slices.SortStableFunc(sorted, func(a, b note.Note) int {
+		return a.RemindAt.Compare(*b.RemindAt)
+	})
+	return sorted
+}
+
+func formatDate(t time.Time) string {
+	return t.Local().Format(dateFormat)
+}
@@ -26,6 +26,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
 )
 
@@ -35,30 +36,26 @@ func noteEdit(cmd *cobra.Command, args []string) {
 		quitError("args", err)
 	}
 
-	db := dbOpen()
-	defer db.Close()
+	d := dbOpen()
+	defer d.Close()
 
-	note, err := db.GetNote(id)
+	current, err := d.GetNote(cmd.Context(), id)
 	if err != nil {
-		quitError("db move", err)
+		quitError("db get", err)
 	}
 
-	if note == nil {
-		quit("db returned nil ptr :(")
-	}
-
-	edited, err := openInEditor(note.Content)
+	edited, err := openInEditor(current.Content)
 	if err != nil {
 		quitError("open in editor", err)
 	}
 
-	if edited == note.Content {
+	if edited == current.Content {
 		fmt.Fprintln(os.Stderr, "No changes")
 		os.Exit(2)
 	}
 
-	if err = db.ReplaceContent(note.ID, edited); err != err {
-		quitError("db replace", err)
+	if err = note.Edit(cmd.Context(), d, current.ID, edited, editOpts()); err != nil {
+		quitError("db edit", err)
 	}
 
 	fmt.Println("Note modified")
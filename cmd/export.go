@@ -22,35 +22,35 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"strings"
-	"time"
+	"unicode/utf8"
 
-	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 )
 
 const (
 	UnknownFormat FileFormat = iota
 	JSONFormat
+	JSONLinesFormat
 	YAMLFormat
+	CSVFormat
+	TSVFormat
 )
 
 type FileFormat int
 
-type FileNote struct {
-	ID          int       `json:"id" yaml:"id"`
-	Pinned      bool      `json:"pinned" yaml:"pinned"`
-	Space       string    `json:"space" yaml:"space"`
-	Content     string    `json:"content" yaml:"content"`
-	Created     time.Time `json:"created" yaml:"created"`
-	LastUpdated time.Time `json:"last_updated" yaml:"last_updated"`
-}
-
 func noteExport(cmd *cobra.Command, args []string) {
+	if markdownArg != "" {
+		exportMarkdown(cmd, args)
+		return
+	} else if htmlArg != "" {
+		exportHTML(cmd, args)
+		return
+	}
+
 	argFmt, err := cmdArgFormat()
 	if err != nil {
 		quitError("cmd arg fmt", err)
@@ -66,47 +66,108 @@ func noteExport(cmd *cobra.Command, args []string) {
 		quitError("file format", err)
 	}
 
-	notes, err := selectNotes(spacesArg)
+	d := dbOpen()
+	defer d.Close()
+
+	notes, err := iterateNotes(cmd, d, spacesArg)
 	if err != nil {
 		quitError("collect notes", err)
 	}
 
-	fileNotes := convFileNotes(notes)
-
 	writer, err := createFileOrStdout(path)
 	if err != nil {
 		quitError("open writer", err)
 	}
 	defer writer.Close()
 
-	if format == JSONFormat {
-		encoder := json.NewEncoder(writer)
-		encoder.SetIndent(jsonPrefixArg, jsonIndentArg)
-		if err = encoder.Encode(fileNotes); err != nil {
-			quitError("encode", err)
+	// Notes are written as they are read from the database
+	var encoder note.Encoder
+	switch format {
+	case JSONFormat:
+		encoder = note.NewJSONEncoder(writer, jsonPrefixArg, jsonIndentArg)
+	case JSONLinesFormat:
+		encoder = note.NewJSONLinesEncoder(writer)
+	case YAMLFormat:
+		encoder = note.NewYAMLEncoder(writer, yamlSpacesArg)
+	case CSVFormat, TSVFormat:
+		opts, err := csvOpts(format)
+		if err != nil {
+			quitError("args", err)
+		}
+		opts.QuoteAll = quoteAllArg
+		opts.EscapeFormulas = escapeArg
+		if encoder, err = note.NewCSVEncoder(writer, opts); err != nil {
+			quitError("args", err)
+		}
+	}
+
+	for n, err := range notes {
+		if err != nil {
+			quitError("db iterate", err)
 		}
-	} else if format == YAMLFormat {
-		encoder := yaml.NewEncoder(writer)
-		encoder.SetIndent(yamlSpacesArg)
-		if err = encoder.Encode(fileNotes); err != nil {
+
+		// Attachments have no columns in CSV
+		fileNote := note.FromNote(n)
+		if format != CSVFormat && format != TSVFormat {
+			if fileNote, err = note.WithAttachments(cmd.Context(), d, fileNote); err != nil {
+				quitError("db attachments", err)
+			}
+		}
+		if err = encoder.Encode(fileNote); err != nil {
 			quitError("encode", err)
 		}
 	}
+	if err = encoder.Close(); err != nil {
+		quitError("encode", err)
+	}
+}
+
+// exportMarkdown writes one file per note, in a directory per space
+func exportMarkdown(cmd *cobra.Command, args []string) {
+	if format, _ := cmdArgFormat(); len(args) > 0 || format != UnknownFormat {
+		quit("--markdown cannot be combined with a file or another format")
+	}
+
+	notes, err := selectNotes(cmd, spacesArg)
+	if err != nil {
+		quitError("collect notes", err)
+	}
+
+	if _, err = note.ExportMarkdown(markdownArg, withAttachments(cmd, notes), forceArg); err != nil {
+		quitError("export markdown", err)
+	}
+}
+
+// exportHTML writes a static site, with an index page per space and a page per note
+func exportHTML(cmd *cobra.Command, args []string) {
+	if format, _ := cmdArgFormat(); len(args) > 0 || format != UnknownFormat {
+		quit("--html cannot be combined with a file or another format")
+	}
+
+	notes, err := selectNotes(cmd, spacesArg)
+	if err != nil {
+		quitError("collect notes", err)
+	}
+
+	opts := note.HTMLOpts{Title: titleArg}
+	if _, err = note.ExportHTML(htmlArg, withAttachments(cmd, notes), opts, forceArg); err != nil {
+		quitError("export html", err)
+	}
 }
 
-func convFileNotes(notes db.Notes) []FileNote {
-	converted := make([]FileNote, len(notes))
-	for i, note := range notes {
-		converted[i] = FileNote{
-			ID:          note.ID,
-			Pinned:      note.Pinned,
-			Space:       note.Space,
-			Content:     note.Content,
-			Created:     note.Created,
-			LastUpdated: note.LastUpdated,
+// withAttachments converts the notes, along with their attachments
+func withAttachments(cmd *cobra.Command, notes note.Notes) []note.FileNote {
+	d := dbOpen()
+	defer d.Close()
+
+	fileNotes := note.FromNotes(notes)
+	for i := range fileNotes {
+		var err error
+		if fileNotes[i], err = note.WithAttachments(cmd.Context(), d, fileNotes[i]); err != nil {
+			quitError("db attachments", err)
 		}
 	}
-	return converted
+	return fileNotes
 }
 
 func exportFilePathAndFormat(args []string) (string, FileFormat, error) {
@@ -117,7 +178,7 @@ func exportFilePathAndFormat(args []string) (string, FileFormat, error) {
 	}
 
 	path := args[0]
-	if forceArg && exists(path) {
+	if !forceArg && exists(path) {
 		return "", UnknownFormat, fmt.Errorf("file already exist")
 	}
 	return path, filenameFormat(path), nil
@@ -139,25 +200,64 @@ func combinedFormat(argFmt, fileFmt FileFormat) (FileFormat, error) {
 
 // cmdArgFormat specifies the file format set by the command line option
 func cmdArgFormat() (FileFormat, error) {
-	if jsonArg {
-		if yamlArg {
+	formats := []struct {
+		arg    bool
+		format FileFormat
+	}{
+		{jsonArg, JSONFormat},
+		{ndjsonArg, JSONLinesFormat},
+		{yamlArg, YAMLFormat},
+		{csvArg, CSVFormat},
+		{tsvArg, TSVFormat},
+	}
+
+	format := UnknownFormat
+	for _, f := range formats {
+		if !f.arg {
+			continue
+		} else if format != UnknownFormat {
 			return UnknownFormat, fmt.Errorf("you can only pick one export format")
 		}
-		return JSONFormat, nil
-	} else if yamlArg {
-		return YAMLFormat, nil
+		format = f.format
 	}
-	return UnknownFormat, nil
+	return format, nil
 }
 
 func filenameFormat(path string) FileFormat {
 	switch strings.ToLower(filepath.Ext(path)) {
 	case ".json":
 		return JSONFormat
+	case ".ndjson", ".jsonl":
+		return JSONLinesFormat
 	case ".yml":
 		return YAMLFormat
 	case ".yaml":
 		return YAMLFormat
+	case ".csv":
+		return CSVFormat
+	case ".tsv":
+		return TSVFormat
 	}
 	return UnknownFormat
 }
+
+// csvOpts are the CSV options from the command line, TSV is CSV delimited by tabs
+func csvOpts(format FileFormat) (note.CSVOpts, error) {
+	opts := note.CSVOpts{
+		Comma:    ',',
+		Columns:  columnsArg,
+		NoHeader: noHeaderArg,
+	}
+	if format == TSVFormat {
+		opts.Comma = '\t'
+	}
+
+	if delimiterArg != "" {
+		delimiter := strings.ReplaceAll(delimiterArg, `\t`, "\t")
+		if utf8.RuneCountInString(delimiter) != 1 {
+			return opts, fmt.Errorf("delimiter must be one character")
+		}
+		opts.Comma, _ = utf8.DecodeRuneInString(delimiter)
+	}
+	return opts, opts.Check()
+}
@@ -22,6 +22,8 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -44,6 +46,9 @@ func finderFromArgs(args []string) (*finder, error) {
 	)
 
 	if regexpArg && !posixArg {
+		if insensitiveArg {
+			expr = "(?i)" + expr
+		}
 		regex, err = regexp.Compile(expr)
 		if err != nil {
 			return nil, fmt.Errorf("compile: %w", err)
@@ -53,6 +58,8 @@ func finderFromArgs(args []string) (*finder, error) {
 		if err != nil {
 			return nil, fmt.Errorf("compile: %w", err)
 		}
+	} else if insensitiveArg {
+		expr = strings.ToLower(expr)
 	}
 
 	return &finder{
@@ -75,38 +82,120 @@ func (f *finder) Match(str string) bool {
 }
 
 func noteFind(cmd *cobra.Command, args []string) {
+	style, color, err := styleColorOpts()
+	if err != nil {
+		quitError("args", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	var notes db.Notes
+	if scanArg || regexpArg || posixArg {
+		notes = scanFind(cmd.Context(), d, args)
+	} else {
+		results, err := d.SearchNotes(cmd.Context(), strings.Join(args, " "), searchOpts(color))
+		if errors.Is(err, db.ErrNoSearchIndex) {
+			notes = scanFind(cmd.Context(), d, args)
+		} else if err != nil {
+			quitError("db search", err)
+		} else {
+			results = filterSearchResults(results)
+			if snippetArg && !idArg {
+				printSnippets(results)
+				return
+			}
+			notes = searchResultNotes(results)
+		}
+	}
+
+	if idArg {
+		ids := notes.GetIDs()
+		printIds(ids, listArg)
+	} else {
+		pprintNotes(notes, style, color)
+	}
+}
+
+// scanFind matches every note against the pattern, without using the search index
+func scanFind(ctx context.Context, d *db.DB, args []string) db.Notes {
 	finder, err := finderFromArgs(args)
 	if err != nil {
 		quitError("pattern", err)
 	}
 
-	style, color, err := styleColorOpts()
+	filterOpts, err := filterOpts()
 	if err != nil {
 		quitError("args", err)
 	}
 
-	d := dbOpen()
-	defer d.Close()
-
 	notes := make(db.Notes, 0)
-	for iter := range d.IterateNotes(nil, allArg || trashArg, nil) {
-		if iter.Err != nil {
-			quitError("db iterate", iter.Err)
+	for note, err := range d.IterateNotes(ctx, nil, allArg || trashArg, nil, filterOpts, db.DefaultBatchSize) {
+		if err != nil {
+			quitError("db iterate", err)
 		}
 
-		if !trashArg && iter.Note.Space == TrashSpace {
+		if !findIncludes(note) {
 			continue
 		}
 
-		if finder.Match(iter.Note.Content) {
-			notes = append(notes, iter.Note)
+		if finder.Match(note.Content) {
+			notes = append(notes, note)
 		}
 	}
+	return notes
+}
 
-	if idArg {
-		ids := notes.GetIDs()
-		printIds(ids, listArg)
-	} else {
-		pprintNotes(notes, style, color)
+func searchOpts(doColor bool) *db.SearchOpts {
+	filterOpts, err := filterOpts()
+	if err != nil {
+		quitError("args", err)
+	}
+
+	opts := &db.SearchOpts{
+		All:    allArg || trashArg,
+		Filter: filterOpts,
+		Prefix: prefixArg,
+		Phrase: phraseArg,
+	}
+	if snippetArg {
+		opts.SnippetTokens = 12
+		opts.HighlightStart = "["
+		opts.HighlightEnd = "]"
+		if doColor {
+			opts.HighlightStart = "\x1b[1;32m"
+			opts.HighlightEnd = "\x1b[0m"
+		}
+	}
+	return opts
+}
+
+func filterSearchResults(results []db.SearchResult) []db.SearchResult {
+	out := make([]db.SearchResult, 0, len(results))
+	for _, result := range results {
+		if findIncludes(result.Note) {
+			out = append(out, result)
+		}
+	}
+	return out
+}
+
+// findIncludes determines if notes from the trash should be part of the result
+func findIncludes(note db.Note) bool {
+	return trashArg || note.Space != TrashSpace
+}
+
+func searchResultNotes(results []db.SearchResult) db.Notes {
+	notes := make(db.Notes, len(results))
+	for i, result := range results {
+		notes[i] = result.Note
+	}
+	return notes
+}
+
+func printSnippets(results []db.SearchResult) {
+	for _, result := range results {
+		snippet := strings.ReplaceAll(result.Snippet, "\n", " ")
+		fmt.Printf("%v\t%v\n", result.ID, snippet)
 	}
 }
@@ -0,0 +1,198 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	CurrentRevision = "current"
+)
+
+func noteHistory(cmd *cobra.Command, args []string) {
+	id, err := checkEdit(args)
+	if err != nil {
+		quitError("args", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	current, err := d.GetNote(cmd.Context(), id)
+	if err != nil {
+		quitError("db get", err)
+	}
+
+	revisions, err := d.Revisions(cmd.Context(), id)
+	if err != nil {
+		quitError("db revisions", err)
+	}
+
+	var (
+		tw      = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		dateFmt = "2006-01-02 15:04:05"
+	)
+
+	fmt.Fprintln(tw, "Revision\tSaved\tPreview\t")
+	for _, rev := range revisions {
+		preview := getPreview(rev.Content, int(previewArg))
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", rev.Revision, rev.Created.Format(dateFmt), preview)
+	}
+	preview := getPreview(current.Content, int(previewArg))
+	fmt.Fprintf(tw, "%v\t%v\t%v\n", CurrentRevision, current.LastUpdated.Format(dateFmt), preview)
+
+	tw.Flush()
+}
+
+func noteDiff(cmd *cobra.Command, args []string) {
+	id, fromRev, toRev, err := checkDiff(args)
+	if err != nil {
+		quitError("args", err)
+	}
+
+	_, doColor, err := styleColorOpts()
+	if err != nil {
+		quitError("args", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	// Without explicit revisions, the latest revision is compared to the current content
+	if fromRev == "" {
+		revisions, err := d.Revisions(cmd.Context(), id)
+		if err != nil {
+			quitError("db revisions", err)
+		}
+		if len(revisions) == 0 {
+			fmt.Fprintln(os.Stderr, "Note has no revisions")
+			os.Exit(2)
+		}
+		fromRev = strconv.Itoa(revisions[len(revisions)-1].Revision)
+	}
+
+	from := revisionContent(cmd.Context(), d, id, fromRev)
+	to := revisionContent(cmd.Context(), d, id, toRev)
+
+	fromName := fmt.Sprintf("note %v (revision %v)", id, fromRev)
+	toName := fmt.Sprintf("note %v (revision %v)", id, toRev)
+	writeUnifiedDiff(os.Stdout, fromName, toName, splitLines(from), splitLines(to), doColor)
+}
+
+func noteRevert(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		quit("requires positional arguments id and revision")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		quitError("parse id", err)
+	}
+	revision, err := strconv.Atoi(args[1])
+	if err != nil {
+		quitError("parse revision", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	rev, err := d.GetRevision(cmd.Context(), id, revision)
+	if err != nil {
+		quitError("db revision", err)
+	}
+
+	current, err := d.GetNote(cmd.Context(), id)
+	if err != nil {
+		quitError("db get", err)
+	}
+
+	if current.Content == rev.Content {
+		fmt.Fprintln(os.Stderr, "No changes")
+		os.Exit(2)
+	}
+
+	// The current content is kept as a new revision, so a revert can be undone
+	if err = note.Edit(cmd.Context(), d, id, rev.Content, editOpts()); err != nil {
+		quitError("db edit", err)
+	}
+
+	fmt.Printf("Note reverted to revision %v\n", revision)
+}
+
+// revisionContent returns the content of a revision, or the current content of the note
+func revisionContent(ctx context.Context, s note.Store, id int, revision string) string {
+	if revision == CurrentRevision {
+		current, err := s.GetNote(ctx, id)
+		if err != nil {
+			quitError("db get", err)
+		}
+		return current.Content
+	}
+
+	number, err := strconv.Atoi(revision)
+	if err != nil {
+		quitError("parse revision", err)
+	}
+
+	rev, err := s.GetRevision(ctx, id, number)
+	if err != nil {
+		quitError("db revision", err)
+	}
+	return rev.Content
+}
+
+// editOpts enforces the configured revision retention of edited notes
+func editOpts() note.EditOpts {
+	return note.EditOpts{KeepRevisions: viper.GetInt(ViperRevisions)}
+}
+
+// checkDiff parses the arguments: id [revision] [revision]
+// An empty from revision means the latest revision.
+func checkDiff(args []string) (int, string, string, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return 0, "", "", fmt.Errorf("requires positional argument id and at most two revisions")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	revs := []string{"", CurrentRevision}
+	copy(revs, args[1:])
+	for _, rev := range revs {
+		if _, err := strconv.Atoi(rev); err != nil && rev != "" && rev != CurrentRevision {
+			return 0, "", "", fmt.Errorf("revision must be a number or '%v': %v", CurrentRevision, rev)
+		}
+	}
+
+	return id, revs[0], revs[1], nil
+}
@@ -35,7 +35,7 @@ func noteId(cmd *cobra.Command, args []string) {
 	db := dbOpen()
 	defer db.Close()
 
-	ids, err := db.GetIDs(spaces, !descendingArg)
+	ids, err := db.GetIDs(cmd.Context(), spaces, !descendingArg)
 	if err != nil {
 		quitError("db", err)
 	}
@@ -22,128 +22,203 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
+	"iter"
+	"os"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
+	"github.com/spf13/viper"
 )
 
 func noteImport(cmd *cobra.Command, args []string) {
+	if len(args) == 0 && markdownArg == "" {
+		quit("requires at least one file or --markdown")
+	}
+	if format, _ := cmdArgFormat(); fromArg != "" && format != UnknownFormat {
+		quit("--from cannot be combined with a file format")
+	}
+
 	paths, err := uniquePaths(args)
 	if err != nil {
 		quitError("args", err)
 	}
 
+	mode, err := note.ParseImportMode(importModeArg)
+	if err != nil {
+		quitError("args", err)
+	}
+
 	preferredFmt, err := cmdArgFormat()
 	if err != nil {
 		quitError("args", err)
 	}
 
-	allNotes := make([]FileNote, 0)
-	for _, path := range paths {
-		fileFmt := filenameFormat(path)
-		if fileFmt == UnknownFormat {
+	// Notes read from directories, or with the importer of another program
+	var dirNotes []note.FileNote
+	if fromArg != "" {
+		for _, path := range paths {
+			notes, err := note.ImportFrom(fromArg, path, viper.GetString(ViperSpace))
+			if err != nil {
+				quitError("read", err)
+			}
+			dirNotes = append(dirNotes, notes...)
+		}
+		paths = nil
+	}
+
+	formats := make([]FileFormat, len(paths))
+	for i, path := range paths {
+		formats[i] = filenameFormat(path)
+		if formats[i] == UnknownFormat {
 			// We know that if we get here the preferredFmt should not be unknown
 			// This is checked during args validation
-			fileFmt = preferredFmt
+			formats[i] = preferredFmt
+		}
+		if formats[i] == UnknownFormat {
+			quit("unknown format")
 		}
+	}
 
-		reader, err := openFile(path)
+	if markdownArg != "" {
+		// Files at the top level of the directory are not in a space directory
+		notes, err := note.ImportMarkdown(markdownArg, viper.GetString(ViperSpace))
 		if err != nil {
-			quitError("open file", err)
+			quitError("read markdown", err)
 		}
-		defer reader.Close()
+		dirNotes = append(dirNotes, notes...)
+	}
 
-		var notes []FileNote
-		switch fileFmt {
-		case JSONFormat:
-			notes, err = decodeJSON(reader)
-			if err != nil {
-				quitError("decode JSON", err)
+	// Notes without a space are put in the default space, and missing timestamps are now
+	defaultSpace, now := viper.GetString(ViperSpace), time.Now()
+	notes := func(yield func(note.FileNote, error) bool) {
+		withDefaults := func(n note.FileNote, err error) bool {
+			n.SetDefaults(defaultSpace, now)
+			return yield(n, err)
+		}
+		for i, path := range paths {
+			if !decodeFile(path, formats[i], withDefaults) {
+				return
 			}
-		case YAMLFormat:
-			notes, err = decodeYAML(reader)
-			if err != nil {
-				quitError("decode YAML", err)
+		}
+		for _, n := range dirNotes {
+			if !withDefaults(n, nil) {
+				return
 			}
-		default:
-			quit("unknown format")
 		}
-
-		allNotes = append(allNotes, notes...)
 	}
 
-	dbNotes := fileNotesToDB(allNotes)
+	d := dbOpen()
+	defer d.Close()
 
-	db := dbOpen()
-	defer db.Close()
+	if dryRunArg {
+		allNotes := make([]note.FileNote, 0)
+		for n, err := range notes {
+			if err != nil {
+				quitError("read", err)
+			}
+			allNotes = append(allNotes, n)
+		}
 
-	ids := make([]int, 0, len(dbNotes))
-	for _, note := range dbNotes {
-		id, err := db.AddNote(note, true)
+		plan, err := note.PlanImport(cmd.Context(), d, allNotes, mode)
 		if err != nil {
-			err = fmt.Errorf(
-				"generated ids: %v, but only %v of %v successful. db error: %w",
-				ids, len(ids), len(dbNotes), err)
-			quitError("db add", err)
+			quitError("db import", err)
 		}
-		ids = append(ids, int(id))
+		printImportPlan(plan)
+		return
+	}
+
+	var (
+		created = make([]int, 0)
+		updated = make([]int, 0)
+		skipped = 0
+	)
+	err = note.ImportStream(cmd.Context(), d, notes, mode, func(step note.ImportStep) {
+		switch step.Action {
+		case note.ImportCreate:
+			created = append(created, step.ID)
+		case note.ImportUpdate:
+			updated = append(updated, step.ID)
+		case note.ImportSkip:
+			skipped++
+		}
+	})
+	if err != nil {
+		quitError("db import", fmt.Errorf("no notes were imported: %w", err))
 	}
 
 	if listArg {
-		for _, id := range ids {
+		for _, id := range append(created, updated...) {
 			fmt.Println(id)
 		}
-	} else {
-		idStrs := manyIntToString(ids)
-		joined := strings.Join(idStrs, ", ")
-		fmt.Printf("Notes created: %v\n", joined)
+		return
+	}
+
+	fmt.Printf("Notes created: %v\n", strings.Join(manyIntToString(created), ", "))
+	if len(updated) > 0 {
+		fmt.Printf("Notes updated: %v\n", strings.Join(manyIntToString(updated), ", "))
+	}
+	if skipped > 0 {
+		fmt.Printf("Notes skipped: %v\n", skipped)
 	}
 }
 
-func fileNotesToDB(notes []FileNote) db.Notes {
-	out := make(db.Notes, len(notes))
-	for n, note := range notes {
-		out[n] = db.Note{
-			Pinned:      note.Pinned,
-			Space:       note.Space,
-			Content:     note.Content,
-			Created:     note.Created,
-			LastUpdated: note.LastUpdated,
+// decodeFile yields the notes of a file as they are decoded, it returns false if yield did
+func decodeFile(path string, format FileFormat, yield func(note.FileNote, error) bool) bool {
+	reader, err := openFile(path)
+	if err != nil {
+		return yield(note.FileNote{}, fmt.Errorf("open file: %w", err))
+	}
+	defer reader.Close()
+
+	var notes iter.Seq2[note.FileNote, error]
+	switch format {
+	case JSONFormat, JSONLinesFormat:
+		notes = note.DecodeJSON(reader)
+	case YAMLFormat:
+		notes = note.DecodeYAML(reader)
+	case CSVFormat, TSVFormat:
+		opts, err := csvOpts(format)
+		if err != nil {
+			yield(note.FileNote{}, err)
+			return false
 		}
+		notes = note.DecodeCSV(reader, opts)
 	}
-	return out
-}
 
-func decodeJSON(reader io.Reader) ([]FileNote, error) {
-	decoder := json.NewDecoder(reader)
-	out := make([]FileNote, 0)
-	for {
-		var notes []FileNote
-		if err := decoder.Decode(&notes); err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
+	for n, err := range notes {
+		if err != nil {
+			yield(n, fmt.Errorf("decode %v: %w", path, err))
+			return false
+		}
+		if !yield(n, nil) {
+			return false
 		}
-		out = append(out, notes...)
 	}
-	return out, nil
+	return true
 }
 
-func decodeYAML(reader io.Reader) ([]FileNote, error) {
-	var notes []FileNote
-
-	decoder := yaml.NewDecoder(reader)
-	err := decoder.Decode(&notes)
-	if err != nil {
-		return nil, err
+func printImportPlan(plan note.ImportPlan) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Action\tID\tSpace\tPreview\tReason\t")
+	for _, step := range plan {
+		id := "new"
+		if step.ID != 0 {
+			id = strconv.Itoa(step.ID)
+		}
+		preview := getPreview(step.Note.Content, int(previewArg))
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", step.Action, id, step.Note.Space, preview, step.Reason)
 	}
-	return notes, nil
+	tw.Flush()
+
+	fmt.Printf(
+		"\nWould create %v, update %v and skip %v note(s)\n",
+		plan.Count(note.ImportCreate), plan.Count(note.ImportUpdate), plan.Count(note.ImportSkip),
+	)
 }
 
 func uniquePaths(args []string) ([]string, error) {
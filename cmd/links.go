@@ -0,0 +1,130 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+)
+
+func noteLinks(cmd *cobra.Command, args []string) {
+	ids, err := parseIds(args)
+	if err != nil {
+		quitError("parse ids", err)
+	}
+	id := ids[0]
+
+	d := dbOpen()
+	defer d.Close()
+
+	if _, err := d.GetNote(cmd.Context(), id); err != nil && !errors.Is(err, note.ErrLocked) {
+		quitError("db get", err)
+	}
+
+	outgoing, err := d.OutgoingLinks(cmd.Context(), id)
+	if err != nil {
+		quitError("db links", err)
+	}
+	backlinks, err := d.Backlinks(cmd.Context(), []int{id})
+	if err != nil {
+		quitError("db backlinks", err)
+	}
+
+	incoming := make([]int, len(backlinks))
+	for i, link := range backlinks {
+		incoming[i] = link.Source
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	printLinked(cmd.Context(), tw, d, "Links", outgoing)
+	printLinked(cmd.Context(), tw, d, "Backlinks", incoming)
+	tw.Flush()
+}
+
+// printLinked prints the linked notes with a preview, or why it cannot be shown
+func printLinked(ctx context.Context, tw *tabwriter.Writer, d *db.DB, title string, ids []int) {
+	fmt.Fprintf(tw, "%v:\n", title)
+	if len(ids) == 0 {
+		fmt.Fprintln(tw, "  (none)")
+	}
+
+	for _, id := range ids {
+		preview := ""
+		n, err := d.GetNote(ctx, id)
+		switch {
+		case errors.Is(err, note.ErrNotFound):
+			preview = "(missing)"
+		case errors.Is(err, note.ErrLocked):
+			preview = "(locked)"
+		case err != nil:
+			quitError("db get", err)
+		case n.Space == TrashSpace:
+			preview = "(trashed) " + getPreview(n.Content, int(previewArg))
+		default:
+			preview = getPreview(n.Content, int(previewArg))
+		}
+		fmt.Fprintf(tw, "  %v\t%v\n", id, preview)
+	}
+}
+
+// noteBacklinks maps the notes to the IDs of the notes linking to them
+func noteBacklinks(ctx context.Context, d *db.DB, ids []int) map[int][]int {
+	links, err := d.Backlinks(ctx, ids)
+	if err != nil {
+		quitError("db backlinks", err)
+	}
+
+	out := make(map[int][]int, len(ids))
+	for _, link := range links {
+		out[link.Target] = append(out[link.Target], link.Source)
+	}
+	return out
+}
+
+// warnDanglingLinks warns about links from other notes, to notes that are about to be removed
+func warnDanglingLinks(ctx context.Context, d *db.DB, ids []int) {
+	links, err := note.DanglingLinks(ctx, d, ids)
+	if err != nil {
+		quitError("db backlinks", err)
+	}
+
+	sources := make(map[int][]int)
+	targets := []int{}
+	for _, link := range links {
+		if _, ok := sources[link.Target]; !ok {
+			targets = append(targets, link.Target)
+		}
+		sources[link.Target] = append(sources[link.Target], link.Source)
+	}
+
+	for _, target := range targets {
+		fmt.Fprintf(os.Stderr, "warning: note %v is linked from note %v\n", target, strings.Join(manyIntToString(sources[target]), ", "))
+	}
+}
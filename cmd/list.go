@@ -22,10 +22,14 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"iter"
 	"strings"
+	"time"
 
 	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/maps"
@@ -62,28 +66,105 @@ func noteList(cmd *cobra.Command, args []string) {
 		quitError("args", err)
 	}
 
-	notes, err := selectNotes(args)
+	notes, err := selectNotes(cmd, args)
 	if err != nil {
 		quitError("collect notes", err)
 	}
 
+	if len(args) == 1 && !cmd.Flags().Changed("style") {
+		style = spaceStyle(cmd.Context(), args[0], style)
+	}
+
 	pprintNotes(notes, style, color)
 }
 
-func selectNotes(spaces []string) (db.Notes, error) {
+func selectNotes(cmd *cobra.Command, spaces []string) (db.Notes, error) {
+	d := dbOpen()
+	defer d.Close()
+
+	sortOpts, pageOpts, filterOpts, err := selectOpts(cmd, d, spaces)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := d.SelectNotes(cmd.Context(), spaces, allArg, sortOpts, pageOpts, filterOpts)
+	if err != nil {
+		return nil, fmt.Errorf("db list: %w", err)
+	}
+	return notes, nil
+}
+
+// iterateNotes is selectNotes as a stream, which reads the notes in batches from d
+func iterateNotes(cmd *cobra.Command, d *db.DB, spaces []string) (iter.Seq2[db.Note, error], error) {
+	sortOpts, pageOpts, filterOpts, err := selectOpts(cmd, d, spaces)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := d.IterateNotes(cmd.Context(), spaces, allArg, sortOpts, filterOpts, db.DefaultBatchSize)
+	return pageNotes(notes, pageOpts), nil
+}
+
+// selectOpts are the options of the select flag set
+func selectOpts(cmd *cobra.Command, d *db.DB, spaces []string) (*db.SortOpts, *db.PageOpts, *db.FilterOpts, error) {
 	sortOpts, pageOpts, err := listOpts()
 	if err != nil {
-		return nil, fmt.Errorf("args: %w", err)
+		return nil, nil, nil, fmt.Errorf("args: %w", err)
+	}
+
+	filterOpts, err := filterOpts()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("args: %w", err)
+	}
+
+	// The default sort of a space is used, when only that space is listed
+	if len(spaces) == 1 && !cmd.Flags().Changed("sort") {
+		space, err := d.GetSpace(cmd.Context(), spaces[0])
+		if err == nil && space.DefaultSort != "" {
+			sortOpts.SortColumn = space.DefaultSort
+		}
+	}
+	return sortOpts, pageOpts, filterOpts, nil
+}
+
+// pageNotes skips the offset of a stream, and stops it at the limit
+func pageNotes(notes iter.Seq2[db.Note, error], pageOpts *db.PageOpts) iter.Seq2[db.Note, error] {
+	if pageOpts.Limit == db.NoLimit {
+		return notes
+	}
+	return func(yield func(db.Note, error) bool) {
+		n := 0
+		for note, err := range notes {
+			if err != nil {
+				yield(note, err)
+				return
+			}
+			n++
+			if n <= pageOpts.Offset {
+				continue
+			}
+			if !yield(note, nil) || n >= pageOpts.Offset+pageOpts.Limit {
+				return
+			}
+		}
 	}
+}
 
+// spaceStyle is the default style of a space, or style if it has none
+func spaceStyle(ctx context.Context, name string, style Style) Style {
 	d := dbOpen()
 	defer d.Close()
 
-	notes, err := d.SelectNotes(spaces, allArg, sortOpts, pageOpts)
+	space, err := d.GetSpace(ctx, name)
+	if err != nil || space.DefaultStyle == "" {
+		return style
+	}
+
+	spaceStyle, err := parseStyle(space.DefaultStyle)
 	if err != nil {
-		return nil, fmt.Errorf("db list: %w", err)
+		return style
 	}
-	return notes, nil
+	return spaceStyle
 }
 
 func listOpts() (*db.SortOpts, *db.PageOpts, error) {
@@ -108,6 +189,62 @@ func listOpts() (*db.SortOpts, *db.PageOpts, error) {
 	return sortOpts, pageOpts, nil
 }
 
+func filterOpts() (*db.FilterOpts, error) {
+	for _, tag := range tagsArg {
+		if err := note.CheckTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	filterOpts := &db.FilterOpts{
+		Tags:      tagsArg,
+		Recursive: recursiveArg,
+		MinID:     minIdArg,
+		MaxID:     maxIdArg,
+		MinLength: minLengthArg,
+		MaxLength: maxLengthArg,
+	}
+
+	now := time.Now()
+	times := []struct {
+		arg   string
+		value *time.Time
+	}{
+		{sinceArg, &filterOpts.CreatedSince},
+		{untilArg, &filterOpts.CreatedUntil},
+		{updatedSinceArg, &filterOpts.UpdatedSince},
+		{updatedUntilArg, &filterOpts.UpdatedUntil},
+	}
+	for _, t := range times {
+		if t.arg == "" {
+			continue
+		}
+		parsed, err := db.ParseTime(t.arg, now)
+		if err != nil {
+			return nil, err
+		}
+		*t.value = parsed
+	}
+
+	if whereArg != "" {
+		query, err := parseWhere()
+		if err != nil {
+			return nil, err
+		}
+		filterOpts.Query = query
+	}
+
+	if pinnedOnlyArg && unpinnedOnlyArg {
+		return nil, fmt.Errorf("--pinned and --unpinned are mutually exclusive")
+	} else if pinnedOnlyArg || unpinnedOnlyArg {
+		filterOpts.Pinned = &pinnedOnlyArg
+	}
+
+	if err := filterOpts.Check(); err != nil {
+		return nil, err
+	}
+	return filterOpts, nil
+}
+
 func pprintNotes(notes db.Notes, style Style, doColor bool) {
 	switch style {
 	case MinimalStyle:
@@ -115,7 +252,7 @@ func pprintNotes(notes db.Notes, style Style, doColor bool) {
 	case LightStyle:
 		printNotesLight(notes, doColor)
 	case FullStyle:
-		printNotesFull(notes, doColor)
+		printNotesFull(notes, doColor, nil)
 	}
 }
 
@@ -154,7 +291,8 @@ func printNotesLight(notes db.Notes, doColor bool) {
 	postColor(doColor)
 }
 
-func printNotesFull(notes db.Notes, doColor bool) {
+// printNotesFull prints all metadata of the notes, and the notes linking to them if backlinks is not nil
+func printNotesFull(notes db.Notes, doColor bool, backlinks map[int][]int) {
 	fullFmt := "2006-01-02 15:04:05"
 	preColor(doColor)
 
@@ -165,6 +303,8 @@ func printNotesFull(notes db.Notes, doColor bool) {
 		if n.Pinned {
 			pinned = "yes"
 		}
+		tags := strings.Join(n.Tags, ", ")
+		linked := strings.Join(manyIntToString(backlinks[n.ID]), ", ")
 		if doColor {
 			Green.Printf("ID: ")
 			fmt.Printf("%v\n", n.ID)
@@ -172,16 +312,40 @@ func printNotesFull(notes db.Notes, doColor bool) {
 			fmt.Printf("%v\n", pinned)
 			Green.Printf("Space: ")
 			fmt.Printf("%v\n", n.Space)
+			Green.Printf("Tags: ")
+			fmt.Printf("%v\n", tags)
 			Green.Printf("Created: ")
 			fmt.Printf("%v\n", created)
 			Green.Printf("Last Updated: ")
 			fmt.Printf("%v\n", updated)
+			if n.Due != nil {
+				Green.Printf("Due: ")
+				fmt.Printf("%v\n", formatDate(*n.Due))
+			}
+			if n.RemindAt != nil {
+				Green.Printf("Remind: ")
+				fmt.Printf("%v\n", formatDate(*n.RemindAt))
+			}
+			if backlinks != nil {
+				Green.Printf("Backlinks: ")
+				fmt.Printf("%v\n", linked)
+			}
 			Green.Printf("Content:\n")
 			fmt.Printf("%v\n", n.Content)
 		} else {
 			fmt.Printf(
-				"ID: %v\nPinned: %v\nSpace: %v\nCreated: %v\nLast Updated: %v\nContent:\n%v\n",
-				n.ID, pinned, n.Space, created, updated, n.Content)
+				"ID: %v\nPinned: %v\nSpace: %v\nTags: %v\nCreated: %v\nLast Updated: %v\n",
+				n.ID, pinned, n.Space, tags, created, updated)
+			if n.Due != nil {
+				fmt.Printf("Due: %v\n", formatDate(*n.Due))
+			}
+			if n.RemindAt != nil {
+				fmt.Printf("Remind: %v\n", formatDate(*n.RemindAt))
+			}
+			if backlinks != nil {
+				fmt.Printf("Backlinks: %v\n", linked)
+			}
+			fmt.Printf("Content:\n%v\n", n.Content)
 		}
 	}
 
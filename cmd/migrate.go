@@ -0,0 +1,75 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/bdazl/note/db"
+	"github.com/spf13/cobra"
+)
+
+func noteMigrate(cmd *cobra.Command, args []string) {
+	d := dbOpenUnmigrated()
+	defer d.Close()
+
+	status, err := d.MigrationStatus(cmd.Context())
+	if err != nil {
+		quitError("db status", err)
+	}
+
+	if statusArg || dryRunArg {
+		printMigrationStatus(status, dryRunArg)
+		return
+	}
+
+	if len(status.Pending) == 0 {
+		fmt.Printf("Database is up to date (version %v)\n", status.Current)
+		return
+	}
+
+	applied, err := d.Migrate(cmd.Context())
+	for _, m := range applied {
+		fmt.Printf("Applied migration %v: %v\n", m.Version, m.Description)
+	}
+	if err != nil {
+		quitError("db migrate", err)
+	}
+}
+
+func printMigrationStatus(status *db.MigrationStatus, dryRun bool) {
+	fmt.Printf("Schema version: %v (latest: %v)\n", status.Current, status.Latest)
+
+	if len(status.Pending) == 0 {
+		fmt.Println("No pending migrations")
+		return
+	}
+
+	if dryRun {
+		fmt.Println("The following migrations would be applied:")
+	} else {
+		fmt.Println("Pending migrations:")
+	}
+	for _, m := range status.Pending {
+		fmt.Printf("  %v: %v\n", m.Version, m.Description)
+	}
+}
@@ -24,38 +24,32 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
 )
 
 func noteMove(cmd *cobra.Command, args []string) {
-	space, ids, err := checkMove(args)
-	if err != nil {
+	space := args[0]
+	if err := note.CheckSpace(space); err != nil {
 		quitError("args", err)
 	}
 
-	db := dbOpen()
-	defer db.Close()
+	d := dbOpen()
+	defer d.Close()
 
-	uniqueIds := removeDuplicates(ids)
-	if err = db.MoveNotes(uniqueIds, space); err != nil {
+	ids, notes, err := bulkIds(cmd, d, args[1:])
+	if err != nil {
+		quitError("select notes", err)
+	}
+	confirmBulk(cmd, notes, fmt.Sprintf("move %v note(s) to %v", len(ids), space))
+
+	if err = note.Move(cmd.Context(), d, ids, space); err != nil {
 		quitError("db move", err)
 	}
 
 	noteStr := "note"
-	if len(uniqueIds) > 1 {
+	if len(ids) > 1 {
 		noteStr = "notes"
 	}
 	fmt.Printf("Modified %s.\n", noteStr)
 }
-
-func checkMove(args []string) (string, []int, error) {
-	if len(args) < 2 {
-		return "", nil, fmt.Errorf("requires positional arguments space and id")
-	}
-	ids, err := parseIds(args[1:])
-	if err != nil {
-		return "", nil, err
-	}
-
-	return args[0], ids, nil
-}
@@ -30,7 +30,7 @@ import (
 )
 
 const (
-	note = "note"
+	appName = "note"
 
 	defaultConfigName  = "note.yaml"
 	defaultStorageName = "note.db"
@@ -75,7 +75,7 @@ func defaultConfigPath() (string, error) {
 		return "", err
 	}
 
-	return filepath.Join(cfgDir, note, "note.yaml"), nil
+	return filepath.Join(cfgDir, appName, "note.yaml"), nil
 }
 
 func defaultStoragePath() (string, error) {
@@ -84,7 +84,7 @@ func defaultStoragePath() (string, error) {
 		return "", err
 	}
 
-	return filepath.Join(dataDir, note, defaultStorageName), nil
+	return filepath.Join(dataDir, appName, defaultStorageName), nil
 }
 
 // The default directory of configuration files
@@ -28,33 +28,33 @@ import (
 )
 
 func notePin(cmd *cobra.Command, args []string) {
-	pin(args, true)
+	pin(cmd, args, true)
 }
 
 func noteUnpin(cmd *cobra.Command, args []string) {
-	pin(args, false)
+	pin(cmd, args, false)
 }
 
-func pin(args []string, pinned bool) {
-	ids, err := parseIds(args)
-	if err != nil {
-		quitError("parse ids", err)
-	}
-
+func pin(cmd *cobra.Command, args []string, pinned bool) {
 	db := dbOpen()
 	defer db.Close()
 
-	uniqueIds := removeDuplicates(ids)
-	if err = db.PinNotes(uniqueIds, pinned); err != nil {
-		quitError("db pin", err)
+	action, pinStr := "unpin", "unpinned"
+	if pinned {
+		action, pinStr = "pin", "pinned"
 	}
 
-	pinStr := "unpinned"
-	if pinned {
-		pinStr = "pinned"
+	ids, notes, err := bulkIds(cmd, db, args)
+	if err != nil {
+		quitError("select notes", err)
+	}
+	confirmBulk(cmd, notes, fmt.Sprintf("%v %v note(s)", action, len(ids)))
+
+	if err = db.PinNotes(cmd.Context(), ids, pinned); err != nil {
+		quitError("db pin", err)
 	}
 
-	count := len(uniqueIds)
+	count := len(ids)
 	if count == 1 {
 		fmt.Printf("Note %v\n", pinStr)
 	} else {
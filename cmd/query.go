@@ -0,0 +1,69 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+)
+
+func noteQuery(cmd *cobra.Command, args []string) {
+	query := joinQueryArgs(args)
+	if whereArg != "" {
+		query = fmt.Sprintf("(%v) (%v)", query, whereArg)
+	}
+	whereArg = query
+
+	noteList(cmd, nil)
+}
+
+// joinQueryArgs joins the arguments of a query, quoting the ones that were
+// quoted in the shell, unless the whole query was given as one argument
+func joinQueryArgs(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg
+		if strings.ContainsAny(arg, " \t\n") {
+			parts[i] = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func parseWhere() (note.Expr, error) {
+	query, err := note.ParseQuery(whereArg, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if query == nil {
+		return nil, fmt.Errorf("the query is empty")
+	}
+	return query, nil
+}
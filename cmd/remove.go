@@ -27,25 +27,19 @@ import (
 	"os"
 	"strings"
 
+	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
 )
 
 const (
-	TrashSpace = ".trash"
+	TrashSpace = note.TrashSpace
 )
 
 func noteRemove(cmd *cobra.Command, args []string) {
-	// Either ids are provided or a specific space must be chosen
-	var ids []int
-	if len(args) != 0 {
-		if allInSpaceArg != "" {
-			quit("you must choose either individual notes or --all-in-space")
-		}
-		parsedIds, err := parseIds(args)
-		if err != nil {
-			quitError("parse ids", err)
-		}
-		ids = parsedIds
+	// Either ids or a selector are provided, or a specific space must be chosen
+	if allInSpaceArg != "" && (len(args) != 0 || selectorChanged(cmd)) {
+		quit("you must choose either individual notes, a selector or --all-in-space")
 	}
 
 	// Add the stupid case check
@@ -53,45 +47,57 @@ func noteRemove(cmd *cobra.Command, args []string) {
 		quit("this action does nothing")
 	}
 
-	db := dbOpen()
-	defer db.Close()
-
-	if len(ids) == 0 {
-		// allInSpaceArg is set and no args provided means find all notes in specific space
-		allNotesInSpace, err := db.SelectNotes([]string{allInSpaceArg}, false, nil, nil)
+	d := dbOpen()
+	defer d.Close()
+
+	var (
+		ids   []int
+		notes db.Notes
+		err   error
+	)
+	if allInSpaceArg != "" {
+		// Find all notes in specific space
+		notes, err = d.SelectNotes(cmd.Context(), []string{allInSpaceArg}, false, nil, nil, nil)
 		if err != nil {
 			quitError("db list", err)
 		}
-
-		ids = allNotesInSpace.GetIDs()
+		ids = notes.GetIDs()
+	} else {
+		ids, notes, err = bulkIds(cmd, d, args)
+		if err != nil {
+			quitError("select notes", err)
+		}
 	}
 
-	uniqueIds := removeDuplicates(ids)
-	if len(uniqueIds) == 0 {
+	if len(ids) == 0 {
 		fmt.Println("No notes deleted")
 		os.Exit(0)
 	}
 
-	msgEnd := "moved to trash"
+	action, msgEnd := "move %v note(s) to trash", "moved to trash"
 	if permanentArg {
-		if !noConfirmArg {
-			fmt.Printf("WARNING: You are about to permanently remove %v note(s).\n", len(uniqueIds))
-			fmt.Printf("Write 'yes' to confirm permanent delete: ")
-			response := readUserInput()
-			if response != "yes" {
-				os.Exit(2)
-			}
-		}
+		action, msgEnd = "permanently remove %v note(s)", "permanently removed"
+	}
+	action = fmt.Sprintf(action, len(ids))
 
-		if err := db.PermanentRemoveNotes(uniqueIds); err != nil {
-			quitError("db remove", err)
+	warnDanglingLinks(cmd.Context(), d, ids)
+
+	if permanentArg && !dryRunArg && !noConfirmArg {
+		fmt.Printf("WARNING: You are about to permanently remove %v note(s).\n", len(ids))
+		fmt.Printf("Write 'yes' to confirm permanent delete: ")
+		response := readUserInput()
+		if response != "yes" {
+			os.Exit(2)
 		}
-		msgEnd = "permanently removed"
-	} else if err := db.MoveNotes(uniqueIds, TrashSpace); err != nil {
-		quitError("db move", err)
+	} else {
+		confirmBulk(cmd, notes, action)
+	}
+
+	if err := note.Remove(cmd.Context(), d, ids, note.RemoveOpts{Permanent: permanentArg}); err != nil {
+		quitError("db remove", err)
 	}
 
-	count := len(uniqueIds)
+	count := len(ids)
 	if count == 1 {
 		fmt.Printf("Note %v\n", msgEnd)
 	} else {
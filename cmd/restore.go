@@ -0,0 +1,85 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func noteRestore(cmd *cobra.Command, args []string) {
+	var ids []int
+	if len(args) != 0 {
+		if allArg {
+			quit("you must choose either individual notes or --all")
+		}
+		parsedIds, err := parseIds(args)
+		if err != nil {
+			quitError("parse ids", err)
+		}
+		ids = removeDuplicates(parsedIds)
+	} else if !allArg {
+		quit("requires positional argument id or --all")
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	locked := 0
+	if allArg {
+		trashed, err := note.TrashedIDs(cmd.Context(), d, time.Time{})
+		if err != nil {
+			quitError("db trash", err)
+		}
+		if locked, err = d.LockedTrash(cmd.Context(), time.Time{}); err != nil {
+			quitError("db trash", err)
+		}
+		ids = trashed
+	}
+
+	if len(ids) == 0 {
+		if locked > 0 {
+			printLockedTrash(locked, "restored")
+		} else {
+			fmt.Println("Trash is empty")
+		}
+		os.Exit(0)
+	}
+
+	// Notes that were trashed before their origin was recorded go to the default space
+	if err := note.Restore(cmd.Context(), d, ids, viper.GetString(ViperSpace)); err != nil {
+		quitError("db restore", err)
+	}
+
+	count := len(ids)
+	if count == 1 {
+		fmt.Println("Note restored")
+	} else {
+		fmt.Printf("%v notes restored\n", count)
+	}
+	printLockedTrash(locked, "restored")
+}
@@ -24,7 +24,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -68,6 +70,16 @@ Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
 
 Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
 `
+
+	bulkHelp = `
+A selector is any combination of --find (a search pattern, see 'note find -h'),
+--space, --where (a query, see 'note query -h') and the other filters, such as
+--since or --tag. Notes in hidden spaces are only selected if their space is
+given. Selected notes are shown and the change must be confirmed, unless
+--no-confirm is given. Use --dry-run to only show the notes that would change.
+
+All notes are changed in a single transaction: if any of them can't be changed,
+none of them are.`
 )
 
 var (
@@ -149,12 +161,34 @@ input.`,
 Removal is by default an operation that moves the notes to the .trash space.
 To remove notes permanently you need to specify the '--permanent' flag. It is
 possible to remove all notes in a space, by specifying the '--all-in-space'
-argument, followed by the space you want to empty.`,
+argument, followed by the space you want to empty.
+
+Instead of ID's, the notes can be matched by a selector.
+` + bulkHelp,
 	}
 	cleanCmd = &cobra.Command{
 		Use:   "clean",
 		Short: "Empty the .trash space",
+		Args:  cobra.NoArgs,
 		Run:   noteClean,
+		Long: `Permanently remove notes in the .trash space.
+
+By default all notes in the trash are removed. With --older-than, only notes
+that were moved to the trash longer ago than the given duration are removed.
+The duration is a number followed by a unit: d (days), w (weeks), h, m or s.
+For example: 'note clean --older-than 30d'.
+
+A default for --older-than can be set with the 'trash_retention' setting in the
+configuration file. Use '--older-than 0' to empty the whole trash regardless.`,
+	}
+	restoreCmd = &cobra.Command{
+		Use:   "restore id <id...>",
+		Short: "Restore note(s) from the .trash space",
+		Run:   noteRestore,
+		Long: `Move notes from the .trash space back to the space they were removed from.
+
+Use --all to restore every note in the trash. Notes that were removed before
+note kept track of their origin are restored to the default space.`,
 	}
 	showCmd = &cobra.Command{
 		Use:     "show id <id...>",
@@ -168,7 +202,105 @@ The order of the notes will be the same as the input order. If only one note is
 requested, the style and color options are mute (minimal style per default). This
 can be overridden with the --always-style (-a) option.
 
+The --full option prints every note in the full style, along with the ID's of
+the notes linking to it.
+
 For style and coloring options, see 'note list -h'.`,
+	}
+	linksCmd = &cobra.Command{
+		Use:   "links id",
+		Short: "List the links to and from a note",
+		Args:  cobra.ExactArgs(1),
+		Run:   noteLinks,
+		Long: `Print the notes linked from a note, followed by the notes linking to it.
+
+A note links to another note by its ID, written as [[123]] or note:123 anywhere
+in the content. Links are updated whenever a note is added, edited or imported.
+A link to a note that does not exist is shown as missing. Links from notes in
+the trash are not shown.
+
+Removing a note that other notes link to prints a warning.`,
+	}
+	dueCmd = &cobra.Command{
+		Use:   "due id [date...]",
+		Short: "Set or show the due date of a note",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   noteDue,
+		Long: `Set the due date of a note, or print it if no date is given. A reminder is set
+with --remind, and --clear removes both.
+
+Dates are given in local time, either as 2024-10-01 or 2024-10-01 15:04, or
+in words: today, tomorrow, friday, next friday, next week, oct 21, in 3 days
+or +2h. A day may be followed by a time: 10:00, at 9am, noon. A day without a
+time is at midnight, and a time without a day is its next occurrence.
+
+  note due 12 next friday 10:00 --remind "friday 9am"
+
+The due date and reminder can also be given when a note is added, with --due
+and --remind. Notes that are due are listed by 'note agenda', and reminders by
+'note remind'.`,
+	}
+	agendaCmd = &cobra.Command{
+		Use:   "agenda [space...]",
+		Short: "List notes by due date",
+		Run:   noteAgenda,
+		Long: `List the notes with a due date, grouped into overdue, today, this week and
+later. Overdue notes were due before today, and the week ends on Sunday.`,
+	}
+	remindCmd = &cobra.Command{
+		Use:   "remind [space...]",
+		Short: "List the reminders of notes",
+		Run:   noteRemind,
+		Long: `List the notes with a reminder, ordered by the time of the reminder.
+
+With --check only reminders that are due are printed, and the exit status is 1
+if there are any. This is meant for cron jobs and shell prompts, for example:
+
+  note remind --check || notify-send "Notes are due"
+
+Reminders are kept until they are removed, with 'note due id --clear' or by
+passing --dismiss, which removes the reminders that are due once printed.`,
+	}
+	attachCmd = &cobra.Command{
+		Use:   "attach id file <file...>",
+		Short: "Attach file(s) to a note",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   noteAttach,
+		Long: `Store files in the database, attached to a note.
+
+An attachment is known by its filename, which must be unique per note. Use
+--force to replace an attachment with the same name. The attachments of a note
+in an encrypted space are encrypted with it, and are removed with the note.
+
+Attachments are included when notes are exported as JSON, YAML or markdown, and
+are restored by importing them again.`,
+	}
+	attachmentsCmd = &cobra.Command{
+		Use:   "attachments id",
+		Short: "List the attachments of a note",
+		Args:  cobra.ExactArgs(1),
+		Run:   noteAttachments,
+	}
+	detachCmd = &cobra.Command{
+		Use:   "detach id <filename...>",
+		Short: "Remove attachment(s) from a note",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   noteDetach,
+		Long: `Remove attachments from a note by their filenames, or all of them with --all.
+
+Unless every named attachment exists, none are removed.`,
+	}
+	extractCmd = &cobra.Command{
+		Use:   "extract id dir <filename...>",
+		Short: "Write the attachments of a note to a directory",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   noteExtract,
+		Long: `Write the attachments of a note as files in a directory, which is created if it
+does not exist. Only the named attachments are written, if any are given.
+
+Unless --force is given, no files are written if any of them already exist. The
+attachments of an encrypted note are only readable by you, and so is the directory
+if it is created.`,
 	}
 	listCmd = &cobra.Command{
 		Use:     "list <space...>",
@@ -177,7 +309,9 @@ For style and coloring options, see 'note list -h'.`,
 		Run:     noteList,
 		Long: `All the notes content in the input spaces will be output.
 
-If no spaces are given, all your notes will be printed.
+If no spaces are given, all your notes will be printed. Spaces can be
+nested with '/', as in work/project. Use --recursive to also print the
+notes of all spaces nested below the given spaces.
 
 Sort options:
 The --sort, or -S option determines the main sort column. The pinned
@@ -229,24 +363,166 @@ Sort options can be found by running: 'note list -h'`,
 		Args:  cobra.MinimumNArgs(1),
 		Run:   noteEdit,
 	}
+	historyCmd = &cobra.Command{
+		Use:     "history id",
+		Aliases: []string{"hist"},
+		Short:   "List previous revisions of a note",
+		Args:    cobra.ExactArgs(1),
+		Run:     noteHistory,
+		Long: `Print the revisions of a note.
+
+Every time the content of a note is replaced, the previous content is stored as
+a revision. Revisions are numbered from 1 and upwards, with the current content
+of the note last. The timestamp of a revision is the time that content was last
+saved.
+
+The number of revisions kept per note is determined by the 'revisions' setting
+in the configuration file. A value of 0 means that all revisions are kept.`,
+	}
+	diffCmd = &cobra.Command{
+		Use:   "diff id [revision] [revision]",
+		Short: "Show changes between revisions of a note",
+		Args:  cobra.RangeArgs(1, 3),
+		Run:   noteDiff,
+		Long: `Print the difference between two revisions of a note, in unified format.
+
+Without revisions, the latest revision is compared to the current content.
+With one revision, that revision is compared to the current content. A revision
+is either a number, as listed by 'note history', or 'current'.`,
+	}
+	revertCmd = &cobra.Command{
+		Use:   "revert id revision",
+		Short: "Restore the content of a note to a previous revision",
+		Args:  cobra.ExactArgs(2),
+		Run:   noteRevert,
+		Long: `Replace the content of a note with the content of a previous revision.
+
+The content being replaced is itself kept as a new revision, so a revert can be
+undone just like any other edit.`,
+	}
 	pinCmd = &cobra.Command{
 		Use:   "pin id <id...>",
 		Short: "Pin note(s) to top",
-		Args:  cobra.MinimumNArgs(1),
 		Run:   notePin,
+		Long: `Pin notes by their ID's, or the notes matched by a selector.
+` + bulkHelp,
 	}
 	unpinCmd = &cobra.Command{
 		Use:   "unpin id <id...>",
 		Short: "Unpin note(s) from top",
-		Args:  cobra.MinimumNArgs(1),
 		Run:   noteUnpin,
+		Long: `Unpin notes by their ID's, or the notes matched by a selector.
+` + bulkHelp,
 	}
 	moveCmd = &cobra.Command{
 		Use:     "move space id <id...>",
 		Aliases: []string{"mv"},
 		Short:   "Move note to another space",
-		Args:    cobra.MinimumNArgs(2),
+		Args:    cobra.MinimumNArgs(1),
 		Run:     noteMove,
+		Long: `Move notes by their ID's, or the notes matched by a selector, to another space.
+` + bulkHelp,
+	}
+	queryCmd = &cobra.Command{
+		Use:     "query <expression...>",
+		Aliases: []string{"q"},
+		Short:   "Lists notes matching a query",
+		Args:    cobra.MinimumNArgs(1),
+		Run:     noteQuery,
+		Long: `List the notes matching a query expression, for example:
+
+  note query 'space:work tag:todo pinned:true created>2024-01-01 "exact phrase" -draft'
+
+Terms separated by space must all match, unless they are separated by OR.
+AND can be written out, but is not needed. A term is negated with '-' and
+terms can be grouped with parentheses:
+
+  note query 'tag:todo (space:work OR space:home) -tag:done'
+
+Words and quoted phrases match the content of notes, ignoring case. Fields
+are compared with a value using one of : = < <= > >=, where : and = both
+mean equality. Values containing space can be quoted, as in space:"my notes".
+
+Fields:
+* space    the space of the note (: only)
+* tag      a tag of the note (: only)
+* pinned   true or false (: only)
+* id       the ID of the note
+* length   the number of characters in the note
+* created  time of creation
+* updated  time of last update
+* due      due date of the note
+
+Times are given as a duration before now (30m, 12h, 7d, 2w), or as a local
+date and time (2024-10-01, 2024-10-01T15:04). Equality matches the whole
+day, so created:2024-10-01 lists the notes created that day.
+
+Notes in hidden spaces are only included with --all. The same expressions
+can be given with --where to list, table, export, find, move, pin and remove.
+Quote the expression, to keep the shell from interpreting it. An expression
+starting with '-' must follow '--', as in: note query -- -draft
+
+For sorting, limiting, style and coloring options, see 'note list -h'.`,
+	}
+	tagCmd = &cobra.Command{
+		Use:     "tag",
+		Aliases: []string{"tags"},
+		Short:   "Add, remove or list tags of notes",
+		Long: `Tags are labels that can be attached to notes, independently of their space.
+
+A note can have any number of tags. Like spaces, a tag can be any UTF-8 encoded
+string, except that it can't be empty or contain the comma character: ','.
+Where a tag argument is expected, multiple tags can be given as a comma separated
+list. For example: 'note tag add work,urgent 1 2'.
+
+Notes can be filtered by tags, using the --tag option of the list, table, find
+and export commands. If the option is repeated, notes must have all the tags.`,
+	}
+	tagAddCmd = &cobra.Command{
+		Use:   "add tag id <id...>",
+		Short: "Tag note(s)",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   noteTagAdd,
+	}
+	tagRemoveCmd = &cobra.Command{
+		Use:     "remove tag id <id...>",
+		Aliases: []string{"rm"},
+		Short:   "Remove tag from note(s)",
+		Args:    cobra.MinimumNArgs(2),
+		Run:     noteTagRemove,
+	}
+	tagListCmd = &cobra.Command{
+		Use:     "list <id...>",
+		Aliases: []string{"ls"},
+		Short:   "Lists tags in use",
+		Run:     noteTagList,
+		Long: `Print the tags in use.
+
+If no ID's are given, all tags will be listed. By specifying ID's of notes,
+only the tags of those notes will be shown.`,
+	}
+	tuiCmd = &cobra.Command{
+		Use:   "tui",
+		Short: "Browse and edit notes in a terminal user interface",
+		Args:  cobra.NoArgs,
+		Run:   noteTui,
+		Long: `Full-screen browser of your notes.
+
+The spaces are listed to the left and the notes of the selected space in the
+middle, with the highlighted note shown in the preview pane below. Hidden spaces
+are only listed with --all, except for the trash. Notes are sorted and paged by
+the same options as 'note list'. If no limit is given, each page holds 200 notes.
+
+Key bindings:
+  /         search notes incrementally (esc clears the search)
+  enter, e  open the note in your editor
+  p         pin or unpin the note
+  m         move the note to another space
+  d, del    move the note to the trash
+  r         restore the note from the trash
+  [, ]      previous and next page
+  tab       switch focus between spaces and notes
+  q         quit`,
 	}
 	idCmd = &cobra.Command{
 		Use:     "id <space...>",
@@ -263,12 +539,95 @@ will be shown.`,
 		Use:     "space <id...>",
 		Aliases: []string{"spaces", "spc"},
 		Short:   "Lists available spaces",
+		Args:    cobra.ArbitraryArgs,
 		Run:     noteSpace,
-		Long: `Print available spaces occupied by notes.
+		Long: `Print available spaces.
 
 If no ID's are given, all spaces not hidden will be printed.
 By specifying ID's of notes, only the spaces occupied by those notes
-will be shown.`,
+will be shown. With --long, the number of notes and the description
+of each space is shown.
+
+Spaces can be nested with '/', as in work/project/meetings. With --tree,
+the nested spaces are shown as a hierarchy, with the number of notes in
+each space and the spaces below it.
+
+A space is created when a note is added to it. It is removed when it
+no longer contains any notes, unless it has been described with
+'note space describe'.`,
+	}
+	spaceRenameCmd = &cobra.Command{
+		Use:     "rename <old> <new>",
+		Aliases: []string{"mv"},
+		Short:   "Rename a space",
+		Args:    cobra.ExactArgs(2),
+		Run:     noteSpaceRename,
+		Long: `Rename a space, moving all of its notes.
+
+The spaces nested below the space are renamed as well, so that
+'note space rename work/a archive/a' also renames work/a/b to archive/a/b.
+The new spaces must not exist, use 'note space merge' to combine spaces.`,
+	}
+	spaceMergeCmd = &cobra.Command{
+		Use:   "merge <src...> <dst>",
+		Short: "Move all notes of one or more spaces into another",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   noteSpaceMerge,
+		Long: `Move all notes of the source spaces into the destination space,
+which is created if needed. The source spaces are removed.
+
+The spaces nested below a source space are merged into the corresponding
+spaces below the destination.`,
+	}
+	spaceDescribeCmd = &cobra.Command{
+		Use:     "describe <space> [description...]",
+		Aliases: []string{"desc"},
+		Short:   "Show or change the description and settings of a space",
+		Args:    cobra.MinimumNArgs(1),
+		Run:     noteSpaceDescribe,
+		Long: `Show or change the description and settings of a space.
+
+Without a description or flags, the space is printed. A space that is
+described exists even if it does not contain any notes.
+
+The default sort and style are used by 'note list' and 'note table', when
+only that space is listed and --sort or --style is not given. Set them to
+an empty string to remove the default.`,
+	}
+	spaceEncryptCmd = &cobra.Command{
+		Use:   "encrypt <space>",
+		Short: "Encrypt the notes of a space with a passphrase",
+		Args:  cobra.ExactArgs(1),
+		Run:   noteSpaceEncrypt,
+		Long: `Encrypt the notes of a space, and the notes later added to it, with a key
+derived from a passphrase. The passphrase is read from the terminal, or as a
+line from stdin if it is not a terminal. It cannot be recovered if forgotten.
+
+Encrypted notes are hidden from all commands until the space is unlocked with
+'note unlock'. A note keeps its encryption when moved out of the space, notes
+moved into the space are encrypted. Spaces nested below it are not encrypted.
+
+The full-text search index does not see the content of encrypted notes, use
+'note find --scan' to search them. Content filters, such as --where, match the
+encrypted content. The space, timestamps and tags of a note are not encrypted.`,
+	}
+	unlockCmd = &cobra.Command{
+		Use:   "unlock <space...>",
+		Short: "Unlock encrypted spaces",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   noteUnlock,
+		Long: `Unlock encrypted spaces, so that their notes can be read and added to.
+
+The key derived from the passphrase is kept in a file only readable by you,
+in $XDG_RUNTIME_DIR (or a temporary directory), until it expires after
+--timeout or the space is locked with 'note lock'.`,
+	}
+	lockCmd = &cobra.Command{
+		Use:   "lock [space...]",
+		Short: "Lock encrypted spaces",
+		Run:   noteLock,
+		Long: `Forget the keys of unlocked spaces, so that their notes are hidden again.
+Without arguments, all spaces are locked.`,
 	}
 	findCmd = &cobra.Command{
 		Use:     "find pattern <pattern...>",
@@ -278,9 +637,17 @@ will be shown.`,
 		Run:     noteFind,
 		Long: `Find notes containing a (combined) pattern
 
-By default the pattern indicates a case sensitive string to be found.
-Use --insensitive to change to case insensitive match. If --regexp is specified
-the combined pattern is considered a regular expression.
+By default the full-text search index is used. Every word in the pattern must
+be present in the note, in any order and regardless of case. Results are sorted
+by relevance. Use --phrase to match the words as one exact phrase and --prefix
+to match words starting with the given terms. The --snippet option prints the
+ID of each note, followed by an excerpt with the matches highlighted.
+
+When --scan, --regexp or --posix is specified, or if the search index is not
+available, every note is matched against the pattern instead. In this mode the
+pattern indicates a case sensitive string to be found. Use --insensitive to
+change to case insensitive match. If --regexp is specified the combined pattern
+is considered a regular expression.
 
 If multiple patterns are input, they will be combined with spaces in between,
 regardless if the pattern is a regexp or not.
@@ -294,27 +661,129 @@ semantics is leftmost-longest. This option implies --regexp
 See: https://pkg.go.dev/regexp#CompilePOSIX for details.`,
 	}
 	importCmd = &cobra.Command{
-		Use:     "import file <file...>",
+		Use:     "import [file|dir...]",
 		Aliases: []string{"imp"},
-		Short:   "Import notes from JSON or YAML file",
-		Args:    cobra.MinimumNArgs(1),
+		Short:   "Import notes from JSON, YAML or CSV file",
 		Run:     noteImport,
 		Long: `Import many notes from a JSON or YAML file.
 
 The top level is a list and each item is an object containg the following fields:
 * content - string (required)
-* space - string (optional; if not specified)
-* created - date string (optional; if not specified, current time is chosen)
-* last_updated - date string (optional; if not specified, current time is chosen)
+* space - string (optional; if not specified, the default space is chosen)
+* created - date string (optional; if not specified, last_updated or the current time is chosen)
+* last_updated - date string (optional; if not specified, created or the current time is chosen)
 * pinned - bool (optional; default: false)
-
-Files will only be imported once (per run), no checks for duplicate notes are made.`,
+* tags - list of strings (optional)
+
+Files will only be imported once (per run). How the imported notes are added depends
+on --mode:
+* append - every note is created with a new id, no checks for duplicate notes are made
+* preserve-ids - notes keep their id, nothing is imported if any id is already taken
+* merge - notes are matched with existing notes by id, or by identical content. The note
+  with the newest last_updated is kept. Unmatched notes are created with their id, and
+  notes with the same content are only created once.
+
+Use --dry-run to see what would be created, updated or skipped.
+
+CSV and TSV files (--csv, --tsv, or a .csv or .tsv file) have one note per row. The
+header row names the columns: id, pinned, space, content, created, last_updated, tags,
+due and remind_at, where tags are separated by commas. Without a header row (--no-header)
+the columns are given by --columns. Only the content column is required, the other fields
+are chosen as for JSON when they are missing or empty.
+
+Notes are imported as they are read, so large files can be imported without reading them
+into memory. A JSON file may also contain one note object per line (--ndjson, .ndjson or
+.jsonl), and a YAML file may contain several documents, each one a note or a list of notes.
+
+With --from, the files or directories given are read with the importer of another program.
+The original timestamps are kept, when they are known:
+* nb - a notebook, or the nb directory with all notebooks. Every notebook is a space.
+* notes-cli - the notes-cli home directory. Categories are spaces and tags are kept.
+* obsidian - a vault. Folders are spaces, and tags are read from the note properties.
+* joplin - a directory exported as "RAW - Joplin Export Directory". Notebooks are spaces.
+* keep - a Google Takeout directory, with Google Keep notes. Labels are tags.
+Notes that are not in a notebook, folder or category are put into the default space.
+
+With --markdown, every .md file in a directory (and its subdirectories) is imported
+as a note. YAML front matter with the fields above, except content, is optional. Without
+it, the space is the directory of the file and the timestamps are the file modification time.`,
 	}
 	exportCmd = &cobra.Command{
-		Use:     "export",
+		Use:     "export [file]",
 		Aliases: []string{"exp"},
-		Short:   "Export notes to JSON or YAML file",
+		Short:   "Export notes to JSON, YAML or CSV file",
 		Run:     noteExport,
+		Long: `Export notes to a JSON or YAML file, or standard output.
+
+Notes are written as they are read from the database. With --ndjson (or a .ndjson or
+.jsonl file) each note is a JSON object on its own line, and YAML is written as one
+document per note.
+
+CSV and TSV (--csv, --tsv, or a .csv or .tsv file) are written with one note per row,
+after a header row. Pick the columns and their order with --columns, and the delimiter
+with --delimiter. Fields with line breaks, delimiters or quotes are quoted, or every
+field with --quote-all. With --escape-formulas, fields that start with =, +, -, @, a tab
+or a carriage return are prefixed with ', so that spreadsheets do not run them as
+formulas. The prefix is kept if the file is imported again.
+
+With --markdown, each note is written to its own file: <dir>/<space>/<id>.md. The file
+starts with YAML front matter (id, space, pinned, created, last_updated and tags),
+followed by the content of the note. The directory can be imported again with
+'note import --markdown <dir>'.
+
+With --html, a read-only static site is written to a directory: <dir>/index.html lists
+the spaces, <dir>/<space>/index.html the notes of a space (in the order given by --sort)
+and <dir>/<space>/<id>.html shows a note, with its content rendered as markdown. The
+pages can be searched, and need no files outside of the directory.`,
+	}
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve notes over a local HTTP/JSON API",
+		Args:  cobra.NoArgs,
+		Run:   noteServe,
+		Long: `Start an HTTP server, exposing your notes as JSON.
+
+By default the server listens on 127.0.0.1:7373. Use --listen to choose another
+address, or --socket to listen on a unix socket instead, which only you may connect
+to. Notes are represented the same way as in 'note export --json'.
+
+If a token is given, with --token or the 'serve_token' setting, every request
+must carry the header 'Authorization: Bearer <token>'. Without a token, requests
+must be addressed to localhost or an IP address.
+
+So that web pages cannot use the API, requests from another origin are rejected,
+and POST and PATCH requests must have a JSON body ('Content-Type: application/json').
+
+Endpoints:
+  GET    /notes          list notes (space, tag, all, sort, descending, limit, offset)
+  POST   /notes          add a note ({"content", "space", "pinned", "tags"})
+  GET    /notes/{id}     get a note
+  PATCH  /notes/{id}     edit a note ({"content", "space", "pinned"}, all optional)
+  DELETE /notes/{id}     move a note to the trash (permanent=true removes it)
+  POST   /notes/move     move notes ({"ids", "space"})
+  POST   /notes/pin      pin or unpin notes ({"ids", "pinned"})
+  POST   /notes/remove   remove notes ({"ids", "permanent"})
+  GET    /spaces         list spaces (all, descending)
+  GET    /ids            list ids (space, descending)`,
+	}
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Database maintenance",
+	}
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the database schema",
+		Args:  cobra.NoArgs,
+		Run:   noteMigrate,
+		Long: `Apply pending schema migrations to the database.
+
+The database keeps track of its schema version. When a new version of note
+requires changes to the schema, the pending migrations are applied in order,
+each one in its own transaction. This is done automatically whenever the
+database is opened, so running this command is usually not necessary.
+
+Use --status to print the current schema version and pending migrations, or
+--dry-run to see what would be applied, without modifying the database.`,
 	}
 	versionCmd = &cobra.Command{
 		Use:     "version",
@@ -334,6 +803,33 @@ Files will only be imported once (per run), no checks for duplicate notes are ma
 	// Add arguments
 	fileArg   string
 	pinnedArg bool
+	dueArg    string
+	remindArg string
+
+	// Due arguments
+	clearArg   bool
+	checkArg   bool
+	dismissArg bool
+
+	// Filter arguments
+	tagsArg         []string
+	recursiveArg    bool
+	sinceArg        string
+	untilArg        string
+	updatedSinceArg string
+	updatedUntilArg string
+	pinnedOnlyArg   bool
+	unpinnedOnlyArg bool
+	minIdArg        int
+	maxIdArg        int
+	minLengthArg    int
+	maxLengthArg    int
+	whereArg        string
+
+	// Selector arguments, of bulk commands
+	selectorFlagSet *pflag.FlagSet
+	findArg         string
+	selectSpacesArg []string
 
 	// Remove arguments
 	allInSpaceArg string
@@ -342,6 +838,7 @@ Files will only be imported once (per run), no checks for duplicate notes are ma
 
 	// Get arguments
 	alwaysStyleArg bool
+	fullArg        bool
 
 	// List arguments
 	allArg        bool // used in a lot of places
@@ -362,14 +859,49 @@ Files will only be imported once (per run), no checks for duplicate notes are ma
 	posixArg       bool
 	trashArg       bool
 	idArg          bool
+	scanArg        bool
+	prefixArg      bool
+	phraseArg      bool
+	snippetArg     bool
 
 	// Import/Export arguments
 	spacesArg     []string
 	jsonArg       bool
+	ndjsonArg     bool
 	yamlArg       bool
+	csvArg        bool
+	tsvArg        bool
+	markdownArg   string
+	htmlArg       string
+	titleArg      string
+	fromArg       string
+	importModeArg string
 	jsonIndentArg string
 	jsonPrefixArg string
 	yamlSpacesArg int
+	columnsArg    []string
+	delimiterArg  string
+	noHeaderArg   bool
+	quoteAllArg   bool
+	escapeArg     bool
+
+	// Space arguments
+	longArg         bool
+	treeArg         bool
+	hiddenArg       bool
+	defaultSortArg  string
+	defaultStyleArg string
+
+	// Serve arguments
+	listenArg string
+	socketArg string
+
+	// Unlock arguments
+	timeoutArg string
+
+	// Migrate arguments
+	statusArg bool
+	dryRunArg bool
 )
 
 func Execute() {
@@ -403,8 +935,24 @@ func init() {
 	selectFlagSet.IntVarP(&offsetArg, "offset", "o", 0, "begin list notes at some offset (only if limit > 0)")
 	selectFlagSet.BoolVarP(&descendingArg, "descending", "d", false, "descending order")
 
+	filterFlagSet := pflag.NewFlagSet("filter", pflag.ExitOnError)
+	filterFlagSet.StringSliceVar(&tagsArg, "tag", []string{}, "only notes with tag (repeat to require more tags)")
+	filterFlagSet.BoolVarP(&recursiveArg, "recursive", "R", false, "include notes from spaces nested below the given spaces")
+	filterFlagSet.StringVar(&sinceArg, "since", "", "only notes created since a duration ago or a date (e.g. 7d or 2024-10-01)")
+	filterFlagSet.StringVar(&untilArg, "until", "", "only notes created before a duration ago or a date")
+	filterFlagSet.StringVar(&updatedSinceArg, "updated-since", "", "only notes updated since a duration ago or a date")
+	filterFlagSet.StringVar(&updatedUntilArg, "updated-until", "", "only notes updated before a duration ago or a date")
+	filterFlagSet.BoolVar(&pinnedOnlyArg, "pinned", false, "only pinned notes")
+	filterFlagSet.BoolVar(&unpinnedOnlyArg, "unpinned", false, "only notes that are not pinned")
+	filterFlagSet.IntVar(&minIdArg, "min-id", 0, "only notes with an ID of at least this")
+	filterFlagSet.IntVar(&maxIdArg, "max-id", 0, "only notes with an ID of at most this")
+	filterFlagSet.IntVar(&minLengthArg, "min-length", 0, "only notes with at least this many characters")
+	filterFlagSet.IntVar(&maxLengthArg, "max-length", 0, "only notes with at most this many characters")
+	filterFlagSet.StringVarP(&whereArg, "where", "w", "", "only notes matching a query expression (see 'note query -h')")
+
 	rootFlags := rootCmd.Flags()
 	rootFlags.AddFlagSet(selectFlagSet)
+	rootFlags.AddFlagSet(filterFlagSet)
 
 	initFlags := initCmd.Flags()
 	initFlags.BoolVar(&dbOnlyArg, "db-only", false, "only initialize a database file")
@@ -414,14 +962,52 @@ func init() {
 	_ = addFlags.StringP("space", "s", DefaultSpace, "partitions the note into a space")
 	addFlags.StringVarP(&fileArg, "file", "f", "", "the note is read from file")
 	addFlags.BoolVarP(&pinnedArg, "pinned", "p", false, "pin your note to the top")
+	addFlags.StringSliceVarP(&tagsArg, "tag", "t", []string{}, "tag your note (comma separated or repeated)")
+	addFlags.StringVar(&dueArg, "due", "", "due date of the note, such as \"next friday 10:00\"")
+	addFlags.StringVar(&remindArg, "remind", "", "time of a reminder, such as \"tomorrow 9am\"")
+
+	dueFlags := dueCmd.Flags()
+	dueFlags.StringVar(&remindArg, "remind", "", "time of a reminder, such as \"tomorrow 9am\"")
+	dueFlags.BoolVar(&clearArg, "clear", false, "remove the due date and reminder")
+
+	agendaFlags := agendaCmd.Flags()
+	agendaFlags.BoolVarP(&allArg, "all", "a", false, "include notes from hidden spaces")
+	agendaFlags.BoolVarP(&recursiveArg, "recursive", "r", false, "include the spaces nested below the given spaces")
+	agendaFlags.UintVarP(&previewArg, "preview", "p", 5, "preview word count to display")
+
+	remindFlags := remindCmd.Flags()
+	remindFlags.BoolVarP(&allArg, "all", "a", false, "include notes from hidden spaces")
+	remindFlags.BoolVarP(&recursiveArg, "recursive", "r", false, "include the spaces nested below the given spaces")
+	remindFlags.UintVarP(&previewArg, "preview", "p", 5, "preview word count to display")
+	remindFlags.BoolVar(&checkArg, "check", false, "print only due reminders, and exit with status 1 if there are any")
+	remindFlags.BoolVar(&dismissArg, "dismiss", false, "remove the reminders that are due, after printing them")
+
+	// Bulk commands select notes either by ID or with the selector flags
+	selectorFlagSet = pflag.NewFlagSet("selector", pflag.ExitOnError)
+	selectorFlagSet.AddFlagSet(filterFlagSet)
+	selectorFlagSet.StringVar(&findArg, "find", "", "select notes matching a search pattern, instead of ID's")
+	selectorFlagSet.StringSliceVar(&selectSpacesArg, "space", []string{}, "select notes in space, instead of ID's (repeat for more spaces)")
+
+	bulkFlagSet := pflag.NewFlagSet("bulk", pflag.ExitOnError)
+	bulkFlagSet.BoolVar(&dryRunArg, "dry-run", false, "show the notes that would be changed")
+	bulkFlagSet.UintVarP(&previewArg, "preview", "p", 5, "preview word count to display")
+	bulkFlagSet.BoolVar(&noConfirmArg, "no-confirm", false, "skip confirmation dialog")
+
+	for _, bulkCmd := range []*cobra.Command{pinCmd, unpinCmd, moveCmd, removeCmd} {
+		bulkCmd.Flags().AddFlagSet(selectorFlagSet)
+		bulkCmd.Flags().AddFlagSet(bulkFlagSet)
+	}
 
 	removeFlags := removeCmd.Flags()
 	removeFlags.StringVar(&allInSpaceArg, "all-in-space", "", "remove all notes in this space")
-	removeFlags.BoolVar(&noConfirmArg, "no-confirm", false, "skip confirmation dialog")
 	removeFlags.BoolVar(&permanentArg, "permanent", false, "note is completely removed from the db")
 
 	cleanFlags := cleanCmd.Flags()
 	cleanFlags.BoolVar(&noConfirmArg, "no-confirm", false, "skip confirmation dialog")
+	_ = cleanFlags.String("older-than", "", "only remove notes trashed longer ago than this (e.g. 30d)")
+
+	restoreFlags := restoreCmd.Flags()
+	restoreFlags.BoolVarP(&allArg, "all", "a", false, "restore all notes in the trash")
 
 	printFlagSet := pflag.NewFlagSet("print", pflag.ExitOnError)
 	_ = printFlagSet.String("style", string(LightStyle), "output style (raw, light, full)")
@@ -429,18 +1015,46 @@ func init() {
 
 	listFlags := listCmd.Flags()
 	listFlags.AddFlagSet(selectFlagSet)
+	listFlags.AddFlagSet(filterFlagSet)
 	listFlags.AddFlagSet(printFlagSet)
 
+	queryFlags := queryCmd.Flags()
+	queryFlags.AddFlagSet(selectFlagSet)
+	queryFlags.AddFlagSet(filterFlagSet)
+	queryFlags.AddFlagSet(printFlagSet)
+
 	tableFlags := tableCmd.Flags()
 	tableFlags.AddFlagSet(selectFlagSet)
+	tableFlags.AddFlagSet(filterFlagSet)
 	tableFlags.UintVarP(&previewArg, "preview", "p", 5, "preview word count to display in table")
 
+	tuiFlags := tuiCmd.Flags()
+	tuiFlags.AddFlagSet(selectFlagSet)
+	tuiFlags.AddFlagSet(filterFlagSet)
+
 	getFlags := showCmd.Flags()
 	getFlags.AddFlagSet(printFlagSet)
 	getFlags.BoolVarP(&alwaysStyleArg, "always-style", "a", false, "always decorate with given style options")
+	getFlags.BoolVar(&fullArg, "full", false, "full style with backlinks, even for a single note")
+
+	attachFlags := attachCmd.Flags()
+	attachFlags.BoolVarP(&forceArg, "force", "f", false, "replace attachments with the same filename")
+
+	attachmentsFlags := attachmentsCmd.Flags()
+	attachmentsFlags.BoolVarP(&listArg, "list", "l", false, "print only the filenames")
+
+	detachFlags := detachCmd.Flags()
+	detachFlags.BoolVarP(&allArg, "all", "a", false, "remove every attachment of the note")
+
+	extractFlags := extractCmd.Flags()
+	extractFlags.BoolVarP(&forceArg, "force", "f", false, "overwrite existing files")
+
+	linksFlags := linksCmd.Flags()
+	linksFlags.UintVarP(&previewArg, "preview", "p", 5, "preview word count to display")
 
 	findFlags := findCmd.Flags()
 	findFlags.AddFlagSet(printFlagSet)
+	findFlags.AddFlagSet(filterFlagSet)
 	findFlags.BoolVarP(&allArg, "all", "a", false, "show results from hidden spaces")
 	findFlags.BoolVarP(&trashArg, "trash", "t", false, "show results from trash")
 	findFlags.BoolVar(&idArg, "id", false, "print only IDs of matched notes")
@@ -448,6 +1062,10 @@ func init() {
 	findFlags.BoolVarP(&insensitiveArg, "insensitive", "i", false, "case insensitive match")
 	findFlags.BoolVarP(&regexpArg, "regexp", "r", false, "pattern is considered regular expressions")
 	findFlags.BoolVarP(&posixArg, "posix", "p", false, "pattern is posix egrep regular expressions (implies --regexp)")
+	findFlags.BoolVar(&scanArg, "scan", false, "match every note instead of using the search index")
+	findFlags.BoolVar(&prefixArg, "prefix", false, "match words starting with the pattern terms")
+	findFlags.BoolVar(&phraseArg, "phrase", false, "match the pattern as an exact phrase")
+	findFlags.BoolVar(&snippetArg, "snippet", false, "print an excerpt of each match")
 
 	idFlags := idCmd.Flags()
 	idFlags.BoolVarP(&listArg, "list", "l", false, "separate each ID with a newline")
@@ -457,40 +1075,99 @@ func init() {
 	spaceFlags.BoolVarP(&allArg, "all", "a", false, "list hidden spaces")
 	spaceFlags.BoolVarP(&listArg, "list", "l", false, "separate each space with a newline")
 	spaceFlags.BoolVarP(&descendingArg, "descending", "d", false, "descending order")
+	spaceFlags.BoolVarP(&longArg, "long", "L", false, "show the number of notes and description of each space")
+	spaceFlags.BoolVar(&treeArg, "tree", false, "show nested spaces as a tree, with the number of notes")
+
+	spaceDescribeFlags := spaceDescribeCmd.Flags()
+	spaceDescribeFlags.BoolVar(&hiddenArg, "hidden", false, "hide the space, unless --all is given")
+	spaceDescribeFlags.StringVar(&defaultSortArg, "default-sort", "", "sort order when listing the space")
+	spaceDescribeFlags.StringVar(&defaultStyleArg, "default-style", "", "style when listing the space")
+
+	spaceCmd.AddCommand(spaceRenameCmd, spaceMergeCmd, spaceDescribeCmd, spaceEncryptCmd)
+
+	unlockFlags := unlockCmd.Flags()
+	unlockFlags.StringVar(&timeoutArg, "timeout", "15m", "lock the spaces again after this duration, for example 90s, 15m or 8h")
+
+	historyFlags := historyCmd.Flags()
+	historyFlags.UintVarP(&previewArg, "preview", "p", 5, "preview word count to display")
+
+	tagListFlags := tagListCmd.Flags()
+	tagListFlags.BoolVarP(&listArg, "list", "l", false, "separate each tag with a newline")
+	tagListFlags.BoolVarP(&descendingArg, "descending", "d", false, "descending order")
+
+	tagCmd.AddCommand(tagAddCmd, tagRemoveCmd, tagListCmd)
 
 	inoutFlagSet := pflag.NewFlagSet("inout", pflag.ExitOnError)
 	inoutFlagSet.BoolVarP(&jsonArg, "json", "j", false, "JSON format")
+	inoutFlagSet.BoolVar(&ndjsonArg, "ndjson", false, "newline delimited JSON format, one note per line")
 	inoutFlagSet.BoolVarP(&yamlArg, "yaml", "y", false, "YAML format")
+	inoutFlagSet.BoolVar(&csvArg, "csv", false, "CSV format, one note per row")
+	inoutFlagSet.BoolVar(&tsvArg, "tsv", false, "TSV format, one note per row")
+	inoutFlagSet.StringVarP(&markdownArg, "markdown", "m", "", "markdown directory, with one file per note")
+
+	csvFlagSet := pflag.NewFlagSet("csv", pflag.ExitOnError)
+	csvFlagSet.StringSliceVar(&columnsArg, "columns", note.CSVColumns, "CSV/TSV columns, in order")
+	csvFlagSet.StringVar(&delimiterArg, "delimiter", "", "CSV/TSV field delimiter (default ',' or tab)")
+	csvFlagSet.BoolVar(&noHeaderArg, "no-header", false, "CSV/TSV without a header row")
 
 	importFlags := importCmd.Flags()
 	importFlags.AddFlagSet(inoutFlagSet)
-	importForceUsage := "all input files will use the format specified by either --json or --yaml"
+	importFlags.AddFlagSet(csvFlagSet)
+	importForceUsage := "all input files will use the format specified by either --json, --ndjson, --yaml, --csv or --tsv"
 	importFlags.BoolVarP(&listArg, "list", "l", false, "separate each id imported with a newline")
 	importFlags.BoolVar(&forceArg, "force-format", false, importForceUsage)
+	importFlags.StringVar(&importModeArg, "mode", "append", "import strategy, one of: append, preserve-ids or merge")
+	importFlags.StringVar(&fromArg, "from", "", "import from another program, one of: "+strings.Join(note.Importers(), ", "))
+	importFlags.BoolVar(&dryRunArg, "dry-run", false, "show what would be created, updated or skipped")
+	importFlags.UintVarP(&previewArg, "preview", "p", 5, "preview word count to display with --dry-run")
 
 	exportFlags := exportCmd.Flags()
 	exportFlags.AddFlagSet(selectFlagSet)
+	exportFlags.AddFlagSet(filterFlagSet)
 	exportFlags.AddFlagSet(inoutFlagSet)
+	exportFlags.AddFlagSet(csvFlagSet)
+	exportFlags.BoolVar(&quoteAllArg, "quote-all", false, "quote every CSV/TSV field")
+	exportFlags.BoolVar(&escapeArg, "escape-formulas", false, "prefix CSV/TSV fields that start with =, +, -, @, tab or carriage return with '")
+	exportFlags.StringVar(&htmlArg, "html", "", "static HTML site directory, with a page per space and note")
+	exportFlags.StringVar(&titleArg, "title", "Notes", "title of the HTML site")
 	exportFlags.StringSliceVarP(&spacesArg, "spaces", "s", []string{}, "limit export to notes from space(s)")
 	exportFlags.BoolVar(&forceArg, "force", false, "determines if existing file will be overwritten")
 	exportFlags.StringVarP(&jsonIndentArg, "indent", "i", "", "JSON indentation encoding option")
 	exportFlags.StringVarP(&jsonPrefixArg, "prefix", "p", "", "JSON prefix encoding option")
 	exportFlags.IntVarP(&yamlSpacesArg, "yaml-spaces", "P", 4, "YAML spaces encoding option")
 
+	serveFlags := serveCmd.Flags()
+	serveFlags.StringVar(&listenArg, "listen", "127.0.0.1:7373", "address to listen on")
+	serveFlags.StringVar(&socketArg, "socket", "", "listen on this unix socket instead of an address")
+	_ = serveFlags.String("token", "", "require this bearer token in requests")
+
+	migrateFlags := migrateCmd.Flags()
+	migrateFlags.BoolVar(&statusArg, "status", false, "print schema version and pending migrations")
+	migrateFlags.BoolVar(&dryRunArg, "dry-run", false, "show migrations that would be applied")
+
+	dbCmd.AddCommand(migrateCmd)
+
 	// These variables can exist in the config file or as environment variables as well
 	viper.BindPFlag(ViperDb, globalFlags.Lookup("db"))
 	viper.BindPFlag(ViperSpace, addFlags.Lookup("space"))
 	viper.BindPFlag(ViperStyle, printFlagSet.Lookup("style"))
 	viper.BindPFlag(ViperColor, printFlagSet.Lookup("color"))
+	viper.BindPFlag(ViperTrashRetention, cleanFlags.Lookup("older-than"))
+	viper.BindPFlag(ViperServeToken, serveFlags.Lookup("token"))
 
 	rootCmd.AddCommand(
 		initCmd,
 		versionCmd,
-		addCmd, removeCmd, cleanCmd,
+		addCmd, removeCmd, cleanCmd, restoreCmd,
 		showCmd, findCmd, listCmd,
-		tableCmd, idCmd, spaceCmd,
-		editCmd, pinCmd, unpinCmd, moveCmd,
+		tableCmd, idCmd, spaceCmd, tagCmd, tuiCmd,
+		unlockCmd, lockCmd,
+		editCmd, pinCmd, unpinCmd, moveCmd, queryCmd,
+		historyCmd, diffCmd, revertCmd, linksCmd,
+		attachCmd, attachmentsCmd, detachCmd, extractCmd,
+		dueCmd, agendaCmd, remindCmd,
 		importCmd, exportCmd,
+		serveCmd, dbCmd,
 	)
 }
 
@@ -0,0 +1,132 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bdazl/note/db"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// selectorChanged reports if notes are selected with any of the selector flags
+func selectorChanged(cmd *cobra.Command) bool {
+	changed := false
+	selectorFlagSet.VisitAll(func(f *pflag.Flag) {
+		changed = changed || cmd.Flags().Changed(f.Name)
+	})
+	return changed
+}
+
+// selectorNotes are the notes matching --find, --space and the filter flags.
+// Notes in hidden spaces are only selected if their space is given.
+func selectorNotes(ctx context.Context, d *db.DB) (db.Notes, error) {
+	filterOpts, err := filterOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	if findArg == "" {
+		return d.SelectNotes(ctx, selectSpacesArg, false, nil, nil, filterOpts)
+	}
+
+	results, err := d.SearchNotes(ctx, findArg, &db.SearchOpts{Spaces: selectSpacesArg, Filter: filterOpts})
+	if errors.Is(err, db.ErrNoSearchIndex) {
+		// Without the search index, the pattern is matched as text
+		var query db.Expr = &db.TextExpr{Text: findArg}
+		if filterOpts.Query != nil {
+			query = &db.AndExpr{Exprs: []db.Expr{filterOpts.Query, query}}
+		}
+		filterOpts.Query = query
+		return d.SelectNotes(ctx, selectSpacesArg, false, nil, nil, filterOpts)
+	} else if err != nil {
+		return nil, err
+	}
+	return searchResultNotes(results), nil
+}
+
+// bulkIds are the IDs of the notes a command acts on, either given as arguments
+// or by the selector flags. The notes are only returned, if they are needed for
+// a dry run or were selected.
+func bulkIds(cmd *cobra.Command, d *db.DB, args []string) ([]int, db.Notes, error) {
+	selector := selectorChanged(cmd)
+	if selector && len(args) > 0 {
+		return nil, nil, fmt.Errorf("you must choose either individual notes or a selector")
+	} else if !selector && len(args) == 0 {
+		return nil, nil, fmt.Errorf("requires at least one id, or a selector such as --find, --space or --where")
+	}
+
+	if selector {
+		notes, err := selectorNotes(cmd.Context(), d)
+		if err != nil {
+			return nil, nil, err
+		}
+		return notes.GetIDs(), notes, nil
+	}
+
+	ids, err := parseIds(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids = removeDuplicates(ids)
+
+	if !dryRunArg {
+		return ids, nil, nil
+	}
+	notes, err := d.GetNotes(cmd.Context(), ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ids, notes, nil
+}
+
+// confirmBulk shows the notes and exits with --dry-run. Otherwise, if the notes
+// were selected, the user must confirm the action unless --no-confirm is given.
+// The action describes the change, as in "pin 2 note(s)".
+func confirmBulk(cmd *cobra.Command, notes db.Notes, action string) {
+	if len(notes) == 0 && selectorChanged(cmd) {
+		fmt.Println("No notes selected")
+		os.Exit(0)
+	}
+
+	if dryRunArg {
+		printTable(notes)
+		fmt.Printf("Would %v\n", action)
+		os.Exit(0)
+	}
+
+	if !selectorChanged(cmd) || noConfirmArg {
+		return
+	}
+
+	printTable(notes)
+	fmt.Printf("You are about to %v.\n", action)
+	fmt.Printf("Write 'yes' to confirm: ")
+	response := readUserInput()
+	if response != "yes" {
+		os.Exit(2)
+	}
+}
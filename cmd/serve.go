@@ -0,0 +1,538 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveMaxBodySize is the largest request body that is read
+const serveMaxBodySize = 16 << 20
+
+type server struct {
+	store note.Store
+	token string
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type notePatch struct {
+	Content *string `json:"content"`
+	Space   *string `json:"space"`
+	Pinned  *bool   `json:"pinned"`
+}
+
+type moveRequest struct {
+	IDs   []int  `json:"ids"`
+	Space string `json:"space"`
+}
+
+type pinRequest struct {
+	IDs    []int `json:"ids"`
+	Pinned bool  `json:"pinned"`
+}
+
+type removeRequest struct {
+	IDs       []int `json:"ids"`
+	Permanent bool  `json:"permanent"`
+}
+
+func noteServe(cmd *cobra.Command, args []string) {
+	listener, err := serveListener()
+	if err != nil {
+		quitError("listen", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	srv := &http.Server{
+		Handler:           newServer(d, viper.GetString(ViperServeToken)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving notes on %v\n", listener.Addr())
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		quitError("serve", err)
+	}
+}
+
+func serveListener() (net.Listener, error) {
+	if socketArg == "" {
+		return net.Listen("tcp", listenArg)
+	}
+
+	// A socket left behind by a previous run would make listen fail
+	if stat, err := os.Stat(socketArg); err == nil && stat.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(socketArg); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", socketArg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the user may connect to the socket
+	if err := os.Chmod(socketArg, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func newServer(store note.Store, token string) http.Handler {
+	s := &server{store: store, token: token}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /notes", s.listNotes)
+	mux.HandleFunc("POST /notes", s.addNote)
+	mux.HandleFunc("GET /notes/{id}", s.getNote)
+	mux.HandleFunc("PATCH /notes/{id}", s.editNote)
+	mux.HandleFunc("DELETE /notes/{id}", s.removeNote)
+	mux.HandleFunc("POST /notes/move", s.moveNotes)
+	mux.HandleFunc("POST /notes/pin", s.pinNotes)
+	mux.HandleFunc("POST /notes/remove", s.removeNotes)
+	mux.HandleFunc("GET /spaces", s.listSpaces)
+	mux.HandleFunc("GET /ids", s.listIds)
+
+	return s.guard(s.authorize(mux))
+}
+
+// guard rejects the requests that a web page could make: those from another origin, those to
+// a host name that may resolve to this server (DNS rebinding, unless a token is required),
+// and requests with a body that is not JSON, since such a request skips the CORS preflight.
+// The size of request bodies is limited to serveMaxBodySize.
+func (s *server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			parsed, err := url.Parse(origin)
+			if err != nil || parsed.Host != r.Host {
+				writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin requests are not allowed"))
+				return
+			}
+		}
+		if s.token == "" && !localHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host not allowed: %v", r.Host))
+			return
+		}
+
+		if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json"))
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, serveMaxBodySize)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localHost is true for localhost and IP addresses, which a web page cannot rebind
+func localHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	return strings.EqualFold(host, "localhost") || net.ParseIP(strings.Trim(host, "[]")) != nil
+}
+
+// authorize requires the bearer token, if one is configured
+func (s *server) authorize(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(given, expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="note"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) listNotes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	sortOpts, pageOpts, err := queryListOpts(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filterOpts := &db.FilterOpts{
+		Tags:      query["tag"],
+		Recursive: queryBool(query.Get("recursive")),
+	}
+	notes, err := s.store.SelectNotes(r.Context(), query["space"], queryBool(query.Get("all")), sortOpts, pageOpts, filterOpts)
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, note.FromNotes(notes))
+}
+
+func (s *server) getNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+
+	s.writeNote(r.Context(), w, http.StatusOK, id)
+}
+
+func (s *server) addNote(w http.ResponseWriter, r *http.Request) {
+	var in note.FileNote
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	if in.Space == "" {
+		in.Space = viper.GetString(ViperSpace)
+	}
+	if err := checkFileNote(in); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts := note.AddOpts{Space: in.Space, Pinned: in.Pinned, Tags: in.Tags}
+	id, err := note.Add(r.Context(), s.store, in.Content, opts)
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	s.writeNote(r.Context(), w, http.StatusCreated, id)
+}
+
+func (s *server) editNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+
+	var patch notePatch
+	if !decodeJSON(w, r, &patch) {
+		return
+	}
+
+	if patch.Content != nil && strings.TrimSpace(*patch.Content) == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("content cannot be empty"))
+		return
+	}
+	if patch.Space != nil {
+		if err := note.CheckSpace(*patch.Space); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// Either every change of the patch is made, or none
+	err = s.store.WithTx(r.Context(), func(tx *note.Tx) error {
+		current, err := tx.GetNote(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		if patch.Content != nil && *patch.Content != current.Content {
+			if err := note.Edit(r.Context(), tx, id, *patch.Content, editOpts()); err != nil {
+				return err
+			}
+		}
+		if patch.Space != nil && *patch.Space != current.Space {
+			if err := note.Move(r.Context(), tx, []int{id}, *patch.Space); err != nil {
+				return err
+			}
+		}
+		if patch.Pinned != nil && *patch.Pinned != current.Pinned {
+			if err := tx.PinNotes(r.Context(), []int{id}, *patch.Pinned); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	s.writeNote(r.Context(), w, http.StatusOK, id)
+}
+
+func (s *server) removeNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+
+	s.remove(r.Context(), w, []int{id}, queryBool(r.URL.Query().Get("permanent")))
+}
+
+func (s *server) removeNotes(w http.ResponseWriter, r *http.Request) {
+	var req removeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := checkRequestIDs(req.IDs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.remove(r.Context(), w, req.IDs, req.Permanent)
+}
+
+func (s *server) remove(ctx context.Context, w http.ResponseWriter, ids []int, permanent bool) {
+	if err := note.Remove(ctx, s.store, ids, note.RemoveOpts{Permanent: permanent}); err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) moveNotes(w http.ResponseWriter, r *http.Request) {
+	var req moveRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := checkRequestIDs(req.IDs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Space == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("space is required"))
+		return
+	}
+	if err := note.CheckSpace(req.Space); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := note.Move(r.Context(), s.store, req.IDs, req.Space); err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) pinNotes(w http.ResponseWriter, r *http.Request) {
+	var req pinRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := checkRequestIDs(req.IDs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.store.PinNotes(r.Context(), removeDuplicates(req.IDs), req.Pinned); err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) listSpaces(w http.ResponseWriter, r *http.Request) {
+	sortOpts := &db.SortOpts{
+		Ascending:  !queryBool(r.URL.Query().Get("descending")),
+		SortColumn: db.SpaceColumn,
+	}
+
+	spaces, err := s.store.SelectSpaces(r.Context(), queryBool(r.URL.Query().Get("all")), sortOpts)
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, spaces)
+}
+
+func (s *server) listIds(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	ids, err := s.store.GetIDs(r.Context(), query["space"], !queryBool(query.Get("descending")))
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ids)
+}
+
+func (s *server) writeNote(ctx context.Context, w http.ResponseWriter, status int, id int) {
+	current, err := s.store.GetNote(ctx, id)
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+
+	writeJSON(w, status, note.FromNote(*current))
+}
+
+// queryListOpts parses the sort and page options of a request, see listOpts
+func queryListOpts(query map[string][]string) (*db.SortOpts, *db.PageOpts, error) {
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	sortBy := get("sort")
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	sortColumn, err := mapNoteSortColumn(sortBy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pageOpts := &db.PageOpts{}
+	if limit := get("limit"); limit != "" {
+		if pageOpts.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, nil, fmt.Errorf("invalid limit: %w", err)
+		}
+	}
+	if offset := get("offset"); offset != "" {
+		if pageOpts.Offset, err = strconv.Atoi(offset); err != nil {
+			return nil, nil, fmt.Errorf("invalid offset: %w", err)
+		}
+	}
+	if err = pageOpts.Check(); err != nil {
+		return nil, nil, err
+	}
+
+	sortOpts := &db.SortOpts{
+		Ascending:  !queryBool(get("descending")),
+		SortColumn: sortColumn,
+	}
+	return sortOpts, pageOpts, nil
+}
+
+func queryBool(value string) bool {
+	parsed, err := strconv.ParseBool(value)
+	return err == nil && parsed
+}
+
+// checkFileNote validates a note given by a user
+func checkFileNote(in note.FileNote) error {
+	if strings.TrimSpace(in.Content) == "" {
+		return fmt.Errorf("content cannot be empty")
+	}
+	return in.Check()
+}
+
+// checkRequestIDs validates the note IDs of a bulk request
+func checkRequestIDs(ids []int) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("ids are required")
+	}
+	for _, id := range ids {
+		if id <= 0 {
+			return fmt.Errorf("invalid id: %v", id)
+		}
+	}
+	return nil
+}
+
+// decodeJSON decodes the body of a request into v, or writes the error response
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		return true
+	}
+	return false
+}
+
+func writeDbError(w http.ResponseWriter, err error) {
+	var partial *note.PartialError
+	switch {
+	case errors.Is(err, note.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.As(err, &partial):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, note.ErrLocked):
+		writeError(w, http.StatusForbidden, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
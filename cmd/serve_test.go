@@ -0,0 +1,379 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
+)
+
+const testToken = "secret"
+
+// newTestServer serves a new database, which requires testToken if auth is set
+func newTestServer(t *testing.T, auth bool) *httptest.Server {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "note.db")
+	if _, err := db.CreateDb(path); err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	d, err := note.Open(path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	token := ""
+	if auth {
+		token = testToken
+	}
+	srv := httptest.NewServer(newServer(d, token))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// request sends body as JSON, unless it is nil, and returns the status and response body
+func request(t *testing.T, srv *httptest.Server, auth, method, path string, body any) (int, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%v %v: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return resp.StatusCode, data
+}
+
+// expect sends a request, which must respond with status, and decodes the response into out
+func expect(t *testing.T, srv *httptest.Server, method, path string, body any, status int, out any) {
+	t.Helper()
+
+	got, data := request(t, srv, "", method, path, body)
+	if got != status {
+		t.Fatalf("%v %v: status %v, want %v: %s", method, path, got, status, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%v %v: decode %s: %v", method, path, data, err)
+		}
+	}
+}
+
+func addTestNote(t *testing.T, srv *httptest.Server, space, content string) note.FileNote {
+	t.Helper()
+
+	var created note.FileNote
+	expect(t, srv, http.MethodPost, "/notes", note.FileNote{Space: space, Content: content}, http.StatusCreated, &created)
+	if created.ID == 0 || created.Space != space || created.Content != content {
+		t.Fatalf("add: unexpected note %+v", created)
+	}
+	return created
+}
+
+func TestServeAuth(t *testing.T) {
+	srv := newTestServer(t, true)
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"token without scheme", testToken, http.StatusUnauthorized},
+		{"right token", "Bearer " + testToken, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, data := request(t, srv, test.auth, http.MethodGet, "/notes", nil)
+			if status != test.status {
+				t.Errorf("status %v, want %v: %s", status, test.status, data)
+			}
+		})
+	}
+}
+
+func TestServeGetAndList(t *testing.T) {
+	srv := newTestServer(t, false)
+	first := addTestNote(t, srv, "work", "first note")
+	second := addTestNote(t, srv, "home", "second note")
+
+	var got note.FileNote
+	expect(t, srv, http.MethodGet, "/notes/"+strconv.Itoa(first.ID), nil, http.StatusOK, &got)
+	if got.ID != first.ID || got.Content != first.Content {
+		t.Errorf("get: %+v, want %+v", got, first)
+	}
+	expect(t, srv, http.MethodGet, "/notes/999", nil, http.StatusNotFound, nil)
+	expect(t, srv, http.MethodGet, "/notes/abc", nil, http.StatusBadRequest, nil)
+
+	var all []note.FileNote
+	expect(t, srv, http.MethodGet, "/notes", nil, http.StatusOK, &all)
+	if len(all) != 2 {
+		t.Errorf("list: %v notes, want 2", len(all))
+	}
+
+	var work []note.FileNote
+	expect(t, srv, http.MethodGet, "/notes?space=work", nil, http.StatusOK, &work)
+	if len(work) != 1 || work[0].ID != first.ID {
+		t.Errorf("list space: %+v, want only note %v", work, first.ID)
+	}
+
+	var page []note.FileNote
+	expect(t, srv, http.MethodGet, "/notes?sort=id&descending=true&limit=1", nil, http.StatusOK, &page)
+	if len(page) != 1 || page[0].ID != second.ID {
+		t.Errorf("list page: %+v, want only note %v", page, second.ID)
+	}
+	expect(t, srv, http.MethodGet, "/notes?limit=x", nil, http.StatusBadRequest, nil)
+
+	var ids []int
+	expect(t, srv, http.MethodGet, "/ids", nil, http.StatusOK, &ids)
+	if !slices.Equal(ids, []int{first.ID, second.ID}) {
+		t.Errorf("ids: %v, want %v", ids, []int{first.ID, second.ID})
+	}
+
+	var spaces []string
+	expect(t, srv, http.MethodGet, "/spaces", nil, http.StatusOK, &spaces)
+	if !slices.Equal(spaces, []string{"home", "work"}) {
+		t.Errorf("spaces: %v, want [home work]", spaces)
+	}
+}
+
+func TestServeAdd(t *testing.T) {
+	srv := newTestServer(t, false)
+
+	var created note.FileNote
+	in := note.FileNote{Space: "work", Content: "tagged", Pinned: true, Tags: []string{"todo"}}
+	expect(t, srv, http.MethodPost, "/notes", in, http.StatusCreated, &created)
+	if !created.Pinned || !slices.Equal(created.Tags, in.Tags) {
+		t.Errorf("add: %+v, want pinned and tagged", created)
+	}
+
+	expect(t, srv, http.MethodPost, "/notes", note.FileNote{Space: "work", Content: "  "}, http.StatusBadRequest, nil)
+	expect(t, srv, http.MethodPost, "/notes", "not a note", http.StatusBadRequest, nil)
+}
+
+func TestServeEdit(t *testing.T) {
+	srv := newTestServer(t, false)
+	n := addTestNote(t, srv, "work", "before")
+
+	content, space, pinned := "after", "home", true
+	var edited note.FileNote
+	expect(t, srv, http.MethodPatch, "/notes/"+strconv.Itoa(n.ID),
+		notePatch{Content: &content, Space: &space, Pinned: &pinned}, http.StatusOK, &edited)
+	if edited.Content != content || edited.Space != space || edited.Pinned != pinned {
+		t.Errorf("edit: %+v, want content %q, space %q and pinned", edited, content, space)
+	}
+
+	// A failed patch changes nothing
+	empty, other := "", "other"
+	expect(t, srv, http.MethodPatch, "/notes/"+strconv.Itoa(n.ID), notePatch{Content: &empty, Space: &other}, http.StatusBadRequest, nil)
+	invalid := "bad,space"
+	expect(t, srv, http.MethodPatch, "/notes/"+strconv.Itoa(n.ID), notePatch{Content: &other, Space: &invalid}, http.StatusBadRequest, nil)
+
+	var got note.FileNote
+	expect(t, srv, http.MethodGet, "/notes/"+strconv.Itoa(n.ID), nil, http.StatusOK, &got)
+	if got.Content != content || got.Space != space {
+		t.Errorf("after failed edit: %+v, want content %q and space %q", got, content, space)
+	}
+
+	expect(t, srv, http.MethodPatch, "/notes/999", notePatch{Content: &content}, http.StatusNotFound, nil)
+}
+
+func TestServeMoveAndPin(t *testing.T) {
+	srv := newTestServer(t, false)
+	a := addTestNote(t, srv, "work", "a")
+	b := addTestNote(t, srv, "work", "b")
+
+	expect(t, srv, http.MethodPost, "/notes/move", moveRequest{IDs: []int{a.ID, b.ID}, Space: "archive"}, http.StatusNoContent, nil)
+	expect(t, srv, http.MethodPost, "/notes/pin", pinRequest{IDs: []int{a.ID}, Pinned: true}, http.StatusNoContent, nil)
+
+	var got note.FileNote
+	expect(t, srv, http.MethodGet, "/notes/"+strconv.Itoa(a.ID), nil, http.StatusOK, &got)
+	if got.Space != "archive" || !got.Pinned {
+		t.Errorf("after move and pin: %+v, want pinned in archive", got)
+	}
+
+	// Unless every note exists, none are changed
+	expect(t, srv, http.MethodPost, "/notes/move", moveRequest{IDs: []int{a.ID, 999}, Space: "work"}, http.StatusConflict, nil)
+	expect(t, srv, http.MethodGet, "/notes/"+strconv.Itoa(a.ID), nil, http.StatusOK, &got)
+	if got.Space != "archive" {
+		t.Errorf("after partial move: space %q, want archive", got.Space)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body any
+	}{
+		{"move without ids", "/notes/move", moveRequest{Space: "work"}},
+		{"move without space", "/notes/move", moveRequest{IDs: []int{a.ID}}},
+		{"move with invalid id", "/notes/move", moveRequest{IDs: []int{0}, Space: "work"}},
+		{"pin without ids", "/notes/pin", pinRequest{Pinned: true}},
+		{"remove without ids", "/notes/remove", removeRequest{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expect(t, srv, http.MethodPost, test.path, test.body, http.StatusBadRequest, nil)
+		})
+	}
+}
+
+func TestServeRemove(t *testing.T) {
+	srv := newTestServer(t, false)
+	a := addTestNote(t, srv, "work", "a")
+	b := addTestNote(t, srv, "work", "b")
+	c := addTestNote(t, srv, "work", "c")
+
+	// Removed notes are moved to the trash
+	expect(t, srv, http.MethodDelete, "/notes/"+strconv.Itoa(a.ID), nil, http.StatusNoContent, nil)
+	var got note.FileNote
+	expect(t, srv, http.MethodGet, "/notes/"+strconv.Itoa(a.ID), nil, http.StatusOK, &got)
+	if got.Space != note.TrashSpace {
+		t.Errorf("after remove: space %q, want %q", got.Space, note.TrashSpace)
+	}
+
+	expect(t, srv, http.MethodDelete, "/notes/"+strconv.Itoa(a.ID)+"?permanent=true", nil, http.StatusNoContent, nil)
+	expect(t, srv, http.MethodGet, "/notes/"+strconv.Itoa(a.ID), nil, http.StatusNotFound, nil)
+
+	expect(t, srv, http.MethodPost, "/notes/remove", removeRequest{IDs: []int{b.ID, c.ID}, Permanent: true}, http.StatusNoContent, nil)
+	var ids []int
+	expect(t, srv, http.MethodGet, "/ids", nil, http.StatusOK, &ids)
+	if len(ids) != 0 {
+		t.Errorf("after remove: ids %v, want none", ids)
+	}
+
+	expect(t, srv, http.MethodDelete, "/notes/999", nil, http.StatusConflict, nil)
+}
+
+func TestServeGuard(t *testing.T) {
+	srv := newTestServer(t, false)
+	a := addTestNote(t, srv, "work", "a")
+	body := `{"ids":[` + strconv.Itoa(a.ID) + `],"permanent":true}`
+
+	tests := []struct {
+		name        string
+		host        string
+		origin      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"text body", "", "", "text/plain", body, http.StatusUnsupportedMediaType},
+		{"form body", "", "", "application/x-www-form-urlencoded", body, http.StatusUnsupportedMediaType},
+		{"no content type", "", "", "", body, http.StatusUnsupportedMediaType},
+		{"foreign origin", "", "http://evil.example", "application/json", body, http.StatusForbidden},
+		{"null origin", "", "null", "application/json", body, http.StatusForbidden},
+		{"rebound host", "evil.example:7373", "", "application/json", body, http.StatusForbidden},
+		{"too large", "", "", "application/json", `{"ids":[` + strings.Repeat(" ", serveMaxBodySize) + `]}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/notes/remove", strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			if test.host != "" {
+				req.Host = test.host
+			}
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Errorf("status %v, want %v", resp.StatusCode, test.status)
+			}
+		})
+	}
+
+	// Nothing was removed
+	expect(t, srv, http.MethodGet, "/notes/"+strconv.Itoa(a.ID), nil, http.StatusOK, nil)
+
+	// Requests from the same origin, or to localhost, are allowed
+	for _, header := range []struct{ host, origin string }{
+		{"", srv.URL},
+		{"localhost:7373", ""},
+		{"[::1]:7373", ""},
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/notes", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		if header.host != "" {
+			req.Host = header.host
+		}
+		if header.origin != "" {
+			req.Header.Set("Origin", header.origin)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("host %q, origin %q: status %v, want %v", header.host, header.origin, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
@@ -44,7 +44,7 @@ func noteShow(cmd *cobra.Command, args []string) {
 	defer db.Close()
 
 	uniqueIds := removeDuplicates(ids)
-	notes, err := db.GetNotes(uniqueIds)
+	notes, err := db.GetNotes(cmd.Context(), uniqueIds)
 	if err != nil {
 		quitError("db get", err)
 	}
@@ -57,7 +57,9 @@ func noteShow(cmd *cobra.Command, args []string) {
 
 	// This command has a special case for when the user requested to get one note
 	// For this case, default to only printing the content of the note.
-	if len(notesOrdered) == 1 && !alwaysStyleArg {
+	if fullArg {
+		printNotesFull(notesOrdered, color, noteBacklinks(cmd.Context(), db, uniqueIds))
+	} else if len(notesOrdered) == 1 && !alwaysStyleArg {
 		printNotesMinimal(notesOrdered)
 	} else {
 		pprintNotes(notesOrdered, style, color)
@@ -22,11 +22,15 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
 	"github.com/spf13/cobra"
 )
 
@@ -53,7 +57,7 @@ func noteSpace(cmd *cobra.Command, args []string) {
 	// Either find spaces linked to notes
 	var spaces []string
 	if len(findIds) > 0 {
-		notes, err := d.GetNotes(findIds)
+		notes, err := d.GetNotes(cmd.Context(), findIds)
 		if err != nil {
 			quitError("db get", err)
 		}
@@ -69,7 +73,7 @@ func noteSpace(cmd *cobra.Command, args []string) {
 		}
 	} else {
 		// Or list all (or at least some) spaces
-		lsSpaces, err := d.SelectSpaces(allArg, sortOpts)
+		lsSpaces, err := d.SelectSpaces(cmd.Context(), allArg, sortOpts)
 		if err != nil {
 			quitError("db list", err)
 		}
@@ -78,7 +82,19 @@ func noteSpace(cmd *cobra.Command, args []string) {
 	}
 
 	// Print listed spaces
-	if listArg {
+	if treeArg {
+		all, err := d.Spaces(cmd.Context(), true, true)
+		if err != nil {
+			quitError("db list", err)
+		}
+		counts := make(map[string]int, len(all))
+		for _, space := range all {
+			counts[space.Name] = space.Count
+		}
+		printSpaceTree(newSpaceTree(spaces, counts), "", true)
+	} else if longArg {
+		printSpacesLong(cmd.Context(), d, spaces)
+	} else if listArg {
 		for _, space := range spaces {
 			fmt.Println(space)
 		}
@@ -88,6 +104,194 @@ func noteSpace(cmd *cobra.Command, args []string) {
 	}
 }
 
+// spaceNode is a level in the hierarchy of nested spaces
+type spaceNode struct {
+	name     string
+	count    int // Notes in this space only
+	children []*spaceNode
+}
+
+// total is the number of notes in the space and all spaces nested below it
+func (n *spaceNode) total() int {
+	total := n.count
+	for _, child := range n.children {
+		total += child.total()
+	}
+	return total
+}
+
+// newSpaceTree arranges spaces into a hierarchy, the order of siblings is kept
+func newSpaceTree(spaces []string, counts map[string]int) []*spaceNode {
+	var (
+		nodes = make(map[string]*spaceNode)
+		roots = []*spaceNode{}
+		node  func(space string) *spaceNode
+	)
+	node = func(space string) *spaceNode {
+		if n, ok := nodes[space]; ok {
+			return n
+		}
+		n := &spaceNode{name: strings.TrimPrefix(space, note.ParentSpace(space)+note.SpaceSeparator)}
+		nodes[space] = n
+
+		// Parents are created even if they contain no notes
+		if parent := note.ParentSpace(space); parent != "" {
+			p := node(parent)
+			p.children = append(p.children, n)
+		} else {
+			roots = append(roots, n)
+		}
+		return n
+	}
+
+	for _, space := range spaces {
+		node(space).count = counts[space]
+	}
+	return roots
+}
+
+func printSpaceTree(nodes []*spaceNode, prefix string, root bool) {
+	for i, n := range nodes {
+		var (
+			branch = "├── "
+			indent = "│   "
+		)
+		if i == len(nodes)-1 {
+			branch = "└── "
+			indent = "    "
+		}
+		if root {
+			branch = ""
+			indent = ""
+		}
+
+		fmt.Printf("%v%v%v (%v)\n", prefix, branch, n.name, n.total())
+		printSpaceTree(n.children, prefix+indent, false)
+	}
+}
+
+func noteSpaceRename(cmd *cobra.Command, args []string) {
+	d := dbOpen()
+	defer d.Close()
+
+	if err := note.RenameSpace(cmd.Context(), d, args[0], args[1]); err != nil {
+		quitError("db rename", err)
+	}
+
+	fmt.Printf("Space %v renamed to %v\n", args[0], args[1])
+}
+
+func noteSpaceMerge(cmd *cobra.Command, args []string) {
+	var (
+		from = args[:len(args)-1]
+		to   = args[len(args)-1]
+	)
+
+	d := dbOpen()
+	defer d.Close()
+
+	if err := note.MergeSpaces(cmd.Context(), d, from, to); err != nil {
+		quitError("db merge", err)
+	}
+
+	fmt.Printf("Merged %v into %v\n", strings.Join(from, ", "), to)
+}
+
+func noteSpaceDescribe(cmd *cobra.Command, args []string) {
+	var (
+		name   = args[0]
+		update note.SpaceUpdate
+		flags  = cmd.Flags()
+	)
+	if len(args) > 1 {
+		description := strings.Join(args[1:], " ")
+		update.Description = &description
+	}
+	if flags.Changed("hidden") {
+		update.Hidden = &hiddenArg
+	}
+	if flags.Changed("default-sort") {
+		var column db.Column
+		if defaultSortArg != "" {
+			parsed, err := mapNoteSortColumn(defaultSortArg)
+			if err != nil {
+				quitError("args", err)
+			}
+			column = parsed
+		}
+		update.DefaultSort = &column
+	}
+	if flags.Changed("default-style") {
+		if defaultStyleArg != "" {
+			if _, err := parseStyle(defaultStyleArg); err != nil {
+				quitError("args", err)
+			}
+		}
+		update.DefaultStyle = &defaultStyleArg
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	// Without any changes, the space is printed
+	if update == (note.SpaceUpdate{}) {
+		space, err := d.GetSpace(cmd.Context(), name)
+		if err != nil {
+			quitError("db get", err)
+		}
+		printSpace(space)
+		return
+	}
+
+	if err := note.DescribeSpace(cmd.Context(), d, name, update); err != nil {
+		quitError("db describe", err)
+	}
+	fmt.Println("Space modified")
+}
+
+func printSpace(space *db.Space) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "Space:\t%v\n", space.Name)
+	fmt.Fprintf(tw, "Description:\t%v\n", space.Description)
+	fmt.Fprintf(tw, "Notes:\t%v\n", space.Count)
+	fmt.Fprintf(tw, "Created:\t%v\n", space.Created.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(tw, "Hidden:\t%v\n", space.Hidden)
+	if space.Encrypted {
+		fmt.Fprintf(tw, "Encrypted:\t%v\n", lockedString(space))
+	}
+	if space.DefaultSort != "" {
+		fmt.Fprintf(tw, "Default sort:\t%v\n", space.DefaultSort)
+	}
+	if space.DefaultStyle != "" {
+		fmt.Fprintf(tw, "Default style:\t%v\n", space.DefaultStyle)
+	}
+	tw.Flush()
+}
+
+func printSpacesLong(ctx context.Context, d *db.DB, names []string) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Space\tNotes\tEncrypted\tDescription")
+	for _, name := range names {
+		space, err := d.GetSpace(ctx, name)
+		if err != nil {
+			quitError("db get", err)
+		}
+		encrypted := "-"
+		if space.Encrypted {
+			encrypted = lockedString(space)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", space.Name, space.Count, encrypted, space.Description)
+	}
+	tw.Flush()
+}
+
+func lockedString(space *db.Space) string {
+	if space.Locked {
+		return "locked"
+	}
+	return "unlocked"
+}
+
 func spacesSortOpt() (*db.SortOpts, error) {
 	sortOpts := &db.SortOpts{
 		Ascending:  !descendingArg,
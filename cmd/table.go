@@ -51,7 +51,7 @@ var (
 )
 
 func noteTable(cmd *cobra.Command, args []string) {
-	notes, err := selectNotes(args)
+	notes, err := selectNotes(cmd, args)
 	if err != nil {
 		quitError("collect notes", err)
 	}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bdazl/note/note"
+	"github.com/spf13/cobra"
+)
+
+func noteTagAdd(cmd *cobra.Command, args []string) {
+	tags, ids, err := checkTag(args)
+	if err != nil {
+		quitError("args", err)
+	}
+
+	db := dbOpen()
+	defer db.Close()
+
+	if err = db.AddTags(cmd.Context(), ids, tags); err != nil {
+		quitError("db tag", err)
+	}
+
+	printTagged(len(ids), "tagged")
+}
+
+func noteTagRemove(cmd *cobra.Command, args []string) {
+	tags, ids, err := checkTag(args)
+	if err != nil {
+		quitError("args", err)
+	}
+
+	db := dbOpen()
+	defer db.Close()
+
+	if err = db.RemoveTags(cmd.Context(), ids, tags); err != nil {
+		quitError("db untag", err)
+	}
+
+	printTagged(len(ids), "untagged")
+}
+
+func noteTagList(cmd *cobra.Command, args []string) {
+	var ids []int
+	if len(args) > 0 {
+		parsed, err := parseIds(args)
+		if err != nil {
+			quitError("parse ids", err)
+		}
+		ids = removeDuplicates(parsed)
+	}
+
+	db := dbOpen()
+	defer db.Close()
+
+	tags, err := db.ListTags(cmd.Context(), ids, !descendingArg)
+	if err != nil {
+		quitError("db list", err)
+	}
+
+	if listArg {
+		for _, tag := range tags {
+			fmt.Println(tag)
+		}
+	} else {
+		fmt.Println(strings.Join(tags, " "))
+	}
+}
+
+func printTagged(count int, action string) {
+	if count == 1 {
+		fmt.Printf("Note %v\n", action)
+	} else {
+		fmt.Printf("%v notes %v\n", count, action)
+	}
+}
+
+// checkTag parses the arguments: tag[,tag...] id <id...>
+func checkTag(args []string) ([]string, []int, error) {
+	if len(args) < 2 {
+		return nil, nil, fmt.Errorf("requires positional arguments tag and id")
+	}
+
+	tags, err := note.ParseTags(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids, err := parseIds(args[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tags, removeDuplicates(ids), nil
+}
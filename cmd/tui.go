@@ -0,0 +1,511 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bdazl/note/db"
+	"github.com/bdazl/note/note"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	tuiAllSpaces    = "All"
+	tuiDefaultLimit = 200
+	tuiPreviewWords = 8
+	tuiHelp         = "[yellow]/[-] search  [yellow]e[-] edit  [yellow]p[-] pin  [yellow]m[-] move  " +
+		"[yellow]d[-] trash  [yellow]r[-] restore  [yellow][ ][-] page  [yellow]tab[-] focus  [yellow]q[-] quit"
+)
+
+type tui struct {
+	app     *tview.Application
+	pages   *tview.Pages
+	spaces  *tview.List
+	notes   *tview.Table
+	preview *tview.TextView
+	search  *tview.InputField
+	status  *tview.TextView
+
+	ctx        context.Context
+	d          *db.DB
+	sortOpts   *db.SortOpts
+	pageOpts   *db.PageOpts
+	filterOpts *db.FilterOpts
+
+	space   string // empty means all spaces
+	query   string
+	current db.Notes
+}
+
+func noteTui(cmd *cobra.Command, args []string) {
+	sortOpts, pageOpts, err := listOpts()
+	if err != nil {
+		quitError("args", err)
+	}
+	if pageOpts.Limit == 0 {
+		pageOpts.Limit = tuiDefaultLimit
+	}
+
+	filterOpts, err := filterOpts()
+	if err != nil {
+		quitError("args", err)
+	}
+
+	d := dbOpen()
+	defer d.Close()
+
+	t := newTui(cmd.Context(), d, sortOpts, pageOpts, filterOpts)
+	t.reloadSpaces()
+	t.reloadNotes()
+
+	if err := t.app.Run(); err != nil {
+		quitError("tui", err)
+	}
+}
+
+func newTui(ctx context.Context, d *db.DB, sortOpts *db.SortOpts, pageOpts *db.PageOpts, filterOpts *db.FilterOpts) *tui {
+	t := &tui{
+		app:        tview.NewApplication(),
+		pages:      tview.NewPages(),
+		spaces:     tview.NewList(),
+		notes:      tview.NewTable(),
+		preview:    tview.NewTextView(),
+		search:     tview.NewInputField(),
+		status:     tview.NewTextView(),
+		ctx:        ctx,
+		d:          d,
+		sortOpts:   sortOpts,
+		pageOpts:   pageOpts,
+		filterOpts: filterOpts,
+	}
+
+	t.spaces.ShowSecondaryText(false)
+	t.spaces.SetHighlightFullLine(true)
+	t.spaces.SetBorder(true).SetTitle(" Spaces ")
+	t.spaces.SetChangedFunc(func(_ int, space, _ string, _ rune) {
+		t.selectSpace(space)
+	})
+	t.spaces.SetInputCapture(t.keys)
+
+	t.notes.SetSelectable(true, false)
+	t.notes.SetFixed(1, 0)
+	t.notes.SetBorder(true).SetTitle(" Notes ")
+	t.notes.SetSelectionChangedFunc(func(_, _ int) {
+		t.updatePreview()
+	})
+	t.notes.SetSelectedFunc(func(_, _ int) {
+		t.edit()
+	})
+	t.notes.SetInputCapture(t.keys)
+
+	t.preview.SetDynamicColors(true)
+	t.preview.SetWordWrap(true)
+	t.preview.SetBorder(true).SetTitle(" Preview ")
+
+	t.search.SetLabel("/")
+	t.search.SetChangedFunc(func(text string) {
+		t.query = text
+		t.pageOpts.Offset = 0
+		t.help()
+		t.reloadNotes()
+	})
+	t.search.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			t.search.SetText("")
+		}
+		t.app.SetFocus(t.notes)
+	})
+
+	t.status.SetDynamicColors(true)
+	t.help()
+
+	main := tview.NewFlex().
+		AddItem(t.spaces, 24, 0, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(t.notes, 0, 1, true).
+			AddItem(t.preview, 0, 1, false), 0, 1, true)
+
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(main, 0, 1, true).
+		AddItem(t.search, 1, 0, false).
+		AddItem(t.status, 1, 0, false)
+
+	t.pages.AddPage("main", root, true, true)
+	t.app.SetRoot(t.pages, true).EnableMouse(true)
+	t.app.SetFocus(t.notes)
+	return t
+}
+
+// keys handles the key bindings shared by the space and selected views.
+// A message in the status bar is shown until the next key is pressed.
+func (t *tui) keys(event *tcell.EventKey) *tcell.EventKey {
+	t.help()
+
+	switch event.Key() {
+	case tcell.KeyTab:
+		if t.notes.HasFocus() {
+			t.app.SetFocus(t.spaces)
+		} else {
+			t.app.SetFocus(t.notes)
+		}
+		return nil
+	case tcell.KeyDelete:
+		t.trash()
+		return nil
+	case tcell.KeyRune:
+	default:
+		return event
+	}
+
+	switch event.Rune() {
+	case 'q':
+		t.app.Stop()
+	case '/':
+		t.app.SetFocus(t.search)
+	case 'e':
+		t.edit()
+	case 'p':
+		t.togglePin()
+	case 'm':
+		t.promptMove()
+	case 'd':
+		t.trash()
+	case 'r':
+		t.restore()
+	case ']':
+		t.page(1)
+	case '[':
+		t.page(-1)
+	default:
+		return event
+	}
+	return nil
+}
+
+func (t *tui) reloadSpaces() {
+	spaces, err := t.d.SelectSpaces(t.ctx, allArg, &db.SortOpts{Ascending: true, SortColumn: db.SpaceColumn})
+	if err != nil {
+		t.error(err)
+		return
+	}
+
+	// The trash is a hidden space, but its notes can be restored from here
+	if !slices.Contains(spaces, TrashSpace) {
+		i, _ := slices.BinarySearch(spaces, TrashSpace)
+		spaces = slices.Insert(spaces, i, TrashSpace)
+	}
+
+	t.spaces.Clear()
+	t.spaces.AddItem(tuiAllSpaces, "", 0, nil)
+	for i, space := range spaces {
+		t.spaces.AddItem(space, "", 0, nil)
+		if space == t.space {
+			t.spaces.SetCurrentItem(i + 1)
+		}
+	}
+}
+
+func (t *tui) selectSpace(space string) {
+	if space == tuiAllSpaces {
+		space = ""
+	}
+	if space == t.space {
+		return
+	}
+
+	t.space = space
+	t.pageOpts.Offset = 0
+	t.reloadNotes()
+}
+
+func (t *tui) reloadNotes() {
+	notes, err := t.selectNotes()
+	if err != nil {
+		t.error(err)
+		return
+	}
+
+	row, _ := t.notes.GetSelection()
+	t.current = notes
+
+	t.notes.Clear()
+	for col, header := range []string{idCol, spaceCol, "Pin", createdCol, previewCol} {
+		t.notes.SetCell(0, col, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorGreen))
+	}
+
+	for i, selected := range notes {
+		pin := ""
+		if selected.Pinned {
+			pin = Pin
+		}
+		cells := []string{
+			fmt.Sprint(selected.ID),
+			selected.Space,
+			pin,
+			selected.Created.Format("2006-01-02"),
+			getPreview(selected.Content, tuiPreviewWords),
+		}
+		for col, text := range cells {
+			cell := tview.NewTableCell(tview.Escape(text))
+			if col == len(cells)-1 {
+				cell.SetExpansion(1)
+			}
+			t.notes.SetCell(i+1, col, cell)
+		}
+	}
+
+	page := t.pageOpts.Offset/t.pageOpts.Limit + 1
+	t.notes.SetTitle(fmt.Sprintf(" Notes (page %v) ", page))
+
+	t.notes.Select(max(1, min(row, len(notes))), 0)
+	t.updatePreview()
+}
+
+// selectNotes fetches the current page of notes, matching the search query
+func (t *tui) selectNotes() (db.Notes, error) {
+	var spaces []string
+	if t.space != "" {
+		spaces = []string{t.space}
+	}
+
+	if t.query == "" {
+		return t.d.SelectNotes(t.ctx, spaces, allArg, t.sortOpts, t.pageOpts, t.filterOpts)
+	}
+
+	results, err := t.d.SearchNotes(t.ctx, t.query, &db.SearchOpts{
+		Spaces: spaces,
+		All:    allArg,
+		Filter: t.filterOpts,
+		Prefix: true,
+		Limit:  t.pageOpts.Limit,
+		Offset: t.pageOpts.Offset,
+	})
+	if err == nil {
+		return searchResultNotes(results), nil
+	} else if !errors.Is(err, db.ErrNoSearchIndex) {
+		return nil, err
+	}
+
+	// Without a search index, match the (case insensitive) query against all notes,
+	// and keep the matches of the current page
+	query := strings.ToLower(t.query)
+	matched := make(db.Notes, 0, t.pageOpts.Limit)
+	skip := t.pageOpts.Offset
+	for selected, err := range t.d.IterateNotes(t.ctx, spaces, allArg, t.sortOpts, t.filterOpts, 0) {
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(strings.ToLower(selected.Content), query) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		matched = append(matched, selected)
+		if len(matched) == t.pageOpts.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+func (t *tui) page(direction int) {
+	offset := t.pageOpts.Offset + direction*t.pageOpts.Limit
+	if offset < 0 || (direction > 0 && len(t.current) < t.pageOpts.Limit) {
+		return
+	}
+
+	t.pageOpts.Offset = offset
+	t.reloadNotes()
+}
+
+// selected returns the highlighted selected, if any
+func (t *tui) selected() *db.Note {
+	row, _ := t.notes.GetSelection()
+	if row < 1 || row > len(t.current) {
+		return nil
+	}
+	return &t.current[row-1]
+}
+
+func (t *tui) updatePreview() {
+	selected := t.selected()
+	if selected == nil {
+		t.preview.SetText("")
+		return
+	}
+
+	fullFmt := "2006-01-02 15:04:05"
+	header := fmt.Sprintf(
+		"[green]ID:[-] %v  [green]Space:[-] %v  [green]Created:[-] %v  [green]Updated:[-] %v",
+		selected.ID,
+		tview.Escape(selected.Space),
+		selected.Created.Format(fullFmt),
+		selected.LastUpdated.Format(fullFmt),
+	)
+	if len(selected.Tags) > 0 {
+		header += fmt.Sprintf("  [green]Tags:[-] %v", tview.Escape(strings.Join(selected.Tags, ", ")))
+	}
+
+	t.preview.SetText(header + "\n\n" + tview.Escape(selected.Content))
+	t.preview.ScrollToBeginning()
+}
+
+func (t *tui) edit() {
+	selected := t.selected()
+	if selected == nil {
+		return
+	}
+
+	var (
+		edited string
+		err    error
+	)
+	t.app.Suspend(func() {
+		edited, err = openInEditor(selected.Content)
+	})
+	if err != nil {
+		t.error(err)
+		return
+	} else if edited == selected.Content {
+		t.info("No changes")
+		return
+	}
+
+	if err := note.Edit(t.ctx, t.d, selected.ID, edited, editOpts()); err != nil {
+		t.error(err)
+		return
+	}
+
+	t.info("Note modified")
+	t.reloadNotes()
+}
+
+func (t *tui) togglePin() {
+	selected := t.selected()
+	if selected == nil {
+		return
+	}
+
+	if err := t.d.PinNotes(t.ctx, []int{selected.ID}, !selected.Pinned); err != nil {
+		t.error(err)
+		return
+	}
+	t.reloadNotes()
+}
+
+func (t *tui) trash() {
+	selected := t.selected()
+	if selected == nil || selected.Space == TrashSpace {
+		return
+	}
+
+	if err := note.Remove(t.ctx, t.d, []int{selected.ID}, note.RemoveOpts{}); err != nil {
+		t.error(err)
+		return
+	}
+
+	t.info(fmt.Sprintf("Note %v moved to trash", selected.ID))
+	t.reloadSpaces()
+	t.reloadNotes()
+}
+
+func (t *tui) restore() {
+	selected := t.selected()
+	if selected == nil || selected.Space != TrashSpace {
+		return
+	}
+
+	if err := note.Restore(t.ctx, t.d, []int{selected.ID}, viper.GetString(ViperSpace)); err != nil {
+		t.error(err)
+		return
+	}
+
+	t.info(fmt.Sprintf("Note %v restored", selected.ID))
+	t.reloadSpaces()
+	t.reloadNotes()
+}
+
+func (t *tui) promptMove() {
+	selected := t.selected()
+	if selected == nil {
+		return
+	}
+
+	const page = "move"
+	input := tview.NewInputField().SetLabel("Move to space: ")
+	input.SetBorder(true).SetTitle(fmt.Sprintf(" Move note %v ", selected.ID))
+	input.SetDoneFunc(func(key tcell.Key) {
+		t.pages.RemovePage(page)
+		t.app.SetFocus(t.notes)
+
+		space := strings.TrimSpace(input.GetText())
+		if key != tcell.KeyEnter || space == "" || space == selected.Space {
+			return
+		}
+		if err := note.Move(t.ctx, t.d, []int{selected.ID}, space); err != nil {
+			t.error(err)
+			return
+		}
+
+		t.info(fmt.Sprintf("Note %v moved to %v", selected.ID, space))
+		t.reloadSpaces()
+		t.reloadNotes()
+	})
+
+	t.pages.AddPage(page, tuiModal(input, 50, 3), true, true)
+	t.app.SetFocus(input)
+}
+
+func (t *tui) help() {
+	t.status.SetText(tuiHelp)
+}
+
+func (t *tui) info(msg string) {
+	t.status.SetText(tview.Escape(msg))
+}
+
+func (t *tui) error(err error) {
+	t.status.SetText("[red]error:[-] " + tview.Escape(err.Error()))
+}
+
+// tuiModal centers a primitive on top of the current page
+func tuiModal(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+}
@@ -22,24 +22,36 @@ THE SOFTWARE.
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 // Add a note to the database.
 // If full is true, then all values (except ID) are taken from the input,
 // otherwise timestamps and other default values are set automatically.
-func (d *DB) AddNote(note Note, full bool) (int64, error) {
+// In an encrypted space, the space must be unlocked.
+func (d *conn) AddNote(ctx context.Context, note Note, full bool) (int64, error) {
 	const (
-		smallQuery = "INSERT INTO notes (space, content, pinned) VALUES (?, ?, ?);"
-		fullQuery  = `INSERT INTO notes (space, created, last_updated, content, pinned)
-		VALUES (?, ?, ?, ?, ?);`
+		smallQuery = `INSERT INTO notes (space, content, pinned, key_id, due, remind_at)
+		VALUES (?, ?, ?, ?, ?, ?);`
+		fullQuery = `INSERT INTO notes (space, created, last_updated, content, pinned, key_id, due, remind_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
 	)
 	var (
 		dbN    = toDbNote(note)
 		query  string
 		params []any
+		err    error
 	)
 
+	dbN.Content, dbN.KeyID, err = d.encryptWith(ctx, dbN.Content, spaceKeySql, dbN.Space)
+	if err != nil {
+		return 0, fmt.Errorf("space %v: %w", dbN.Space, err)
+	}
+
 	if full {
 		query = fullQuery
 		params = []any{
@@ -48,21 +60,57 @@ func (d *DB) AddNote(note Note, full bool) (int64, error) {
 			dbN.LastUpdated,
 			dbN.Content,
 			dbN.Pinned,
+			dbN.KeyID,
+			dbN.Due,
+			dbN.RemindAt,
 		}
 	} else {
 		query = smallQuery
-		params = []any{dbN.Space, dbN.Content, dbN.Pinned}
+		params = []any{dbN.Space, dbN.Content, dbN.Pinned, dbN.KeyID, dbN.Due, dbN.RemindAt}
 	}
 
-	result, err := d.db.Exec(query, params...)
-	if err != nil {
-		return 0, fmt.Errorf("insert error: %w", err)
-	}
+	return d.linked(ctx, note.Content, func(c *conn) (int64, error) {
+		result, err := c.db.ExecContext(ctx, query, params...)
+		if err != nil {
+			return 0, fmt.Errorf("insert error: %w", err)
+		}
 
-	id, err := result.LastInsertId()
+		id, err := result.LastInsertId()
+		if err != nil {
+			return id, fmt.Errorf("last insert id error: %w", err)
+		}
+
+		return id, nil
+	})
+}
+
+// InsertNote adds a note with all values, including the ID, taken from the input.
+// If the ID is taken, the error matches ErrExists.
+func (d *conn) InsertNote(ctx context.Context, note Note) error {
+	var (
+		dbN = toDbNote(note)
+		err error
+	)
+	dbN.Content, dbN.KeyID, err = d.encryptWith(ctx, dbN.Content, spaceKeySql, dbN.Space)
 	if err != nil {
-		return id, fmt.Errorf("last insert id error: %w", err)
+		return fmt.Errorf("space %v: %w", dbN.Space, err)
 	}
 
-	return id, nil
+	_, err = d.linked(ctx, note.Content, func(c *conn) (int64, error) {
+		_, err := c.db.ExecContext(ctx,
+			`INSERT INTO notes (id, space, created, last_updated, content, pinned, key_id, due, remind_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			note.ID, dbN.Space, dbN.Created, dbN.LastUpdated, dbN.Content, dbN.Pinned, dbN.KeyID,
+			dbN.Due, dbN.RemindAt,
+		)
+
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return 0, fmt.Errorf("note %v: %w", note.ID, ErrExists)
+		} else if err != nil {
+			return 0, fmt.Errorf("insert error: %w", err)
+		}
+		return int64(note.ID), nil
+	})
+	return err
 }
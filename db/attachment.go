@@ -0,0 +1,212 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// The data of an attachment is encrypted with the key of its note, if the note is encrypted.
+	// The checksum and size are of the data before it is encrypted.
+	createAttachmentsTableSql = `CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		note_id INTEGER NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+		filename TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		sha256 TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		key_id INTEGER REFERENCES space_keys (id),
+		created DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (note_id, filename));`
+
+	attachmentColumns = "id, note_id, filename, mime_type, sha256, size, created, key_id"
+)
+
+// A file attached to a note
+type Attachment struct {
+	ID        int
+	NoteID    int
+	Filename  string
+	MimeType  string
+	SHA256    string // hex encoded checksum of the data
+	Size      int64
+	Created   time.Time
+	Data      []byte // only read when requested
+	Encrypted bool   // the data is encrypted in the database, as is the content of its note
+}
+
+// AddAttachment stores the data of a file with a note, the checksum and size are computed.
+// If the note already has an attachment with the filename, it is replaced if replace is set,
+// and otherwise the error matches ErrExists.
+func (d *conn) AddAttachment(ctx context.Context, a Attachment, replace bool) (int64, error) {
+	if a.Filename == "" {
+		return 0, fmt.Errorf("attachment requires a filename")
+	}
+
+	sum := sha256.Sum256(a.Data)
+	a.SHA256 = hex.EncodeToString(sum[:])
+	a.Size = int64(len(a.Data))
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var keyID sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT key_id FROM notes WHERE id = ?", a.NoteID).Scan(&keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, &NotFoundError{IDs: []int{a.NoteID}}
+	} else if err != nil {
+		return 0, fmt.Errorf("query error: %w", err)
+	}
+
+	data := a.Data
+	if keyID.Valid {
+		if data, err = d.keys.encryptBytes(keyID.Int64, a.Data); err != nil {
+			return 0, fmt.Errorf("note %v: %w", a.NoteID, err)
+		}
+	}
+
+	if replace {
+		_, err := tx.ExecContext(ctx,
+			"DELETE FROM attachments WHERE note_id = ? AND filename = ?", a.NoteID, a.Filename,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("remove: %w", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO attachments (note_id, filename, mime_type, sha256, size, data, key_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.NoteID, a.Filename, a.MimeType, a.SHA256, a.Size, data, keyID,
+	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return 0, fmt.Errorf("attachment %v of note %v: %w", a.Filename, a.NoteID, ErrExists)
+	} else if err != nil {
+		return 0, fmt.Errorf("insert error: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return id, fmt.Errorf("last insert id error: %w", err)
+	}
+	return id, tx.Commit()
+}
+
+// Attachments lists the attachments of a note by filename, with their data if data is set.
+// The attachments of an encrypted note can only be listed if it is unlocked.
+func (d *conn) Attachments(ctx context.Context, noteID int, data bool) ([]Attachment, error) {
+	columns := attachmentColumns
+	if data {
+		columns += ", data"
+	}
+
+	query := fmt.Sprintf("SELECT %v FROM attachments WHERE note_id = ? ORDER BY filename", columns)
+	rows, err := d.db.QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := make([]Attachment, 0)
+	for rows.Next() {
+		var (
+			a       Attachment
+			created string
+			keyID   sql.NullInt64
+		)
+		dest := []any{&a.ID, &a.NoteID, &a.Filename, &a.MimeType, &a.SHA256, &a.Size, &created, &keyID}
+		if data {
+			dest = append(dest, &a.Data)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+
+		if a.Created, err = parseTime(created); err != nil {
+			return nil, fmt.Errorf("conversion error: %w", err)
+		}
+		if keyID.Valid {
+			a.Encrypted = true
+			if _, err := d.keys.get(keyID.Int64); err != nil {
+				return nil, fmt.Errorf("note %v: %w", noteID, err)
+			}
+			if data {
+				if a.Data, err = d.keys.decryptBytes(keyID.Int64, a.Data); err != nil {
+					return nil, fmt.Errorf("attachment %v: %w", a.Filename, err)
+				}
+			}
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// RemoveAttachments removes the attachments of a note with the filenames, or all of them if
+// no filenames are given. Unless all of the named attachments exist, none are removed.
+func (d *conn) RemoveAttachments(ctx context.Context, noteID int, filenames []string) error {
+	if len(filenames) == 0 {
+		_, err := d.db.ExecContext(ctx, "DELETE FROM attachments WHERE note_id = ?", noteID)
+		if err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+		return nil
+	}
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	bracketQ := strings.Join(repeatString("?", len(filenames)), ", ")
+	result, err := tx.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM attachments WHERE note_id = ? AND filename IN (%v)", bracketQ),
+		append([]any{noteID}, sliceToAny(filenames)...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows: %w", err)
+	}
+	if rows != int64(len(filenames)) {
+		return &PartialError{Op: "detached", Affected: rows, Expected: int64(len(filenames))}
+	}
+	return tx.Commit()
+}
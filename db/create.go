@@ -22,6 +22,7 @@ THE SOFTWARE.
 package db
 
 import (
+	"context"
 	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -49,16 +50,10 @@ func CreateDb(path string) (*DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("open: %w", err)
 	}
-	defer db.db.Close()
+	defer db.sqlDB.Close()
 
-	_, err = db.db.Exec(createTableSql)
-	if err != nil {
-		return nil, fmt.Errorf("create notes table: %w", err)
-	}
-
-	_, err = db.db.Exec(createTriggerSql)
-	if err != nil {
-		return nil, fmt.Errorf("create trigger: %w", err)
+	if _, err = db.Migrate(context.Background()); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
 	}
 	return db, nil
 }
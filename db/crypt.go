@@ -0,0 +1,584 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// The key of an encrypted space is derived from its passphrase, with the
+	// parameters in kdf. The key check is a known text, encrypted with the key.
+	createSpaceKeysTableSql = `CREATE TABLE IF NOT EXISTS space_keys (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		kdf TEXT NOT NULL,
+		salt BLOB NOT NULL,
+		key_check BLOB NOT NULL,
+		created DATETIME DEFAULT CURRENT_TIMESTAMP);`
+
+	// New notes in a space are encrypted with the key of the space.
+	// A note keeps its key, and the key of its revisions, when it is moved.
+	addSpaceKeySql    = `ALTER TABLE spaces ADD COLUMN key_id INTEGER REFERENCES space_keys (id);`
+	addNoteKeySql     = `ALTER TABLE notes ADD COLUMN key_id INTEGER REFERENCES space_keys (id);`
+	addRevisionKeySql = `ALTER TABLE note_revisions ADD COLUMN key_id INTEGER REFERENCES space_keys (id);`
+
+	// Encrypting a note is not an edit, so neither a revision nor the timestamp is changed
+	createKeyedRevisionTriggerSql = `CREATE TRIGGER notes_revision
+		AFTER UPDATE OF content ON notes
+		FOR EACH ROW WHEN OLD.content IS NOT NEW.content AND OLD.key_id IS NEW.key_id
+		BEGIN
+			INSERT INTO note_revisions (note_id, revision, created, content, key_id)
+			VALUES (
+				OLD.id,
+				(SELECT IFNULL(MAX(revision), 0) + 1 FROM note_revisions WHERE note_id = OLD.id),
+				OLD.last_updated,
+				OLD.content,
+				OLD.key_id);
+		END;`
+
+	createKeyedLastUpdatedTriggerSql = `CREATE TRIGGER notes_auto_last_updated
+		AFTER UPDATE ON notes
+		FOR EACH ROW WHEN NEW.last_updated IS OLD.last_updated AND NEW.key_id IS OLD.key_id
+		BEGIN
+			UPDATE notes SET last_updated = CURRENT_TIMESTAMP WHERE id = OLD.id;
+		END;`
+
+	// An encrypted space is kept when it is empty, since its key would be lost otherwise
+	createKeyedSpaceUpdateTriggerSql = `CREATE TRIGGER notes_space_update
+		AFTER UPDATE OF space ON notes
+		FOR EACH ROW WHEN OLD.space IS NOT NEW.space
+		BEGIN
+			INSERT OR IGNORE INTO spaces (name, hidden) VALUES (NEW.space, NEW.space LIKE '.%');
+			` + deleteUnusedPlainSpaceSql + `
+		END;`
+
+	createKeyedSpaceDeleteTriggerSql = `CREATE TRIGGER notes_space_delete
+		AFTER DELETE ON notes
+		FOR EACH ROW
+		BEGIN
+			` + deleteUnusedPlainSpaceSql + `
+		END;`
+
+	deleteUnusedPlainSpaceSql = `DELETE FROM spaces WHERE name = OLD.space
+				AND description = '' AND hidden = (name LIKE '.%')
+				AND default_sort IS NULL AND default_style IS NULL AND key_id IS NULL
+				AND NOT EXISTS (SELECT 1 FROM notes WHERE space = OLD.space);`
+)
+
+// spaceKeySql selects the key of a space, or NULL if it is not encrypted or does not exist
+const spaceKeySql = "SELECT (SELECT key_id FROM spaces WHERE name = ?)"
+
+const (
+	// scrypt parameters of new keys, as recommended for interactive logins
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+	keyLength = 32
+	saltSize  = 16
+
+	keyCheckText = "note key check"
+)
+
+// SpaceKey is a key derived from the passphrase of an encrypted space.
+// It can be kept to unlock the space again, without deriving it.
+type SpaceKey struct {
+	ID  int64
+	Key []byte
+}
+
+// keyring holds the ciphers of the unlocked keys, shared by a database and its transactions
+type keyring struct {
+	mu    sync.RWMutex
+	aeads map[int64]cipher.AEAD
+}
+
+func newKeyring() *keyring {
+	return &keyring{aeads: make(map[int64]cipher.AEAD)}
+}
+
+func (k *keyring) add(id int64, aead cipher.AEAD) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.aeads[id] = aead
+}
+
+func (k *keyring) remove(id int64) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.aeads, id)
+}
+
+func (k *keyring) get(id int64) (cipher.AEAD, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, ErrLocked
+	}
+	return aead, nil
+}
+
+// unlocked lists the ids of the unlocked keys, in order
+func (k *keyring) unlocked() []int64 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]int64, 0, len(k.aeads))
+	for id := range k.aeads {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// encrypt seals text with a random nonce, the result is the base64 encoded nonce and ciphertext
+func (k *keyring) encrypt(id int64, text string) (string, error) {
+	data, err := k.encryptBytes(id, []byte(text))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (k *keyring) decrypt(id int64, text string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return "", fmt.Errorf("decode: %w", err)
+	}
+	plain, err := k.decryptBytes(id, data)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (k *keyring) encryptBytes(id int64, data []byte) ([]byte, error) {
+	aead, err := k.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return sealText(aead, data)
+}
+
+func (k *keyring) decryptBytes(id int64, data []byte) ([]byte, error) {
+	aead, err := k.get(id)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openText(aead, data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	return plain, nil
+}
+
+// seal encrypts the plaintext notes in encrypted spaces, along with their revisions and attachments,
+// and removes their links.
+// It is run after notes are moved, so that no plaintext is left in an encrypted space.
+// It returns the number of rows that were encrypted.
+func (k *keyring) seal(ctx context.Context, q querier) (int, error) {
+	notes, err := selectPlaintext(ctx, q,
+		`SELECT notes.id, notes.content, spaces.key_id FROM notes
+		JOIN spaces ON spaces.name = notes.space
+		WHERE notes.key_id IS NULL AND spaces.key_id IS NOT NULL`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range notes {
+		content, err := k.encrypt(n.keyID, n.content)
+		if err != nil {
+			return 0, fmt.Errorf("note %v: %w", n.id, err)
+		}
+		_, err = q.ExecContext(ctx, "UPDATE notes SET content = ?, key_id = ? WHERE id = ?", content, n.keyID, n.id)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt note %v: %w", n.id, err)
+		}
+		if _, err := q.ExecContext(ctx, "DELETE FROM links WHERE source_id = ?", n.id); err != nil {
+			return 0, fmt.Errorf("remove links of note %v: %w", n.id, err)
+		}
+	}
+
+	revisions, err := selectPlaintext(ctx, q,
+		`SELECT note_revisions.id, note_revisions.content, notes.key_id FROM note_revisions
+		JOIN notes ON notes.id = note_revisions.note_id
+		WHERE note_revisions.key_id IS NULL AND notes.key_id IS NOT NULL`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range revisions {
+		content, err := k.encrypt(r.keyID, r.content)
+		if err != nil {
+			return 0, fmt.Errorf("revision: %w", err)
+		}
+		_, err = q.ExecContext(ctx, "UPDATE note_revisions SET content = ?, key_id = ? WHERE id = ?", content, r.keyID, r.id)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt revision: %w", err)
+		}
+	}
+
+	attachments, err := selectPlaintext(ctx, q,
+		`SELECT attachments.id, attachments.data, notes.key_id FROM attachments
+		JOIN notes ON notes.id = attachments.note_id
+		WHERE attachments.key_id IS NULL AND notes.key_id IS NOT NULL`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range attachments {
+		data, err := k.encryptBytes(a.keyID, []byte(a.content))
+		if err != nil {
+			return 0, fmt.Errorf("attachment: %w", err)
+		}
+		_, err = q.ExecContext(ctx, "UPDATE attachments SET data = ?, key_id = ? WHERE id = ?", data, a.keyID, a.id)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt attachment: %w", err)
+		}
+	}
+	return len(notes) + len(revisions) + len(attachments), nil
+}
+
+type plaintext struct {
+	id      int64
+	content string
+	keyID   int64
+}
+
+// selectPlaintext reads all rows before returning, so that they can be updated
+func selectPlaintext(ctx context.Context, q querier, query string) ([]plaintext, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]plaintext, 0)
+	for rows.Next() {
+		var p plaintext
+		if err := rows.Scan(&p.id, &p.content, &p.keyID); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// EncryptSpace creates a key from the passphrase and encrypts all notes in the space with it,
+// including the ones added later. The space is created if it does not exist, and it is
+// unlocked afterwards. Spaces nested below it are not encrypted.
+func (d *conn) EncryptSpace(ctx context.Context, space, passphrase string) error {
+	if space == TrashSpace {
+		return fmt.Errorf("the %v space cannot be encrypted", TrashSpace)
+	} else if passphrase == "" {
+		return fmt.Errorf("require a passphrase")
+	}
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var keyID sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT key_id FROM spaces WHERE name = ?", space).Scan(&keyID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("query error: %w", err)
+	} else if keyID.Valid {
+		return fmt.Errorf("space %v is already encrypted", space)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("salt: %w", err)
+	}
+	kdf := fmt.Sprintf("scrypt:%d:%d:%d", scryptN, scryptR, scryptP)
+	key, err := deriveKey(kdf, passphrase, salt)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	check, err := sealText(aead, []byte(keyCheckText))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO space_keys (kdf, salt, key_check) VALUES (?, ?, ?)",
+		kdf, salt, check,
+	)
+	if err != nil {
+		return fmt.Errorf("insert key: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("last insert id error: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT OR IGNORE INTO spaces (name, hidden) VALUES (?, ? LIKE '.%')",
+		space, space,
+	)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE spaces SET key_id = ? WHERE name = ?", id, space); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	// Should the transaction be rolled back, the id may be reused by another key,
+	// which then replaces this one in the keyring.
+	d.keys.add(id, aead)
+	sealed, err := d.keys.seal(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return d.commitSealed(ctx, tx, sealed)
+}
+
+// DeriveSpaceKey derives the key of an encrypted space from its passphrase.
+// If the passphrase is wrong, the error matches ErrWrongPassphrase.
+func (d *conn) DeriveSpaceKey(ctx context.Context, space, passphrase string) (*SpaceKey, error) {
+	var (
+		key   SpaceKey
+		kdf   string
+		salt  []byte
+		check []byte
+	)
+	err := d.db.QueryRowContext(ctx,
+		`SELECT space_keys.id, kdf, salt, key_check FROM spaces
+		JOIN space_keys ON space_keys.id = spaces.key_id WHERE spaces.name = ?`,
+		space,
+	).Scan(&key.ID, &kdf, &salt, &check)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("space %v is not encrypted", space)
+	} else if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	key.Key, err = deriveKey(kdf, passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkKey(key.Key, check); err != nil {
+		return nil, fmt.Errorf("space %v: %w", space, err)
+	}
+	return &key, nil
+}
+
+// Unlock makes the notes encrypted with the key readable, and lets notes be added
+// to its space. It is an error if the key does not match its key check.
+func (d *conn) Unlock(ctx context.Context, key SpaceKey) error {
+	var check []byte
+	err := d.db.QueryRowContext(ctx, "SELECT key_check FROM space_keys WHERE id = ?", key.ID).Scan(&check)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("key %v: %w", key.ID, ErrNotFound)
+	} else if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+
+	aead, err := checkKey(key.Key, check)
+	if err != nil {
+		return err
+	}
+	d.keys.add(key.ID, aead)
+	return nil
+}
+
+// Lock forgets the key of an encrypted space, so that its notes are hidden again
+func (d *conn) Lock(ctx context.Context, space string) error {
+	var keyID sql.NullInt64
+	err := d.db.QueryRowContext(ctx, "SELECT key_id FROM spaces WHERE name = ?", space).Scan(&keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("space %v: %w", space, ErrNotFound)
+	} else if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	} else if !keyID.Valid {
+		return fmt.Errorf("space %v is not encrypted", space)
+	}
+
+	d.keys.remove(keyID.Int64)
+	return nil
+}
+
+// encryptWith encrypts content with the key selected by query, if there is one.
+// The query must return a single row, with the key id or NULL.
+func (d *conn) encryptWith(ctx context.Context, content string, query string, args ...any) (string, sql.NullInt64, error) {
+	var keyID sql.NullInt64
+	if err := d.db.QueryRowContext(ctx, query, args...).Scan(&keyID); err != nil {
+		return "", keyID, fmt.Errorf("query error: %w", err)
+	}
+	if !keyID.Valid {
+		return content, keyID, nil
+	}
+
+	encrypted, err := d.keys.encrypt(keyID.Int64, content)
+	return encrypted, keyID, err
+}
+
+// decrypt returns content as is, unless it is encrypted
+func (d *conn) decrypt(content string, keyID sql.NullInt64) (string, error) {
+	if !keyID.Valid {
+		return content, nil
+	}
+	return d.keys.decrypt(keyID.Int64, content)
+}
+
+// unlockedCondition excludes the notes that are encrypted with a locked key
+func (d *conn) unlockedCondition() (string, []any) {
+	ids := d.keys.unlocked()
+	if len(ids) == 0 {
+		return "notes.key_id IS NULL", nil
+	}
+	bracketQ := strings.Join(repeatString("?", len(ids)), ", ")
+	return fmt.Sprintf("(notes.key_id IS NULL OR notes.key_id IN (%v))", bracketQ), sliceToAny(ids)
+}
+
+// sealed runs fn in a transaction, and encrypts the notes it moved into encrypted spaces
+func (d *conn) sealed(ctx context.Context, fn func(c *conn) error) error {
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&conn{db: tx, keys: d.keys, compact: d.compact}); err != nil {
+		return err
+	}
+	sealed, err := d.keys.seal(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return d.commitSealed(ctx, tx, sealed)
+}
+
+// commitSealed commits tx and, if it sealed any plaintext, compacts the database so that
+// the plaintext is not left in the search index or in free pages. Within a Tx, the
+// database is compacted once the Tx is committed.
+func (d *conn) commitSealed(ctx context.Context, tx *txn, sealed int) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if sealed == 0 {
+		return nil
+	}
+	if d.compact != nil {
+		*d.compact = true
+		return nil
+	}
+	db, ok := d.db.(*sql.DB)
+	if !ok {
+		return nil
+	}
+	return compact(ctx, db)
+}
+
+func deriveKey(kdf, passphrase string, salt []byte) ([]byte, error) {
+	var n, r, p int
+	if _, err := fmt.Sscanf(kdf, "scrypt:%d:%d:%d", &n, &r, &p); err != nil {
+		return nil, fmt.Errorf("unsupported key derivation: %v", kdf)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	return key, nil
+}
+
+// checkKey returns the cipher of key, if it decrypts the key check
+func checkKey(key []byte, check []byte) (cipher.AEAD, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if text, err := openText(aead, check); err != nil || string(text) != keyCheckText {
+		return nil, ErrWrongPassphrase
+	}
+	return aead, nil
+}
+
+// newAEAD returns AES-256 in GCM mode
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealText encrypts text, the nonce is prepended to the ciphertext
+func sealText(aead cipher.AEAD, text []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(text)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, text, nil), nil
+}
+
+func openText(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// Compact rebuilds the search index and vacuums the database, so that no
+// previous content is left behind, for example after a space is encrypted.
+// Operations that encrypt existing notes do this themselves.
+func (d *DB) Compact(ctx context.Context) error {
+	return compact(ctx, d.sqlDB)
+}
+
+func compact(ctx context.Context, db *sql.DB) error {
+	available, err := hasSearchIndex(ctx, db)
+	if err != nil {
+		return err
+	}
+	if available {
+		if err := (&conn{db: db}).syncSearchIndex(ctx); err != nil {
+			return err
+		}
+		if _, err := db.ExecContext(ctx, rebuildSearchSql); err != nil {
+			return fmt.Errorf("rebuild search index: %w", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPassphrase = "correct horse"
+
+// newTestDB creates a database in a temporary directory, and returns it with its path
+func newTestDB(t *testing.T) (*DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "note.db")
+	if _, err := CreateDb(path); err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	d, err := Open(path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, path
+}
+
+func addTestNote(t *testing.T, d *DB, space, content string) int {
+	t.Helper()
+
+	id, err := d.AddNote(context.Background(), Note{Space: space, Content: content}, false)
+	if err != nil {
+		t.Fatalf("add note to %v: %v", space, err)
+	}
+	return int(id)
+}
+
+// assertNoPlaintext checks that secret is in none of the tables that hold content,
+// nor anywhere in the database file
+func assertNoPlaintext(t *testing.T, d *DB, path, secret string) {
+	t.Helper()
+	ctx := context.Background()
+
+	queries := map[string]string{
+		"SELECT COUNT(*) FROM notes WHERE instr(content, ?) > 0":                  secret,
+		"SELECT COUNT(*) FROM note_revisions WHERE instr(content, ?) > 0":         secret,
+		"SELECT COUNT(*) FROM attachments WHERE instr(CAST(data AS TEXT), ?) > 0": secret,
+	}
+	if ok, err := hasSearchIndex(ctx, d.db); err != nil {
+		t.Fatalf("search index: %v", err)
+	} else if ok {
+		if err := d.syncSearchIndex(ctx); err != nil {
+			t.Fatalf("sync search index: %v", err)
+		}
+		queries["SELECT COUNT(*) FROM notes_fts WHERE instr(content, ?) > 0"] = secret
+		queries["SELECT COUNT(*) FROM notes_fts WHERE notes_fts MATCH ?"] = quoteFts(secret)
+	}
+	for query, arg := range queries {
+		var count int
+		if err := d.db.QueryRowContext(ctx, query, arg).Scan(&count); err != nil {
+			t.Fatalf("%v: %v", query, err)
+		}
+		if count > 0 {
+			t.Errorf("%v: found %v rows with plaintext %q", query, count, secret)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read db: %v", err)
+	}
+	if bytes.Contains(data, []byte(secret)) {
+		t.Errorf("database file contains plaintext %q", secret)
+	}
+}
+
+func TestEncryptSpace(t *testing.T) {
+	ctx := context.Background()
+	d, path := newTestDB(t)
+
+	id := addTestNote(t, d, "secret", "first draft of the plan")
+	if err := d.ReplaceContent(ctx, id, "the plan is swordfish"); err != nil {
+		t.Fatalf("replace content: %v", err)
+	}
+	_, err := d.AddAttachment(ctx, Attachment{NoteID: id, Filename: "plan.txt", Data: []byte("attached blueprint")}, false)
+	if err != nil {
+		t.Fatalf("add attachment: %v", err)
+	}
+	public := addTestNote(t, d, "main", "public announcement")
+
+	if err := d.EncryptSpace(ctx, "secret", testPassphrase); err != nil {
+		t.Fatalf("encrypt space: %v", err)
+	}
+	for _, secret := range []string{"swordfish", "first draft", "blueprint"} {
+		assertNoPlaintext(t, d, path, secret)
+	}
+
+	// The space is unlocked after it is encrypted
+	note, err := d.GetNote(ctx, id)
+	if err != nil {
+		t.Fatalf("get note: %v", err)
+	} else if note.Content != "the plan is swordfish" {
+		t.Errorf("got content %q", note.Content)
+	}
+	revisions, err := d.Revisions(ctx, id)
+	if err != nil {
+		t.Fatalf("revisions: %v", err)
+	} else if len(revisions) != 1 || revisions[0].Content != "first draft of the plan" {
+		t.Errorf("got revisions %+v", revisions)
+	}
+	attachments, err := d.Attachments(ctx, id, true)
+	if err != nil {
+		t.Fatalf("attachments: %v", err)
+	} else if len(attachments) != 1 || string(attachments[0].Data) != "attached blueprint" || !attachments[0].Encrypted {
+		t.Errorf("got attachments %+v", attachments)
+	}
+
+	// Other spaces are left as they were
+	var keyID *int64
+	if err := d.db.QueryRowContext(ctx, "SELECT key_id FROM notes WHERE id = ?", public).Scan(&keyID); err != nil {
+		t.Fatalf("query: %v", err)
+	} else if keyID != nil {
+		t.Errorf("note %v in main was encrypted", public)
+	}
+
+	if err := d.EncryptSpace(ctx, "secret", "another"); err == nil {
+		t.Errorf("encrypted space %v twice", "secret")
+	}
+	if err := d.EncryptSpace(ctx, TrashSpace, testPassphrase); err == nil {
+		t.Errorf("encrypted the %v space", TrashSpace)
+	}
+	if err := d.EncryptSpace(ctx, "empty", ""); err == nil {
+		t.Errorf("encrypted a space without a passphrase")
+	}
+}
+
+func TestLockUnlock(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDB(t)
+
+	if err := d.EncryptSpace(ctx, "secret", testPassphrase); err != nil {
+		t.Fatalf("encrypt space: %v", err)
+	}
+	id := addTestNote(t, d, "secret", "hidden treasure")
+	_, err := d.AddAttachment(ctx, Attachment{NoteID: id, Filename: "map.txt", Data: []byte("x marks the spot")}, false)
+	if err != nil {
+		t.Fatalf("add attachment: %v", err)
+	}
+
+	if err := d.Lock(ctx, "secret"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if _, err := d.GetNote(ctx, id); !errors.Is(err, ErrLocked) {
+		t.Errorf("get locked note: got %v, want %v", err, ErrLocked)
+	}
+	if _, err := d.Attachments(ctx, id, true); !errors.Is(err, ErrLocked) {
+		t.Errorf("attachments of locked note: got %v, want %v", err, ErrLocked)
+	}
+	if _, err := d.AddNote(ctx, Note{Space: "secret", Content: "more"}, false); !errors.Is(err, ErrLocked) {
+		t.Errorf("add to locked space: got %v, want %v", err, ErrLocked)
+	}
+	notes, err := d.SelectNotes(ctx, []string{"secret"}, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("select notes: %v", err)
+	} else if len(notes) != 0 {
+		t.Errorf("listed %v locked notes", len(notes))
+	}
+
+	if err := d.Lock(ctx, "main"); err == nil {
+		t.Errorf("locked a space that is not encrypted")
+	}
+	if _, err := d.DeriveSpaceKey(ctx, "secret", "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("derive key: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	if err := d.Unlock(ctx, SpaceKey{ID: 1, Key: make([]byte, 32)}); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("unlock with wrong key: got %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	key, err := d.DeriveSpaceKey(ctx, "secret", testPassphrase)
+	if err != nil {
+		t.Fatalf("derive key: %v", err)
+	}
+	if err := d.Unlock(ctx, *key); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	note, err := d.GetNote(ctx, id)
+	if err != nil {
+		t.Fatalf("get note: %v", err)
+	} else if note.Content != "hidden treasure" {
+		t.Errorf("got content %q", note.Content)
+	}
+	attachments, err := d.Attachments(ctx, id, true)
+	if err != nil {
+		t.Fatalf("attachments: %v", err)
+	} else if len(attachments) != 1 || string(attachments[0].Data) != "x marks the spot" {
+		t.Errorf("got attachments %+v", attachments)
+	}
+}
+
+func TestMoveEncrypted(t *testing.T) {
+	ctx := context.Background()
+	d, path := newTestDB(t)
+
+	if err := d.EncryptSpace(ctx, "secret", testPassphrase); err != nil {
+		t.Fatalf("encrypt space: %v", err)
+	}
+	moved := addTestNote(t, d, "main", "meet at the lighthouse")
+	if err := d.ReplaceContent(ctx, moved, "meet at the old mill"); err != nil {
+		t.Fatalf("replace content: %v", err)
+	}
+	_, err := d.AddAttachment(ctx, Attachment{NoteID: moved, Filename: "route.txt", Data: []byte("take the river path")}, false)
+	if err != nil {
+		t.Fatalf("add attachment: %v", err)
+	}
+	updated := addTestNote(t, d, "main", "password is hunter2")
+	inTx := addTestNote(t, d, "main", "launch codes 0000")
+
+	// Moved into the encrypted space
+	if err := d.MoveNote(ctx, moved, "secret"); err != nil {
+		t.Fatalf("move note: %v", err)
+	}
+	note, err := d.GetNote(ctx, updated)
+	if err != nil {
+		t.Fatalf("get note: %v", err)
+	}
+	note.Space = "secret"
+	if err := d.UpdateNote(ctx, *note); err != nil {
+		t.Fatalf("update note: %v", err)
+	}
+	err = d.WithTx(ctx, func(tx *Tx) error {
+		return tx.MoveNotes(ctx, []int{inTx}, "secret")
+	})
+	if err != nil {
+		t.Fatalf("move notes in transaction: %v", err)
+	}
+	for _, secret := range []string{"lighthouse", "old mill", "river path", "hunter2", "launch codes"} {
+		assertNoPlaintext(t, d, path, secret)
+	}
+
+	// Moved out of it, the notes stay encrypted with the key of the space
+	if err := d.MoveNotes(ctx, []int{moved, updated}, "main"); err != nil {
+		t.Fatalf("move notes: %v", err)
+	}
+	note, err = d.GetNote(ctx, moved)
+	if err != nil {
+		t.Fatalf("get note: %v", err)
+	} else if note.Space != "main" || note.Content != "meet at the old mill" {
+		t.Errorf("got note %+v", note)
+	}
+	assertNoPlaintext(t, d, path, "old mill")
+
+	if err := d.Lock(ctx, "secret"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	for _, id := range []int{moved, updated} {
+		if _, err := d.GetNote(ctx, id); !errors.Is(err, ErrLocked) {
+			t.Errorf("get note %v: got %v, want %v", id, err, ErrLocked)
+		}
+	}
+}
+
+func TestEncryptedLinks(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDB(t)
+
+	target := addTestNote(t, d, "main", "target")
+	link := fmt.Sprintf("see [[%v]]", target)
+	sealed := addTestNote(t, d, "secret", link)
+	if err := d.EncryptSpace(ctx, "secret", testPassphrase); err != nil {
+		t.Fatalf("encrypt space: %v", err)
+	}
+	added := addTestNote(t, d, "secret", link)
+	edited := addTestNote(t, d, "secret", "nothing yet")
+	if err := d.ReplaceContent(ctx, edited, link); err != nil {
+		t.Fatalf("replace content: %v", err)
+	}
+
+	for _, id := range []int{sealed, added, edited} {
+		links, err := d.OutgoingLinks(ctx, id)
+		if err != nil {
+			t.Fatalf("outgoing links: %v", err)
+		} else if len(links) != 0 {
+			t.Errorf("encrypted note %v has links %v", id, links)
+		}
+	}
+	backlinks, err := d.Backlinks(ctx, []int{target})
+	if err != nil {
+		t.Fatalf("backlinks: %v", err)
+	} else if len(backlinks) != 0 {
+		t.Errorf("got backlinks %v", backlinks)
+	}
+}
+
+func TestLockedTrash(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDB(t)
+
+	if err := d.EncryptSpace(ctx, "secret", testPassphrase); err != nil {
+		t.Fatalf("encrypt space: %v", err)
+	}
+	locked := addTestNote(t, d, "secret", "locked away")
+	plain := addTestNote(t, d, "main", "in plain sight")
+	if err := d.TrashNotes(ctx, []int{locked, plain}); err != nil {
+		t.Fatalf("trash notes: %v", err)
+	}
+	if err := d.Lock(ctx, "secret"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	trashed, err := d.SelectTrash(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("select trash: %v", err)
+	} else if len(trashed) != 1 || trashed[0].ID != plain {
+		t.Errorf("got trash %+v", trashed)
+	}
+	if count, err := d.LockedTrash(ctx, time.Time{}); err != nil {
+		t.Fatalf("locked trash: %v", err)
+	} else if count != 1 {
+		t.Errorf("got %v locked notes in trash, want 1", count)
+	}
+	if count, err := d.LockedTrash(ctx, time.Now().Add(-week)); err != nil {
+		t.Fatalf("locked trash: %v", err)
+	} else if count != 0 {
+		t.Errorf("got %v locked notes trashed a week ago, want 0", count)
+	}
+
+	key, err := d.DeriveSpaceKey(ctx, "secret", testPassphrase)
+	if err != nil {
+		t.Fatalf("derive key: %v", err)
+	}
+	if err := d.Unlock(ctx, *key); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if count, err := d.LockedTrash(ctx, time.Time{}); err != nil {
+		t.Fatalf("locked trash: %v", err)
+	} else if count != 0 {
+		t.Errorf("got %v locked notes in unlocked trash, want 0", count)
+	}
+}
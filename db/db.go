@@ -22,20 +22,130 @@ THE SOFTWARE.
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 )
 
 type DB struct {
-	db *sql.DB
+	conn
+	sqlDB *sql.DB
+}
+
+// Tx is a transaction, with the same note operations as DB. See DB.WithTx.
+type Tx struct {
+	conn
+}
+
+// conn implements the note operations on either a database or a transaction
+type conn struct {
+	db   querier
+	keys *keyring
+
+	// compact is set within a Tx, when the database is to be compacted after commit
+	compact *bool
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 func (d *DB) Close() error {
-	return d.db.Close()
+	return d.sqlDB.Close()
+}
+
+// WithTx runs fn in a transaction, which is committed if fn returns nil and rolled
+// back otherwise. Operations that fail within the transaction leave it unchanged.
+func (d *DB) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := d.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	compact := false
+	if err := fn(&Tx{conn{db: tx, keys: d.keys, compact: &compact}}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if compact {
+		return d.Compact(ctx)
+	}
+	return nil
+}
+
+// txn is the transaction of a single operation. Within a Tx, it is a savepoint,
+// so that a failed operation is rolled back without ending the transaction.
+type txn struct {
+	querier
+	ctx  context.Context
+	tx   *sql.Tx // nil for a savepoint
+	done bool
 }
 
+func (d *conn) begin(ctx context.Context) (*txn, error) {
+	switch db := d.db.(type) {
+	case *sql.DB:
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &txn{querier: tx, ctx: ctx, tx: tx}, nil
+	default:
+		if _, err := db.ExecContext(ctx, "SAVEPOINT operation"); err != nil {
+			return nil, err
+		}
+		return &txn{querier: db, ctx: ctx}, nil
+	}
+}
+
+func (t *txn) Commit() error {
+	if t.tx != nil {
+		return t.tx.Commit()
+	}
+	t.done = true
+	_, err := t.ExecContext(t.ctx, "RELEASE operation")
+	return err
+}
+
+// Rollback does nothing after Commit, so it can be deferred
+func (t *txn) Rollback() error {
+	if t.tx != nil {
+		return t.tx.Rollback()
+	}
+	if t.done {
+		return nil
+	}
+	t.done = true
+	if _, err := t.ExecContext(t.ctx, "ROLLBACK TO operation"); err != nil {
+		return err
+	}
+	_, err := t.ExecContext(t.ctx, "RELEASE operation")
+	return err
+}
+
+// Open an existing database and apply any pending schema migrations
 func Open(path string) (*DB, error) {
+	db, err := OpenUnmigrated(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return db, nil
+}
+
+// OpenUnmigrated opens an existing database, without touching the schema.
+func OpenUnmigrated(path string) (*DB, error) {
 	s, err := os.Stat(path)
 	if os.IsNotExist(err) {
 		return nil, fmt.Errorf("file does not exist: %v", path)
@@ -47,9 +157,11 @@ func Open(path string) (*DB, error) {
 }
 
 func open(path string) (*DB, error) {
-	db, err := sql.Open("sqlite3", path)
+	// Foreign keys are needed to cascade deletes of notes.
+	// The busy timeout lets concurrent writers (like note serve) wait for each other.
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
-	return &DB{db: db}, nil
+	return &DB{conn: conn{db: db, keys: newKeyring()}, sqlDB: db}, nil
 }
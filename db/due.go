@@ -0,0 +1,57 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	addDueColumnSql      = "ALTER TABLE notes ADD COLUMN due DATETIME;"
+	addRemindAtColumnSql = "ALTER TABLE notes ADD COLUMN remind_at DATETIME;"
+	createDueIndexSql    = "CREATE INDEX IF NOT EXISTS notes_due ON notes (due) WHERE due IS NOT NULL;"
+	createRemindIndexSql = "CREATE INDEX IF NOT EXISTS notes_remind_at ON notes (remind_at) WHERE remind_at IS NOT NULL;"
+)
+
+// SetDue sets the due date of notes, or removes it if due is nil
+func (d *conn) SetDue(ctx context.Context, ids []int, due *time.Time) error {
+	return d.setTime(ctx, "due", ids, due)
+}
+
+// SetReminder sets the time of the reminder of notes, or removes it if at is nil
+func (d *conn) SetReminder(ctx context.Context, ids []int, at *time.Time) error {
+	return d.setTime(ctx, "remind_at", ids, at)
+}
+
+func (d *conn) setTime(ctx context.Context, column string, ids []int, t *time.Time) error {
+	if len(ids) < 1 {
+		return fmt.Errorf("must provide ids")
+	}
+
+	bracketQ := strings.Join(repeatString("?", len(ids)), ", ")
+	query := fmt.Sprintf("UPDATE notes SET %v = ? WHERE id IN (%v)", column, bracketQ)
+
+	return d.execIDs(ctx, "updated", query, ids, formatNullTime(t))
+}
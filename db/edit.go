@@ -22,19 +22,66 @@ THE SOFTWARE.
 package db
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
-func (d *DB) ReplaceContent(id int, content string) error {
-	return d.updateRow("UPDATE notes SET content = ? WHERE id = ?", content, id)
+const (
+	// The last updated timestamp is only set automatically, if an update does not set it
+	createTriggerExplicitUpdateSql = `CREATE TRIGGER notes_auto_last_updated
+		AFTER UPDATE ON notes
+		FOR EACH ROW WHEN NEW.last_updated IS OLD.last_updated
+		BEGIN
+			UPDATE notes SET last_updated = CURRENT_TIMESTAMP WHERE id = OLD.id;
+		END;`
+)
+
+// ReplaceContent changes the content of a note, an encrypted note stays encrypted
+func (d *conn) ReplaceContent(ctx context.Context, id int, content string) error {
+	stored, keyID, err := d.encryptWith(ctx, content, "SELECT (SELECT key_id FROM notes WHERE id = ?)", id)
+	if err != nil {
+		return fmt.Errorf("note %v: %w", id, err)
+	}
+	_, err = d.linked(ctx, content, func(c *conn) (int64, error) {
+		return int64(id), c.updateRow(ctx, id, "UPDATE notes SET content = ?, key_id = ? WHERE id = ?", stored, keyID)
+	})
+	return err
 }
 
-func (d *DB) MoveNote(id int, toSpace string) error {
-	return d.updateRow("UPDATE notes SET space = ? WHERE id = ?", toSpace, id)
+func (d *conn) MoveNote(ctx context.Context, id int, toSpace string) error {
+	return d.sealed(ctx, func(c *conn) error {
+		return c.updateRow(ctx, id, "UPDATE notes SET space = ? WHERE id = ?", toSpace)
+	})
+}
+
+// UpdateNote replaces all values of a note, including the timestamps, but not the tags.
+// An encrypted note is encrypted with the key of its space or, failing that, the key it had.
+// A plaintext note is encrypted if it is moved to an encrypted space.
+func (d *conn) UpdateNote(ctx context.Context, note Note) error {
+	dbN := toDbNote(note)
+	content, keyID, err := d.encryptWith(ctx, dbN.Content,
+		`SELECT CASE WHEN (SELECT key_id FROM notes WHERE id = ?) IS NOT NULL
+			THEN COALESCE((SELECT key_id FROM spaces WHERE name = ?), (SELECT key_id FROM notes WHERE id = ?))
+		END`,
+		note.ID, dbN.Space, note.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("note %v: %w", note.ID, err)
+	}
+	return d.sealed(ctx, func(c *conn) error {
+		_, err := c.linked(ctx, note.Content, func(c *conn) (int64, error) {
+			return int64(note.ID), c.updateRow(ctx, note.ID,
+				`UPDATE notes SET space = ?, created = ?, last_updated = ?, content = ?, pinned = ?, key_id = ?,
+				due = ?, remind_at = ? WHERE id = ?`,
+				dbN.Space, dbN.Created, dbN.LastUpdated, content, dbN.Pinned, keyID, dbN.Due, dbN.RemindAt,
+			)
+		})
+		return err
+	})
 }
 
-func (d *DB) MoveNotes(ids []int, toSpace string) error {
+func (d *conn) MoveNotes(ctx context.Context, ids []int, toSpace string) error {
 	count := len(ids)
 	if count < 1 {
 		return fmt.Errorf("require at least one id")
@@ -50,28 +97,13 @@ func (d *DB) MoveNotes(ids []int, toSpace string) error {
 		bracketQ,
 	)
 
-	// Execute
-	execParams := sliceToAny(ids)
-	execParams = prepend(execParams, any(toSpace))
-	result, err := d.db.Exec(query, execParams...)
-	if err != nil {
-		return fmt.Errorf("exec: %w", err)
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows: %w", err)
-	}
-
-	// Validate
-	if rows != int64(count) {
-		return fmt.Errorf("only %v out of %v was moved successfully", rows, count)
-	}
-
-	return nil
+	// Execute, notes moved to an encrypted space are encrypted
+	return d.sealed(ctx, func(c *conn) error {
+		return c.execIDs(ctx, "moved", query, ids, toSpace)
+	})
 }
 
-func (d *DB) PinNotes(ids []int, pinned bool) error {
+func (d *conn) PinNotes(ctx context.Context, ids []int, pinned bool) error {
 	count := len(ids)
 	if count < 1 {
 		return fmt.Errorf("must provide ids")
@@ -93,7 +125,12 @@ func (d *DB) PinNotes(ids []int, pinned bool) error {
 	)
 
 	// Execute
-	result, err := d.db.Exec(query, sliceToAny(ids)...)
+	return d.execIDs(ctx, "pinned", query, ids)
+}
+
+// updateRow executes a query that modifies the note with id, which is the last parameter
+func (d *conn) updateRow(ctx context.Context, id int, query string, args ...any) error {
+	result, err := d.db.ExecContext(ctx, query, append(args, id)...)
 	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
@@ -103,16 +140,23 @@ func (d *DB) PinNotes(ids []int, pinned bool) error {
 		return fmt.Errorf("rows: %w", err)
 	}
 
-	// Validate
-	if rows != int64(count) {
-		return fmt.Errorf("only %v out of %v was pinned successfully", rows, count)
+	if rows != 1 {
+		return &NotFoundError{IDs: []int{id}}
 	}
 
 	return nil
 }
 
-func (d *DB) updateRow(query string, args ...any) error {
-	result, err := d.db.Exec(query, args...)
+// execIDs executes a query that modifies the notes with ids, which are the last parameters.
+// Unless all of the notes are modified, the transaction is rolled back and a PartialError is returned.
+func (d *conn) execIDs(ctx context.Context, op string, query string, ids []int, args ...any) error {
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, append(args, sliceToAny(ids)...)...)
 	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
@@ -122,13 +166,9 @@ func (d *DB) updateRow(query string, args ...any) error {
 		return fmt.Errorf("rows: %w", err)
 	}
 
-	if rows != 1 {
-		return fmt.Errorf("nothing was modified")
+	if rows != int64(len(ids)) {
+		return &PartialError{Op: op, Affected: rows, Expected: int64(len(ids))}
 	}
 
-	return nil
-}
-
-func prepend[T any](slice []T, element T) []T {
-	return append([]T{element}, slice...)
+	return tx.Commit()
 }
@@ -0,0 +1,68 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned when a note, or a revision of one, does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrExists is returned when a note is added with an ID that is already taken
+var ErrExists = errors.New("already exists")
+
+// ErrLocked is returned when a note is encrypted with the key of a space that is not unlocked
+var ErrLocked = errors.New("encrypted and locked")
+
+// ErrWrongPassphrase is returned when a key does not match the key check of a space
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// NotFoundError lists the ids that did not exist, it matches ErrNotFound
+type NotFoundError struct {
+	IDs []int
+}
+
+func (e *NotFoundError) Error() string {
+	if len(e.IDs) == 1 {
+		return fmt.Sprintf("note %v does not exist", e.IDs[0])
+	}
+	return fmt.Sprintf("the following ids did not exist: %v", strings.Join(manyIntToString(e.IDs), ", "))
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// PartialError is returned when only some of the requested notes were modified.
+// Operations running in a transaction are rolled back before it is returned.
+type PartialError struct {
+	Op       string
+	Affected int64
+	Expected int64
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("only %v out of %v was %v successfully", e.Affected, e.Expected, e.Op)
+}
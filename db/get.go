@@ -22,6 +22,9 @@ THE SOFTWARE.
 package db
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -33,7 +36,7 @@ type Scanner interface {
 	Scan(dest ...any) error
 }
 
-func (d *DB) GetIDs(spaces []string, ascending bool) ([]int, error) {
+func (d *conn) GetIDs(ctx context.Context, spaces []string, ascending bool) ([]int, error) {
 	var (
 		params      = make([]any, 0)
 		spacesWhere = ""
@@ -52,7 +55,7 @@ func (d *DB) GetIDs(spaces []string, ascending bool) ([]int, error) {
 	query := fmt.Sprintf("SELECT id FROM notes %v %v", spacesWhere, orderBy)
 
 	// Query
-	rows, err := d.db.Query(query, params...)
+	rows, err := d.db.QueryContext(ctx, query, params...)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %w", err)
 	}
@@ -69,22 +72,24 @@ func (d *DB) GetIDs(spaces []string, ascending bool) ([]int, error) {
 		ids = append(ids, id)
 	}
 
-	return ids, nil
+	return ids, rows.Err()
 }
 
-func (d *DB) GetNote(id int) (*Note, error) {
+func (d *conn) GetNote(ctx context.Context, id int) (*Note, error) {
 	query := fmt.Sprintf("SELECT %v FROM notes WHERE id = ?", allNoteColumns)
-	row := d.db.QueryRow(query, id)
+	row := d.db.QueryRowContext(ctx, query, id)
 
-	note, err := scanNote(row)
-	if err != nil {
+	note, err := d.scanNote(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &NotFoundError{IDs: []int{id}}
+	} else if err != nil {
 		return nil, err
 	}
 
 	return note, nil
 }
 
-func (d *DB) GetNotes(ids []int) (Notes, error) {
+func (d *conn) GetNotes(ctx context.Context, ids []int) (Notes, error) {
 	count := len(ids)
 	if count < 1 {
 		return nil, fmt.Errorf("require at least one id")
@@ -108,7 +113,7 @@ func (d *DB) GetNotes(ids []int) (Notes, error) {
 
 	// Query with ids as []any
 	idsAsAny := sliceToAny(ids)
-	rows, err := d.db.Query(query, idsAsAny...)
+	rows, err := d.db.QueryContext(ctx, query, idsAsAny...)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %w", err)
 	}
@@ -117,8 +122,8 @@ func (d *DB) GetNotes(ids []int) (Notes, error) {
 	// Parse results
 	notes := make(Notes, 0)
 	for rows.Next() {
-		note, err := scanNote(rows)
-		if err != err {
+		note, err := d.scanNote(rows)
+		if err != nil {
 			return nil, err
 		}
 		notes = append(notes, *note)
@@ -127,25 +132,29 @@ func (d *DB) GetNotes(ids []int) (Notes, error) {
 	// If we did not get all id's, figure out which ones where not found
 	if len(notes) != count {
 		outIds := notes.GetIDs()
-		diff := difference(ids, outIds)
-		idStrs := manyIntToString(diff)
-		joined := strings.Join(idStrs, ", ")
-		return nil, fmt.Errorf("the following ids did not exist: %v", joined)
+		return nil, &NotFoundError{IDs: difference(ids, outIds)}
 	}
 
 	return notes, nil
 }
 
-func scanNote(scanner Scanner) (*Note, error) {
+// scanNote scans the columns in allNoteColumns, followed by any extra columns.
+// Encrypted content is decrypted, if the key is unlocked.
+func (d *conn) scanNote(scanner Scanner, extra ...any) (*Note, error) {
 	var dbN dbNote
-	err := scanner.Scan(
+	dest := []any{
 		&dbN.ID,
 		&dbN.Space,
 		&dbN.Created,
 		&dbN.LastUpdated,
 		&dbN.Content,
 		&dbN.Pinned,
-	)
+		&dbN.Tags,
+		&dbN.KeyID,
+		&dbN.Due,
+		&dbN.RemindAt,
+	}
+	err := scanner.Scan(append(dest, extra...)...)
 
 	if err != nil {
 		return nil, fmt.Errorf("scan error: %w", err)
@@ -156,6 +165,11 @@ func scanNote(scanner Scanner) (*Note, error) {
 		return nil, fmt.Errorf("conversion error: %w", err)
 	}
 
+	out.Content, err = d.decrypt(dbN.Content, dbN.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("note %v: %w", dbN.ID, err)
+	}
+
 	return out, nil
 }
 
@@ -21,44 +21,140 @@ THE SOFTWARE.
 */
 package db
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+)
 
-type NoteIterator struct {
-	Note
-	Err error
-}
-
-func (d *DB) IterateNotes(spaces []string, all bool, sortOpts *SortOpts) <-chan NoteIterator {
-	ch := make(chan NoteIterator)
-
-	go func() {
-		defer close(ch)
+const (
+	DefaultBatchSize = 100
+)
 
-		page := 0
-		pageOpts := &PageOpts{
-			Limit: 10,
+// IterateNotes streams the notes of a selection, reading batchSize notes at a time
+// (DefaultBatchSize if zero). The batches are fetched with a keyset cursor on
+// (pinned, sort column, id), so the cost of a batch does not grow with its position.
+// Iteration stops at the first error, which is yielded, or when ctx is done.
+func (d *conn) IterateNotes(ctx context.Context, spaces []string, all bool, sortOpts *SortOpts, filterOpts *FilterOpts, batchSize int) iter.Seq2[Note, error] {
+	return func(yield func(Note, error) bool) {
+		if sortOpts == nil {
+			defaultOpts := DefaultSortOpts()
+			sortOpts = &defaultOpts
+		}
+		if batchSize <= 0 {
+			batchSize = DefaultBatchSize
+		}
+		if err := sortOpts.Check(); err != nil {
+			yield(Note{}, err)
+			return
+		}
+		if filterOpts != nil {
+			if err := filterOpts.Check(); err != nil {
+				yield(Note{}, err)
+				return
+			}
 		}
 
+		var cursor []any // pinned, sort column and id of the last note
 		for {
-			notes, err := d.SelectNotes(spaces, all, sortOpts, pageOpts)
-			if err != nil {
-				fmt.Printf("Error: %v", err.Error())
-				ch <- NoteIterator{Err: err}
+			if err := ctx.Err(); err != nil {
+				yield(Note{}, err)
 				return
 			}
 
-			if len(notes) == 0 {
+			notes, read, last, err := d.selectBatch(ctx, spaces, all, sortOpts, filterOpts, cursor, batchSize)
+			if err != nil {
+				yield(Note{}, err)
 				return
 			}
 
 			for _, note := range notes {
-				ch <- NoteIterator{Note: note}
+				if !yield(note, nil) {
+					return
+				}
+			}
+
+			if read < batchSize {
+				return
 			}
+			cursor = last
+		}
+	}
+}
+
+// selectBatch reads at most limit rows after the cursor, which is nil for the first batch.
+// It returns the notes that match, which are fewer than the rows read if encrypted notes
+// do not match the content filters. The rows are read in full before returning, so that
+// the caller is free to use the connection between batches.
+func (d *conn) selectBatch(ctx context.Context, spaces []string, all bool, sortOpts *SortOpts, filterOpts *FilterOpts, cursor []any, limit int) (Notes, int, []any, error) {
+	where, params := d.noteWhere(spaces, all, filterOpts)
+	filter := d.contentFilter(filterOpts)
+	if cursor != nil {
+		where += " AND " + keysetCondition(sortOpts)
+		pinned, value, id := cursor[0], cursor[1], cursor[2]
+		params = append(params, pinned, pinned, value, value, id)
+	}
+
+	columnOrder := orderString(sortOpts.Ascending)
+	query := fmt.Sprintf(
+		"SELECT %v, notes.pinned, notes.%v, notes.key_id IS NOT NULL FROM notes %v ORDER BY pinned %v, %v %v, notes.id %v LIMIT ?",
+		allNoteColumns, sortOpts.SortColumn, where,
+		orderString(!sortOpts.Ascending), sortOpts.SortColumn, columnOrder, columnOrder,
+	)
+	params = append(params, limit)
 
-			page += 1
-			pageOpts.Offset = pageOpts.Limit * page
+	rows, err := d.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		notes     = make(Notes, 0, limit)
+		read      = 0
+		lastID    int
+		pinned    any
+		value     any
+		encrypted bool
+	)
+	for rows.Next() {
+		note, err := d.scanNote(rows, &pinned, &value, &encrypted)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		read++
+		lastID = note.ID
+
+		if encrypted && filter != nil && !filter(note) {
+			continue
 		}
-	}()
+		notes = append(notes, *note)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, nil, fmt.Errorf("query error: %w", err)
+	}
+
+	if read == 0 {
+		return notes, 0, nil, nil
+	}
+	// The driver parses DATETIME columns, these are compared in the stored format
+	if t, ok := value.(time.Time); ok {
+		value = formatTime(t)
+	}
+	return notes, read, []any{pinned, value, lastID}, nil
+}
 
-	return ch
+// keysetCondition matches the notes that come after a cursor, ordered as in selectBatch.
+// Pinned notes are sorted in the opposite direction of the sort column, which is why
+// this can not be written as a single row value comparison.
+func keysetCondition(sortOpts *SortOpts) string {
+	after, pinnedAfter := ">", "<"
+	if !sortOpts.Ascending {
+		after, pinnedAfter = "<", ">"
+	}
+	return fmt.Sprintf(
+		"(notes.pinned %[1]v ? OR (notes.pinned = ? AND (notes.%[2]v %[3]v ? OR (notes.%[2]v = ? AND notes.id %[3]v ?))))",
+		pinnedAfter, sortOpts.SortColumn, after,
+	)
 }
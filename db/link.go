@@ -0,0 +1,208 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// A link may point to a note that does not exist (anymore), so the target is not a reference
+	createLinksTableSql = `CREATE TABLE IF NOT EXISTS links (
+		source_id INTEGER NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+		target_id INTEGER NOT NULL,
+		PRIMARY KEY (source_id, target_id));`
+
+	createLinksTargetIndexSql = `CREATE INDEX IF NOT EXISTS links_target ON links (target_id);`
+)
+
+// linkPattern matches links to other notes in content, as [[123]] or note:123
+var linkPattern = regexp.MustCompile(`\[\[(\d+)\]\]|\bnote:(\d+)\b`)
+
+// A Link is a reference from the content of one note to another note, by its ID
+type Link struct {
+	Source int
+	Target int
+}
+
+// ParseLinks returns the IDs of the notes linked from content, in order and without duplicates
+func ParseLinks(content string) []int {
+	ids := []int{}
+	for _, match := range linkPattern.FindAllStringSubmatch(content, -1) {
+		id, err := strconv.Atoi(match[1] + match[2])
+		if err != nil {
+			continue // too large to be an ID
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// OutgoingLinks lists the IDs linked from the content of a note, whether they exist or not
+func (d *conn) OutgoingLinks(ctx context.Context, id int) ([]int, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT target_id FROM links WHERE source_id = ? ORDER BY target_id", id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+// Backlinks lists the links to any of the notes, ordered by target and source.
+// Links from notes in the trash are not included.
+func (d *conn) Backlinks(ctx context.Context, ids []int) ([]Link, error) {
+	if len(ids) < 1 {
+		return nil, fmt.Errorf("require at least one id")
+	}
+
+	bracketQ := strings.Join(repeatString("?", len(ids)), ", ")
+	query := fmt.Sprintf(
+		`SELECT links.source_id, links.target_id FROM links
+		JOIN notes ON notes.id = links.source_id
+		WHERE links.target_id IN (%v) AND notes.space != ?
+		ORDER BY links.target_id, links.source_id`,
+		bracketQ,
+	)
+	rows, err := d.db.QueryContext(ctx, query, append(sliceToAny(ids), TrashSpace)...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	links := make([]Link, 0)
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Source, &link.Target); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// setLinks replaces the links of a note with the ones found in its content.
+// An encrypted note has no links, as they would reveal parts of its content.
+func setLinks(ctx context.Context, q querier, id int64, content string) error {
+	if _, err := q.ExecContext(ctx, "DELETE FROM links WHERE source_id = ?", id); err != nil {
+		return fmt.Errorf("remove links: %w", err)
+	}
+
+	var encrypted bool
+	err := q.QueryRowContext(ctx, "SELECT key_id IS NOT NULL FROM notes WHERE id = ?", id).Scan(&encrypted)
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	} else if encrypted {
+		return nil
+	}
+
+	for _, target := range ParseLinks(content) {
+		if int64(target) == id {
+			continue
+		}
+		_, err := q.ExecContext(ctx,
+			"INSERT INTO links (source_id, target_id) VALUES (?, ?)", id, target,
+		)
+		if err != nil {
+			return fmt.Errorf("insert link: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrateLinks creates the links table, from the content of the notes that are not encrypted
+func migrateLinks(ctx context.Context, tx *sql.Tx) error {
+	if err := execAll(createLinksTableSql, createLinksTargetIndexSql)(ctx, tx); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, content FROM notes WHERE key_id IS NULL")
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	contents := make(map[int64]string)
+	for rows.Next() {
+		var (
+			id      int64
+			content string
+		)
+		if err := rows.Scan(&id, &content); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+		if linkPattern.MatchString(content) {
+			contents[id] = content
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, content := range contents {
+		if err := setLinks(ctx, tx, id, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linked runs fn in a transaction, after which the links of the note with the id
+// returned by fn are replaced by the ones in content
+func (d *conn) linked(ctx context.Context, content string, fn func(c *conn) (int64, error)) (int64, error) {
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	id, err := fn(&conn{db: tx, keys: d.keys, compact: d.compact})
+	if err != nil {
+		return id, err
+	}
+	if err := setLinks(ctx, tx, id, content); err != nil {
+		return id, err
+	}
+	return id, tx.Commit()
+}
+
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
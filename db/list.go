@@ -22,8 +22,11 @@ THE SOFTWARE.
 package db
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -88,15 +91,75 @@ func (p *PageOpts) Check() error {
 	return nil
 }
 
-func (d *DB) SelectNotes(spaces []string, all bool, sortOpts *SortOpts, pageOpts *PageOpts) (Notes, error) {
+// FilterOpts narrows down a selection of notes. Zero values do not filter,
+// the since times are inclusive and the until times exclusive.
+type FilterOpts struct {
+	Tags      []string // notes must be tagged with all of these
+	Recursive bool     // include the spaces nested below the selected spaces
+
+	CreatedSince time.Time
+	CreatedUntil time.Time
+	UpdatedSince time.Time
+	UpdatedUntil time.Time
+
+	Pinned *bool // only pinned, or only unpinned notes
+
+	Due         bool // only notes with a due date
+	DueSince    time.Time
+	DueUntil    time.Time
+	Reminder    bool // only notes with a reminder
+	RemindUntil time.Time
+
+	MinID     int
+	MaxID     int
+	MinLength int // length of the content in characters
+	MaxLength int
+
+	Query Expr // see ParseQuery
+}
+
+func (f *FilterOpts) Check() error {
+	for _, tag := range f.Tags {
+		if tag == "" {
+			return fmt.Errorf("tag cannot be empty")
+		}
+	}
+	if !f.CreatedSince.IsZero() && !f.CreatedUntil.IsZero() && !f.CreatedSince.Before(f.CreatedUntil) {
+		return fmt.Errorf("created since must be before created until")
+	}
+	if !f.UpdatedSince.IsZero() && !f.UpdatedUntil.IsZero() && !f.UpdatedSince.Before(f.UpdatedUntil) {
+		return fmt.Errorf("updated since must be before updated until")
+	}
+	if !f.DueSince.IsZero() && !f.DueUntil.IsZero() && !f.DueSince.Before(f.DueUntil) {
+		return fmt.Errorf("due since must be before due until")
+	}
+	if f.MinID < 0 || f.MaxID < 0 {
+		return fmt.Errorf("id must be positive")
+	} else if f.MaxID > 0 && f.MinID > f.MaxID {
+		return fmt.Errorf("min id cannot be larger than max id")
+	}
+	if f.MinLength < 0 || f.MaxLength < 0 {
+		return fmt.Errorf("length must be positive")
+	} else if f.MaxLength > 0 && f.MinLength > f.MaxLength {
+		return fmt.Errorf("min length cannot be larger than max length")
+	}
+	return nil
+}
+
+func (d *conn) SelectNotes(ctx context.Context, spaces []string, all bool, sortOpts *SortOpts, pageOpts *PageOpts, filterOpts *FilterOpts) (Notes, error) {
 	var (
-		addParams     = []any{}
-		sortQueryAdd  = "ORDER BY pinned DESC" // By default we always sort pinned first
-		pageQueryAdd  = ""
-		spaceQueryAdd = ""
-		limit         = 0
+		sortQueryAdd = "ORDER BY pinned DESC" // By default we always sort pinned first
+		pageQueryAdd = ""
+		limit        = 0
 	)
 	// Check input
+	if filterOpts != nil {
+		if err := filterOpts.Check(); err != nil {
+			return nil, err
+		}
+	}
+	whereQueryAdd, addParams := d.noteWhere(spaces, all, filterOpts)
+	filter := d.contentFilter(filterOpts)
 	if sortOpts != nil {
 		if err := sortOpts.Check(); err != nil {
 			return nil, err
@@ -116,7 +179,8 @@ func (d *DB) SelectNotes(spaces []string, all bool, sortOpts *SortOpts, pageOpts
 			return nil, err
 		}
 
-		if pageOpts.Limit > 0 {
+		// Pages of filtered notes are taken after the encrypted notes are matched
+		if pageOpts.Limit > 0 && filter == nil {
 			pageQueryAdd = "LIMIT ? OFFSET ?"
 			addParams = append(addParams, pageOpts.Limit)
 			addParams = append(addParams, pageOpts.Offset)
@@ -124,28 +188,15 @@ func (d *DB) SelectNotes(spaces []string, all bool, sortOpts *SortOpts, pageOpts
 
 		limit = pageOpts.Limit
 	}
-	if len(spaces) > 0 { // Spaces slots
-		manyQuestions := repeatString("?", len(spaces))
-		bracketQ := strings.Join(manyQuestions, ", ")
-
-		spaceQueryAdd = fmt.Sprintf("WHERE space IN (%v)", bracketQ)
-		for _, space := range spaces {
-			addParams = append(addParams, space)
-		}
-	} else if !all {
-		// The caller has not specified individual spaces but also wants to hide notes
-		// from spaces starting with '.'
-		spaceQueryAdd = "WHERE space NOT LIKE '.%'"
-	}
 
 	// Prepare the SQL query
 	query := fmt.Sprintf(
-		"SELECT %v FROM notes %v %v %v",
-		allNoteColumns, spaceQueryAdd, sortQueryAdd, pageQueryAdd,
+		"SELECT %v, notes.key_id IS NOT NULL FROM notes %v %v %v",
+		allNoteColumns, whereQueryAdd, sortQueryAdd, pageQueryAdd,
 	)
 
 	// Execute the query
-	rows, err := d.db.Query(query, addParams...)
+	rows, err := d.db.QueryContext(ctx, query, addParams...)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %w", err)
 	}
@@ -154,24 +205,164 @@ func (d *DB) SelectNotes(spaces []string, all bool, sortOpts *SortOpts, pageOpts
 	// Parse the results
 	notes := make(Notes, 0, limit)
 	for rows.Next() {
-		note, err := scanNote(rows)
-		if err != err {
+		var encrypted bool
+		note, err := d.scanNote(rows, &encrypted)
+		if err != nil {
 			return nil, err
 		}
+		if encrypted && filter != nil && !filter(note) {
+			continue
+		}
 
 		notes = append(notes, *note)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
+	if filter != nil && pageOpts != nil && pageOpts.Limit > 0 {
+		start := min(pageOpts.Offset, len(notes))
+		notes = notes[start:min(start+pageOpts.Limit, len(notes))]
+	}
 	return notes, nil
 }
 
-func (d *DB) SelectSpaces(all bool, sortOpts *SortOpts) ([]string, error) {
+// noteWhere builds the WHERE clause (and its parameters) shared by note selections.
+// Notes encrypted with a locked key are never selected.
+func (d *conn) noteWhere(spaces []string, all bool, filterOpts *FilterOpts) (string, []any) {
+	unlocked, params := d.unlockedCondition()
+	conditions := []string{unlocked}
+
+	// Encrypted notes are matched by their content after they are decrypted, see contentFilter
+	encrypted := d.contentFilter(filterOpts) != nil
+
+	if len(spaces) > 0 && filterOpts != nil && filterOpts.Recursive {
+		subtrees := make([]string, len(spaces))
+		for i, space := range spaces {
+			subtrees[i] = subtreeCondition("space")
+			params = append(params, subtreeParams(space)...)
+		}
+		conditions = append(conditions, "("+strings.Join(subtrees, " OR ")+")")
+
+		if !all {
+			// Nested hidden spaces are only included if they are explicitly listed
+			bracketQ := strings.Join(repeatString("?", len(spaces)), ", ")
+			conditions = append(conditions, fmt.Sprintf(
+				"(space IN (%v) OR space NOT IN (SELECT name FROM spaces WHERE hidden))", bracketQ,
+			))
+			params = append(params, sliceToAny(spaces)...)
+		}
+	} else if len(spaces) > 0 { // Spaces slots
+		manyQuestions := repeatString("?", len(spaces))
+		bracketQ := strings.Join(manyQuestions, ", ")
+
+		conditions = append(conditions, fmt.Sprintf("space IN (%v)", bracketQ))
+		params = append(params, sliceToAny(spaces)...)
+	} else if !all {
+		// The caller has not specified individual spaces but also wants to hide notes
+		// from hidden spaces (by default, the ones starting with '.')
+		conditions = append(conditions, "space NOT IN (SELECT name FROM spaces WHERE hidden)")
+	}
+	if filterOpts != nil {
+		for _, tag := range filterOpts.Tags {
+			conditions = append(conditions, `notes.id IN (SELECT nt.note_id FROM note_tags nt
+				JOIN tags t ON t.id = nt.tag_id WHERE t.name = ?)`)
+			params = append(params, tag)
+		}
+
+		times := []struct {
+			condition string
+			value     time.Time
+		}{
+			{"created >= ?", filterOpts.CreatedSince},
+			{"created < ?", filterOpts.CreatedUntil},
+			{"last_updated >= ?", filterOpts.UpdatedSince},
+			{"last_updated < ?", filterOpts.UpdatedUntil},
+			{"due >= ?", filterOpts.DueSince},
+			{"due < ?", filterOpts.DueUntil},
+			{"remind_at <= ?", filterOpts.RemindUntil},
+		}
+		for _, t := range times {
+			if !t.value.IsZero() {
+				conditions = append(conditions, t.condition)
+				params = append(params, formatTime(t.value))
+			}
+		}
+
+		if filterOpts.Due {
+			conditions = append(conditions, "due IS NOT NULL")
+		}
+		if filterOpts.Reminder {
+			conditions = append(conditions, "remind_at IS NOT NULL")
+		}
+
+		if filterOpts.Pinned != nil {
+			conditions = append(conditions, "pinned = ?")
+			params = append(params, *filterOpts.Pinned)
+		}
+
+		if filterOpts.Query != nil {
+			condition, queryParams := filterOpts.Query.where()
+			if encrypted && readsContent(filterOpts.Query) {
+				condition = "(notes.key_id IS NOT NULL OR " + condition + ")"
+			}
+			conditions = append(conditions, condition)
+			params = append(params, queryParams...)
+		}
+
+		limits := []struct {
+			condition string
+			value     int
+		}{
+			{"notes.id >= ?", filterOpts.MinID},
+			{"notes.id <= ?", filterOpts.MaxID},
+			{"length(content) >= ?", filterOpts.MinLength},
+			{"length(content) <= ?", filterOpts.MaxLength},
+		}
+		for _, l := range limits {
+			if l.value > 0 {
+				condition := l.condition
+				if encrypted && strings.HasPrefix(condition, "length(content)") {
+					condition = "(notes.key_id IS NOT NULL OR " + condition + ")"
+				}
+				conditions = append(conditions, condition)
+				params = append(params, l.value)
+			}
+		}
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), params
+}
+
+// contentFilter matches the filters on the content of notes against a decrypted note.
+// In SQL these would compare the ciphertext of encrypted notes, so noteWhere lets the
+// encrypted notes through, to be matched here. It is nil if there is nothing to match,
+// or if no encrypted notes can be selected.
+func (d *conn) contentFilter(f *FilterOpts) func(n *Note) bool {
+	if f == nil || len(d.keys.unlocked()) == 0 {
+		return nil
+	}
+	query := f.Query != nil && readsContent(f.Query)
+	if !query && f.MinLength == 0 && f.MaxLength == 0 {
+		return nil
+	}
+
+	return func(n *Note) bool {
+		length := utf8.RuneCountInString(n.Content)
+		if (f.MinLength > 0 && length < f.MinLength) || (f.MaxLength > 0 && length > f.MaxLength) {
+			return false
+		}
+		return !query || f.Query.match(n)
+	}
+}
+
+func (d *conn) SelectSpaces(ctx context.Context, all bool, sortOpts *SortOpts) ([]string, error) {
 	var (
 		orderBy = ""
 		where   = ""
 	)
 	if !all {
-		where = "WHERE space NOT LIKE '.%'"
+		where = "WHERE NOT hidden"
 	}
 	if sortOpts != nil {
 		orderBy = fmt.Sprintf(
@@ -180,8 +371,8 @@ func (d *DB) SelectSpaces(all bool, sortOpts *SortOpts) ([]string, error) {
 		)
 	}
 
-	query := fmt.Sprintf("SELECT DISTINCT space FROM notes %v %v", where, orderBy)
-	rows, err := d.db.Query(query)
+	query := fmt.Sprintf("SELECT name AS space FROM spaces %v %v", where, orderBy)
+	rows, err := d.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %w", err)
 	}
@@ -196,5 +387,5 @@ func (d *DB) SelectSpaces(all bool, sortOpts *SortOpts) ([]string, error) {
 		}
 		spaces = append(spaces, space)
 	}
-	return spaces, nil
+	return spaces, rows.Err()
 }
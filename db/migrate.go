@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// A migration upgrades the schema from Version-1 to Version.
+// The schema version is stored in the database header (PRAGMA user_version).
+type migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations must be ordered by version, starting at 1, without gaps.
+// Never modify a migration that has been released, add a new one instead.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create notes table",
+		Up:          execAll(createTableSql, createTriggerSql),
+	},
+	{
+		Version:     2,
+		Description: "full-text search index",
+		Up:          migrateSearchIndex,
+	},
+	{
+		Version:     3,
+		Description: "tags",
+		Up:          execAll(createTagsTableSql, createNoteTagsTableSql, createTagCleanupTriggerSql),
+	},
+	{
+		Version:     4,
+		Description: "note revisions",
+		Up:          execAll(createRevisionsTableSql, createRevisionTriggerSql),
+	},
+	{
+		Version:     5,
+		Description: "trash origin",
+		Up:          execAll(createTrashTableSql, createTrashTriggerSql, createUntrashTriggerSql),
+	},
+	{
+		Version:     6,
+		Description: "explicit last updated",
+		Up:          execAll("DROP TRIGGER IF EXISTS notes_auto_last_updated", createTriggerExplicitUpdateSql),
+	},
+	{
+		Version:     7,
+		Description: "spaces",
+		Up: execAll(
+			createSpacesTableSql,
+			populateSpacesSql,
+			createSpaceIndexSql,
+			createSpaceInsertTriggerSql,
+			createSpaceUpdateTriggerSql,
+			createSpaceDeleteTriggerSql,
+		),
+	},
+	{
+		Version:     8,
+		Description: "encrypted spaces",
+		Up: execAll(
+			createSpaceKeysTableSql,
+			addSpaceKeySql,
+			addNoteKeySql,
+			addRevisionKeySql,
+			"DROP TRIGGER IF EXISTS notes_revision",
+			createKeyedRevisionTriggerSql,
+			"DROP TRIGGER IF EXISTS notes_auto_last_updated",
+			createKeyedLastUpdatedTriggerSql,
+			"DROP TRIGGER IF EXISTS notes_space_update",
+			createKeyedSpaceUpdateTriggerSql,
+			"DROP TRIGGER IF EXISTS notes_space_delete",
+			createKeyedSpaceDeleteTriggerSql,
+		),
+	},
+	{
+		Version:     9,
+		Description: "links between notes",
+		Up:          migrateLinks,
+	},
+	{
+		Version:     10,
+		Description: "attachments",
+		Up:          execAll(createAttachmentsTableSql),
+	},
+	{
+		Version:     11,
+		Description: "due dates and reminders",
+		Up:          execAll(addDueColumnSql, addRemindAtColumnSql, createDueIndexSql, createRemindIndexSql),
+	},
+	{
+		Version:     12,
+		Description: "search index without triggers",
+		Up:          migrateSearchQueue,
+	},
+}
+
+// Exported description of a migration
+type Migration struct {
+	Version     int
+	Description string
+}
+
+type MigrationStatus struct {
+	Current int
+	Latest  int
+	Pending []Migration
+}
+
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// MigrationStatus reports the current schema version and any pending migrations.
+func (d *DB) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	current, err := d.schemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return nil, fmt.Errorf("database schema version %v is newer than supported version %v", current, latest)
+	}
+
+	pending := make([]Migration, 0)
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, Migration{Version: m.Version, Description: m.Description})
+		}
+	}
+
+	return &MigrationStatus{
+		Current: current,
+		Latest:  latest,
+		Pending: pending,
+	}, nil
+}
+
+// Migrate applies all pending migrations in order and returns the ones applied.
+// Each migration runs in its own transaction, together with the version bump.
+func (d *DB) Migrate(ctx context.Context) ([]Migration, error) {
+	status, err := d.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0, len(status.Pending))
+	for _, m := range migrations {
+		if m.Version <= status.Current {
+			continue
+		}
+
+		if err := d.applyMigration(ctx, m); err != nil {
+			return applied, fmt.Errorf("migration %v (%v): %w", m.Version, m.Description, err)
+		}
+		applied = append(applied, Migration{Version: m.Version, Description: m.Description})
+	}
+
+	if err := d.ensureSearchIndex(ctx); err != nil {
+		return applied, fmt.Errorf("search index: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (d *DB) applyMigration(ctx context.Context, m migration) error {
+	tx, err := d.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(ctx, tx); err != nil {
+		return err
+	}
+
+	// PRAGMA does not accept bound parameters
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", m.Version)); err != nil {
+		return fmt.Errorf("set version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) schemaVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := d.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	return version, nil
+}
+
+// execAll creates a migration step that executes the statements in order
+func execAll(statements ...string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("exec: %w", err)
+			}
+		}
+		return nil
+	}
+}
@@ -36,6 +36,10 @@ const (
 	PinnedColumn      Column = "pinned"
 )
 
+const (
+	sqlTimeFormat = "2006-01-02 15:04:05"
+)
+
 var (
 	allNoteColumns = allNoteColumnsGen()
 )
@@ -50,6 +54,9 @@ type Note struct {
 	LastUpdated time.Time
 	Content     string
 	Pinned      bool
+	Tags        []string
+	Due         *time.Time // optional deadline
+	RemindAt    *time.Time // optional time of a reminder
 }
 
 type Notes []Note
@@ -87,12 +94,16 @@ type dbNote struct {
 	LastUpdated string
 	Content     string
 	Pinned      bool
+	Tags        sql.NullString
+	KeyID       sql.NullInt64 // NULL unless the content is encrypted
+	Due         sql.NullString
+	RemindAt    sql.NullString
 }
 
 // Helpers
 
 func allNoteColumnsGen() string {
-	// id, space, created, last_updated, content, pinned
+	// id, space, created, last_updated, content, pinned, tags, key_id, due, remind_at
 	cols := []string{
 		string(IDColumn),
 		string(SpaceColumn),
@@ -100,6 +111,10 @@ func allNoteColumnsGen() string {
 		string(LastUpdatedColumn),
 		string(ContentColumn),
 		string(PinnedColumn),
+		noteTagsSql,
+		"key_id",
+		"due",
+		"remind_at",
 	}
 
 	return strings.Join(cols, ", ")
@@ -116,6 +131,16 @@ func toNote(note dbNote) (*Note, error) {
 		return nil, err
 	}
 
+	due, err := parseNullTime(note.Due)
+	if err != nil {
+		return nil, err
+	}
+
+	remindAt, err := parseNullTime(note.RemindAt)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Note{
 		ID:          note.ID,
 		Space:       note.Space,
@@ -123,6 +148,9 @@ func toNote(note dbNote) (*Note, error) {
 		LastUpdated: updatedAt,
 		Content:     note.Content,
 		Pinned:      note.Pinned,
+		Tags:        splitTags(note.Tags.String),
+		Due:         due,
+		RemindAt:    remindAt,
 	}, nil
 }
 
@@ -130,21 +158,48 @@ func toDbNote(note Note) dbNote {
 	return dbNote{
 		ID:          note.ID,
 		Space:       note.Space,
-		Created:     note.Created.Format("2006-01-02 15:04:05"),
-		LastUpdated: note.LastUpdated.Format("2006-01-02 15:04:05"),
+		Created:     formatTime(note.Created),
+		LastUpdated: formatTime(note.LastUpdated),
 		Content:     note.Content,
 		Pinned:      note.Pinned,
+		Due:         formatNullTime(note.Due),
+		RemindAt:    formatNullTime(note.RemindAt),
 	}
 }
 
+// parseTime parses timestamps as returned by the driver. DATETIME columns are
+// returned in RFC 3339 format, but expressions are returned as stored.
 func parseTime(dateStr string) (time.Time, error) {
 	date, err := time.Parse("2006-01-02T15:04:05Z", dateStr)
 	if err != nil {
-		return time.Time{}, err
+		return time.Parse(sqlTimeFormat, dateStr)
 	}
 	return date, nil
 }
 
+// formatTime formats a timestamp the way CURRENT_TIMESTAMP stores it
+func formatTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeFormat)
+}
+
+func parseNullTime(ns sql.NullString) (*time.Time, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	t, err := parseTime(ns.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func formatNullTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{Valid: false}
+	}
+	return sql.NullString{String: formatTime(*t), Valid: true}
+}
+
 func nullStrToPtr(ns sql.NullString) *string {
 	if ns.Valid {
 		return &ns.String
@@ -0,0 +1,660 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expr is a node of a parsed query, see ParseQuery
+type Expr interface {
+	String() string
+
+	// where compiles the expression into an SQL condition with parameters
+	where() (string, []any)
+
+	// match evaluates the expression in Go, for notes whose content is encrypted in the database
+	match(n *Note) bool
+}
+
+// AndExpr matches notes that match all of the expressions
+type AndExpr struct {
+	Exprs []Expr
+}
+
+// OrExpr matches notes that match any of the expressions
+type OrExpr struct {
+	Exprs []Expr
+}
+
+// NotExpr matches notes that do not match the expression
+type NotExpr struct {
+	Expr Expr
+}
+
+// TextExpr matches notes containing the text, ignoring case
+type TextExpr struct {
+	Text   string
+	Phrase bool // the text was quoted
+}
+
+// FieldExpr compares a field of the notes with a value. The type of the
+// value depends on the field: string, bool, int or time.Time.
+type FieldExpr struct {
+	Field string
+	Op    string
+	Value any
+}
+
+type queryField int
+
+const (
+	stringField queryField = iota
+	boolField
+	intField
+	timeField
+)
+
+var (
+	queryFields = map[string]queryField{
+		"space":   stringField,
+		"tag":     stringField,
+		"pinned":  boolField,
+		"id":      intField,
+		"length":  intField,
+		"created": timeField,
+		"updated": timeField,
+		"due":     timeField,
+	}
+	queryColumns = map[string]string{
+		"space":   "space",
+		"pinned":  "pinned",
+		"id":      "notes.id",
+		"length":  "length(content)",
+		"created": "created",
+		"updated": "last_updated",
+		"due":     "due",
+	}
+
+	// Longer operators first, so that >= is not taken for >
+	queryOps = []string{">=", "<=", ">", "<", "=", ":"}
+)
+
+// ParseQuery parses a query expression, for example:
+//
+//	space:work tag:todo pinned:true created>2024-01-01 "exact phrase" -draft
+//
+// Terms separated by space must all match, unless they are separated by OR.
+// Terms are negated with '-' and grouped with parentheses. Words and quoted
+// phrases match the content of notes. A field is compared with a value using
+// one of : = < <= > >=, where : and = mean equality. For times, equality
+// matches the whole day. Times are parsed by ParseTime, relative to now.
+//
+// An empty query returns a nil expression, that matches all notes.
+func ParseQuery(query string, now time.Time) (Expr, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &queryParser{tokens: tokens, now: now}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %v", p.peek())
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	phraseToken
+	notToken
+	openToken
+	closeToken
+	andToken
+	orToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // position of the first character, counted in runes
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case phraseToken:
+		return strconv.Quote(t.text)
+	case notToken:
+		return "'-'"
+	case openToken:
+		return "'('"
+	case closeToken:
+		return "')'"
+	}
+	return t.text
+}
+
+func lexQuery(query string) ([]token, error) {
+	var (
+		tokens = []token{}
+		runes  = []rune(query)
+	)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: openToken, pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: closeToken, pos: i})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, token{kind: notToken, pos: i})
+			i++
+		case r == '"':
+			text, next, err := lexQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: phraseToken, text: text, pos: i})
+			i = next
+		default:
+			// A word may contain quoted parts, as in space:"my space"
+			var (
+				word   strings.Builder
+				start  = i
+				quoted = false
+			)
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				if runes[i] == '"' {
+					text, next, err := lexQuoted(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					word.WriteString(text)
+					i = next
+					quoted = true
+					continue
+				}
+				word.WriteRune(runes[i])
+				i++
+			}
+
+			t := token{kind: wordToken, text: word.String(), pos: start}
+			if !quoted && t.text == "AND" {
+				t.kind = andToken
+			} else if !quoted && t.text == "OR" {
+				t.kind = orToken
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+// lexQuoted reads a quoted string starting at runes[start], where '\' escapes the next character
+func lexQuoted(runes []rune, start int) (string, int, error) {
+	var text strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				text.WriteRune(runes[i])
+			}
+		case '"':
+			return text.String(), i + 1, nil
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return "", 0, fmt.Errorf("query: unterminated quote at position %v", start)
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+func (p *queryParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next(kind tokenKind) bool {
+	if !p.done() && p.peek().kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) errorf(format string, a ...any) error {
+	if p.done() {
+		return fmt.Errorf("query: %v at the end", fmt.Sprintf(format, a...))
+	}
+	return fmt.Errorf("query: %v at position %v", fmt.Sprintf(format, a...), p.peek().pos)
+}
+
+// parseOr parses terms separated by OR, which binds weaker than AND
+func (p *queryParser) parseOr() (Expr, error) {
+	exprs := []Expr{}
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		if !p.next(orToken) {
+			break
+		}
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return &OrExpr{Exprs: exprs}, nil
+}
+
+// parseAnd parses a sequence of terms, optionally separated by AND
+func (p *queryParser) parseAnd() (Expr, error) {
+	exprs := []Expr{}
+	for !p.done() {
+		kind := p.peek().kind
+		if kind == orToken || kind == closeToken {
+			break
+		}
+		if len(exprs) > 0 && p.next(andToken) && (p.done() || p.peek().kind == orToken || p.peek().kind == closeToken) {
+			return nil, p.errorf("expected a term after AND")
+		}
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	switch len(exprs) {
+	case 0:
+		return nil, p.errorf("expected a term")
+	case 1:
+		return exprs[0], nil
+	}
+	return &AndExpr{Exprs: exprs}, nil
+}
+
+func (p *queryParser) parseUnary() (Expr, error) {
+	if p.next(notToken) {
+		if p.done() {
+			return nil, p.errorf("expected a term after '-'")
+		}
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (Expr, error) {
+	if p.done() {
+		return nil, p.errorf("expected a term")
+	}
+
+	t := p.peek()
+	switch t.kind {
+	case openToken:
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.next(closeToken) {
+			return nil, fmt.Errorf("query: missing ')' for '(' at position %v", t.pos)
+		}
+		return expr, nil
+	case phraseToken:
+		p.pos++
+		return &TextExpr{Text: t.text, Phrase: true}, nil
+	case wordToken:
+		p.pos++
+		return parseTerm(t, p.now)
+	}
+	return nil, p.errorf("unexpected %v", t)
+}
+
+// parseTerm parses a word, which is either a field comparison or text
+func parseTerm(t token, now time.Time) (Expr, error) {
+	i := strings.IndexAny(t.text, ":<>=")
+	if i <= 0 {
+		return &TextExpr{Text: t.text}, nil
+	}
+
+	// Words like http://example.com are text
+	name := strings.ToLower(t.text[:i])
+	field, ok := queryFields[name]
+	if !ok {
+		return &TextExpr{Text: t.text}, nil
+	}
+
+	var op string
+	for _, candidate := range queryOps {
+		if strings.HasPrefix(t.text[i:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("query: invalid operator for %v at position %v", name, t.pos)
+	}
+
+	raw := t.text[i+len(op):]
+	if raw == "" {
+		return nil, fmt.Errorf("query: missing value for %v at position %v", name, t.pos)
+	}
+	if op == ":" {
+		op = "="
+	}
+
+	expr := &FieldExpr{Field: name, Op: op}
+	switch field {
+	case stringField:
+		if op != "=" {
+			return nil, fmt.Errorf("query: %v can only be compared with : or = at position %v", name, t.pos)
+		}
+		expr.Value = raw
+	case boolField:
+		if op != "=" {
+			return nil, fmt.Errorf("query: %v can only be compared with : or = at position %v", name, t.pos)
+		}
+		value, err := parseQueryBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("query: %w at position %v", err, t.pos)
+		}
+		expr.Value = value
+	case intField:
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("query: %v must be a positive number at position %v", name, t.pos)
+		}
+		expr.Value = value
+	case timeField:
+		value, err := ParseTime(raw, now)
+		if err != nil {
+			return nil, fmt.Errorf("query: %w at position %v", err, t.pos)
+		}
+		expr.Value = value
+	}
+	return expr, nil
+}
+
+func parseQueryBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean: %v", s)
+}
+
+func (e *AndExpr) String() string {
+	parts := make([]string, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		parts[i] = expr.String()
+		if _, ok := expr.(*OrExpr); ok {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *OrExpr) String() string {
+	parts := make([]string, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		parts[i] = expr.String()
+	}
+	return strings.Join(parts, " OR ")
+}
+
+func (e *NotExpr) String() string {
+	switch e.Expr.(type) {
+	case *AndExpr, *OrExpr:
+		return "-(" + e.Expr.String() + ")"
+	}
+	return "-" + e.Expr.String()
+}
+
+func (e *TextExpr) String() string {
+	if e.Phrase || e.Text == "AND" || e.Text == "OR" || strings.ContainsAny(e.Text, " \t\n\"()") {
+		return quoteQuery(e.Text)
+	}
+	return e.Text
+}
+
+func (e *FieldExpr) String() string {
+	var value string
+	switch v := e.Value.(type) {
+	case string:
+		value = v
+		if v == "" || strings.ContainsAny(v, " \t\n\"()") {
+			value = quoteQuery(v)
+		}
+	case time.Time:
+		value = v.Local().Format("2006-01-02T15:04:05")
+	default:
+		value = fmt.Sprint(v)
+	}
+	return e.Field + e.Op + value
+}
+
+func quoteQuery(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func (e *AndExpr) where() (string, []any) {
+	return joinWhere(e.Exprs, " AND ")
+}
+
+func (e *OrExpr) where() (string, []any) {
+	return joinWhere(e.Exprs, " OR ")
+}
+
+func joinWhere(exprs []Expr, sep string) (string, []any) {
+	var (
+		conditions = make([]string, len(exprs))
+		params     = []any{}
+	)
+	for i, expr := range exprs {
+		condition, exprParams := expr.where()
+		conditions[i] = condition
+		params = append(params, exprParams...)
+	}
+	return "(" + strings.Join(conditions, sep) + ")", params
+}
+
+func (e *NotExpr) where() (string, []any) {
+	condition, params := e.Expr.where()
+	return "NOT " + condition, params
+}
+
+func (e *TextExpr) where() (string, []any) {
+	return `(content LIKE ? ESCAPE '\')`, []any{"%" + escapeLike(e.Text) + "%"}
+}
+
+func (e *AndExpr) match(n *Note) bool {
+	for _, expr := range e.Exprs {
+		if !expr.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *OrExpr) match(n *Note) bool {
+	for _, expr := range e.Exprs {
+		if expr.match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *NotExpr) match(n *Note) bool {
+	// Like in SQL, a comparison with a missing due date is neither true nor false
+	if field, ok := e.Expr.(*FieldExpr); ok && field.Field == "due" && n.Due == nil {
+		return false
+	}
+	return !e.Expr.match(n)
+}
+
+// match folds the case of ASCII letters only, like LIKE does
+func (e *TextExpr) match(n *Note) bool {
+	return strings.Contains(foldASCII(n.Content), foldASCII(e.Text))
+}
+
+func (e *FieldExpr) match(n *Note) bool {
+	var t *time.Time
+	switch e.Field {
+	case "space":
+		return n.Space == e.Value.(string)
+	case "tag":
+		return slices.Contains(n.Tags, e.Value.(string))
+	case "pinned":
+		return n.Pinned == e.Value.(bool)
+	case "id":
+		return compareOp(n.ID, e.Value.(int), e.Op)
+	case "length":
+		return compareOp(utf8.RuneCountInString(n.Content), e.Value.(int), e.Op)
+	case "created":
+		t = &n.Created
+	case "updated":
+		t = &n.LastUpdated
+	case "due":
+		t = n.Due
+	}
+	if t == nil {
+		return false
+	}
+
+	// Times are stored with a precision of seconds
+	value := e.Value.(time.Time)
+	if e.Op == "=" {
+		local := value.Local()
+		start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		return !t.Before(start) && t.Before(start.AddDate(0, 0, 1))
+	}
+	return compareOp(t.Unix(), value.Unix(), e.Op)
+}
+
+func compareOp[T cmp.Ordered](a, b T, op string) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return a == b
+}
+
+func foldASCII(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// readsContent reports whether the expression compares the content of notes
+func readsContent(e Expr) bool {
+	switch e := e.(type) {
+	case *AndExpr:
+		return slices.ContainsFunc(e.Exprs, readsContent)
+	case *OrExpr:
+		return slices.ContainsFunc(e.Exprs, readsContent)
+	case *NotExpr:
+		return readsContent(e.Expr)
+	case *TextExpr:
+		return true
+	case *FieldExpr:
+		return e.Field == "length"
+	}
+	return false
+}
+
+func (e *FieldExpr) where() (string, []any) {
+	if e.Field == "tag" {
+		return `(notes.id IN (SELECT nt.note_id FROM note_tags nt
+			JOIN tags t ON t.id = nt.tag_id WHERE t.name = ?))`, []any{e.Value}
+	}
+
+	column := queryColumns[e.Field]
+	value, ok := e.Value.(time.Time)
+	if !ok {
+		return fmt.Sprintf("(%v %v ?)", column, e.Op), []any{e.Value}
+	}
+
+	// Equality of times matches the whole (local) day
+	if e.Op == "=" {
+		local := value.Local()
+		start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		return fmt.Sprintf("(%[1]v >= ? AND %[1]v < ?)", column),
+			[]any{formatTime(start), formatTime(start.AddDate(0, 0, 1))}
+	}
+	return fmt.Sprintf("(%v %v ?)", column, e.Op), []any{formatTime(value)}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with '\' as escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,338 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var queryNow = time.Date(2024, 10, 15, 12, 0, 0, 0, time.Local)
+
+func localDate(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.Local)
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // the parsed expression, as printed by String
+	}{
+		// Text
+		{"hello", "hello"},
+		{"Hello World", "Hello World"},
+		{`"exact phrase"`, `"exact phrase"`},
+		{`"say \"hi\""`, `"say \"hi\""`},
+		{`"AND"`, `"AND"`},
+		{"http://example.com", "http://example.com"},
+		{"unknown:field", "unknown:field"},
+		{"a - b", "a - b"},
+
+		// Fields and operators
+		{"space:work", "space=work"},
+		{"space=work", "space=work"},
+		{"Space:Work", "space=Work"},
+		{`space:"my notes"`, `space="my notes"`},
+		{`space:my" "notes`, `space="my notes"`},
+		{"tag:todo", "tag=todo"},
+		{"pinned:true", "pinned=true"},
+		{"pinned:yes", "pinned=true"},
+		{"pinned:0", "pinned=false"},
+		{"id:7", "id=7"},
+		{"id>=10 id<20", "id>=10 id<20"},
+		{"id>10 id<=20", "id>10 id<=20"},
+		{"length>100", "length>100"},
+		{"created>2024-01-01", "created>2024-01-01T00:00:00"},
+		{"updated:2024-10-01", "updated=2024-10-01T00:00:00"},
+		{"due<2024-01-01T10:30", "due<2024-01-01T10:30:00"},
+		{"created>=7d", "created>=2024-10-08T12:00:00"},
+
+		// Negation
+		{"-draft", "-draft"},
+		{"-space:work", "-space=work"},
+		{`-"exact phrase"`, `-"exact phrase"`},
+		{"--draft", "--draft"},
+		{"-(a b)", "-(a b)"},
+		{"-(a OR b)", "-(a OR b)"},
+
+		// AND, OR and parentheses
+		{"a AND b", "a b"},
+		{"a b OR c", "a b OR c"},
+		{"a (b OR c)", "a (b OR c)"},
+		{"(a OR b) c", "(a OR b) c"},
+		{"((a))", "a"},
+		{"a OR b OR c", "a OR b OR c"},
+		{"and or", "and or"},
+		{`space:work tag:todo pinned:true created>2024-01-01 "exact phrase" -draft`,
+			`space=work tag=todo pinned=true created>2024-01-01T00:00:00 "exact phrase" -draft`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, err := ParseQuery(test.query, queryNow)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := expr.String(); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+
+			// The printed expression parses to the same expression
+			again, err := ParseQuery(expr.String(), queryNow)
+			if err != nil {
+				t.Fatalf("reparse %v: %v", expr, err)
+			}
+			if !reflect.DeepEqual(again, expr) {
+				t.Errorf("reparse %v: got %#v, want %#v", expr, again, expr)
+			}
+		})
+	}
+}
+
+func TestParseQueryTree(t *testing.T) {
+	text := func(s string) Expr { return &TextExpr{Text: s} }
+
+	tests := []struct {
+		query string
+		want  Expr
+	}{
+		{"a b OR c", &OrExpr{Exprs: []Expr{
+			&AndExpr{Exprs: []Expr{text("a"), text("b")}},
+			text("c"),
+		}}},
+		{"a OR b c", &OrExpr{Exprs: []Expr{
+			text("a"),
+			&AndExpr{Exprs: []Expr{text("b"), text("c")}},
+		}}},
+		{"a AND (b OR c)", &AndExpr{Exprs: []Expr{
+			text("a"),
+			&OrExpr{Exprs: []Expr{text("b"), text("c")}},
+		}}},
+		{"-a b", &AndExpr{Exprs: []Expr{&NotExpr{Expr: text("a")}, text("b")}}},
+		{"--a", &NotExpr{Expr: &NotExpr{Expr: text("a")}}},
+		{`"a b"`, &TextExpr{Text: "a b", Phrase: true}},
+		{"id>=3", &FieldExpr{Field: "id", Op: ">=", Value: 3}},
+		{`space:"a b"`, &FieldExpr{Field: "space", Op: "=", Value: "a b"}},
+		{"pinned:false", &FieldExpr{Field: "pinned", Op: "=", Value: false}},
+		{"created<2024-01-02", &FieldExpr{Field: "created", Op: "<", Value: localDate(2024, 1, 2, 0, 0)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			got, err := ParseQuery(test.query, queryNow)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryEmpty(t *testing.T) {
+	for _, query := range []string{"", "   ", "\t\n"} {
+		expr, err := ParseQuery(query, queryNow)
+		if expr != nil || err != nil {
+			t.Errorf("%q: got %v, %v, want nil", query, expr, err)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`"unterminated`, "query: unterminated quote at position 0"},
+		{`a "b`, "query: unterminated quote at position 2"},
+		{`space:"my notes`, "query: unterminated quote at position 6"},
+		{"(a b", "query: missing ')' for '(' at position 0"},
+		{"x (a (b)", "query: missing ')' for '(' at position 2"},
+		{"a)", "query: unexpected ')' at position 1"},
+		{"()", "query: expected a term at position 1"},
+		{"a OR", "query: expected a term at the end"},
+		{"OR a", "query: expected a term at position 0"},
+		{"a OR OR b", "query: expected a term at position 5"},
+		{"a AND", "query: expected a term after AND at the end"},
+		{"a AND OR b", "query: expected a term after AND at position 6"},
+		{"space<work", "query: space can only be compared with : or = at position 0"},
+		{"x tag>=a", "query: tag can only be compared with : or = at position 2"},
+		{"pinned>true", "query: pinned can only be compared with : or = at position 0"},
+		{"pinned:maybe", "query: invalid boolean: maybe at position 0"},
+		{"id:abc", "query: id must be a positive number at position 0"},
+		{"a b id:-1", "query: id must be a positive number at position 4"},
+		{"length>", "query: missing value for length at position 0"},
+		{"tag:", "query: missing value for tag at position 0"},
+		{"created>someday", "query: invalid time: someday"},
+		{"a due=tomorrowish", "at position 2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, err := ParseQuery(test.query, queryNow)
+			if err == nil {
+				t.Fatalf("expected an error, got %v", expr)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %q, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryWhere(t *testing.T) {
+	start := localDate(2024, 1, 1, 0, 0)
+
+	tests := []struct {
+		query  string
+		want   string
+		params []any
+	}{
+		{"hello", `(content LIKE ? ESCAPE '\')`, []any{"%hello%"}},
+		{`"100% a_b\\c"`, `(content LIKE ? ESCAPE '\')`, []any{`%100\% a\_b\\c%`}},
+		{"-hello", `NOT (content LIKE ? ESCAPE '\')`, []any{"%hello%"}},
+		{"space:work", "(space = ?)", []any{"work"}},
+		{"pinned:true", "(pinned = ?)", []any{true}},
+		{"id>5", "(notes.id > ?)", []any{5}},
+		{"length<=10", "(length(content) <= ?)", []any{10}},
+		{"created>2024-01-01", "(created > ?)", []any{formatTime(start)}},
+		{"updated<=2024-01-01T10:30", "(last_updated <= ?)", []any{formatTime(localDate(2024, 1, 1, 10, 30))}},
+		{"due:2024-01-01", "(due >= ? AND due < ?)", []any{formatTime(start), formatTime(start.AddDate(0, 0, 1))}},
+		{"a b", `((content LIKE ? ESCAPE '\') AND (content LIKE ? ESCAPE '\'))`, []any{"%a%", "%b%"}},
+		{"pinned:true OR id>5 space:x", "((pinned = ?) OR ((notes.id > ?) AND (space = ?)))", []any{true, 5, "x"}},
+		{"-(id<3 OR id>9)", "NOT ((notes.id < ?) OR (notes.id > ?))", []any{3, 9}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, err := ParseQuery(test.query, queryNow)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, params := expr.where()
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(params, test.params) {
+				t.Errorf("got params %#v, want %#v", params, test.params)
+			}
+		})
+	}
+}
+
+func TestQueryWhereTag(t *testing.T) {
+	expr, err := ParseQuery("tag:todo", queryNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, params := expr.where()
+	if !strings.Contains(got, "note_tags") || !strings.Contains(got, "t.name = ?") {
+		t.Errorf("got %v, want a condition on note_tags", got)
+	}
+	if !reflect.DeepEqual(params, []any{"todo"}) {
+		t.Errorf("got params %#v, want [todo]", params)
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	due := localDate(2024, 10, 20, 10, 0)
+	note := &Note{
+		ID:          12,
+		Space:       "work",
+		Created:     localDate(2024, 1, 1, 9, 0),
+		LastUpdated: localDate(2024, 10, 1, 9, 0),
+		Content:     "The Secret Plan, Ärende",
+		Pinned:      true,
+		Tags:        []string{"todo", "urgent"},
+		Due:         &due,
+	}
+	undated := &Note{ID: 13, Space: "home", Content: "no due date"}
+
+	tests := []struct {
+		query string
+		note  *Note
+		want  bool
+	}{
+		{"secret", note, true},
+		{`"secret plan"`, note, true},
+		{"SECRET -draft", note, true},
+		{"ärende", note, false}, // like LIKE, only ASCII letters are folded
+		{"Ärende", note, true},
+		{"space:work", note, true},
+		{"space:Work", note, false},
+		{"tag:urgent", note, true},
+		{"tag:later", note, false},
+		{"pinned:true id:12", note, true},
+		{"id>12", note, false},
+		{"length:23", note, true},
+		{"length<10", note, false},
+		{"created:2024-01-01", note, true},
+		{"created<2024-01-01T09:00", note, false},
+		{"updated>=2024-10-01T09:00", note, true},
+		{"due<2024-10-21", note, true},
+		{"draft OR tag:todo", note, true},
+		{"-(space:work pinned:true)", note, false},
+		{"due<2024-10-21", undated, false},
+		{"-due<2024-10-21", undated, false}, // a missing due date is never compared
+		{"-secret", undated, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, err := ParseQuery(test.query, queryNow)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := expr.match(test.note); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadsContent(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"space:work", false},
+		{"space:work pinned:true OR id>3", false},
+		{"secret", true},
+		{"space:work (id:1 OR -secret)", true},
+		{"length>10", true},
+	}
+
+	for _, test := range tests {
+		expr, err := ParseQuery(test.query, queryNow)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.query, err)
+		}
+		if got := readsContent(expr); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
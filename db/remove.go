@@ -22,11 +22,12 @@ THE SOFTWARE.
 package db
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
-func (d *DB) PermanentRemoveNotes(ids []int) error {
+func (d *conn) PermanentRemoveNotes(ctx context.Context, ids []int) error {
 	count := len(ids)
 	if count < 1 {
 		return fmt.Errorf("must provide ids")
@@ -42,21 +43,7 @@ func (d *DB) PermanentRemoveNotes(ids []int) error {
 	query := fmt.Sprintf("DELETE FROM notes WHERE %v", idsWhere)
 
 	// Execute query
-	result, err := d.db.Exec(query, sliceToAny(ids)...)
-	if err != nil {
-		return fmt.Errorf("exec: %w", err)
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows: %w", err)
-	}
-
-	if rows != int64(count) {
-		return fmt.Errorf("only %v out of %v was deleted successfully", rows, count)
-	}
-
-	return nil
+	return d.execIDs(ctx, "deleted", query, ids)
 }
 
 func sliceToAny[T any](s []T) []any {
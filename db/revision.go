@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	createRevisionsTableSql = `CREATE TABLE IF NOT EXISTS note_revisions (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		note_id INTEGER NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+		revision INTEGER NOT NULL,
+		created DATETIME NOT NULL,
+		content TEXT NOT NULL,
+		UNIQUE (note_id, revision));`
+
+	// Before content is replaced, the previous content is stored as a revision.
+	// The revision timestamp is the time the previous content was last updated.
+	createRevisionTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_revision
+		AFTER UPDATE OF content ON notes
+		FOR EACH ROW WHEN OLD.content IS NOT NEW.content
+		BEGIN
+			INSERT INTO note_revisions (note_id, revision, created, content)
+			VALUES (
+				OLD.id,
+				(SELECT IFNULL(MAX(revision), 0) + 1 FROM note_revisions WHERE note_id = OLD.id),
+				OLD.last_updated,
+				OLD.content);
+		END;`
+)
+
+// A previous version of the content of a note
+type Revision struct {
+	NoteID   int
+	Revision int
+	Created  time.Time
+	Content  string
+}
+
+// Revisions lists all stored revisions of a note, oldest first
+func (d *conn) Revisions(ctx context.Context, id int) ([]Revision, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT note_id, revision, created, content, key_id FROM note_revisions
+		WHERE note_id = ? ORDER BY revision ASC`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := make([]Revision, 0)
+	for rows.Next() {
+		revision, err := d.scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (d *conn) GetRevision(ctx context.Context, id, revision int) (*Revision, error) {
+	row := d.db.QueryRowContext(ctx,
+		`SELECT note_id, revision, created, content, key_id FROM note_revisions
+		WHERE note_id = ? AND revision = ?`,
+		id, revision,
+	)
+
+	out, err := d.scanRevision(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("note %v has no revision %v: %w", id, revision, ErrNotFound)
+	}
+	return out, err
+}
+
+// PruneRevisions removes all but the keep latest revisions of a note.
+// If keep is zero or less, nothing is removed.
+func (d *conn) PruneRevisions(ctx context.Context, id int, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	_, err := d.db.ExecContext(ctx,
+		`DELETE FROM note_revisions WHERE note_id = ? AND revision NOT IN (
+			SELECT revision FROM note_revisions WHERE note_id = ?
+			ORDER BY revision DESC LIMIT ?)`,
+		id, id, keep,
+	)
+	if err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// scanRevision decrypts the content of a revision, if it is encrypted and the key is unlocked
+func (d *conn) scanRevision(scanner Scanner) (*Revision, error) {
+	var (
+		out     Revision
+		created string
+		keyID   sql.NullInt64
+	)
+	err := scanner.Scan(&out.NoteID, &out.Revision, &created, &out.Content, &keyID)
+	if err != nil {
+		return nil, fmt.Errorf("scan error: %w", err)
+	}
+
+	out.Created, err = parseTime(created)
+	if err != nil {
+		return nil, fmt.Errorf("conversion error: %w", err)
+	}
+
+	out.Content, err = d.decrypt(out.Content, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("note %v: %w", out.NoteID, err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,358 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The first version of the full-text search index was an external content FTS5 table,
+// kept in sync with the notes table by triggers. FTS5 is only available when go-sqlite3
+// is built with the sqlite_fts5 tag, and the triggers failed in builds without it.
+const (
+	createSearchTableSql = `CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+		content,
+		content='notes',
+		content_rowid='id');`
+
+	createSearchInsertTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_fts_insert
+		AFTER INSERT ON notes
+		BEGIN
+			INSERT INTO notes_fts (rowid, content) VALUES (NEW.id, NEW.content);
+		END;`
+
+	createSearchDeleteTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_fts_delete
+		AFTER DELETE ON notes
+		BEGIN
+			INSERT INTO notes_fts (notes_fts, rowid, content) VALUES ('delete', OLD.id, OLD.content);
+		END;`
+
+	createSearchUpdateTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_fts_update
+		AFTER UPDATE OF content ON notes
+		BEGIN
+			INSERT INTO notes_fts (notes_fts, rowid, content) VALUES ('delete', OLD.id, OLD.content);
+			INSERT INTO notes_fts (rowid, content) VALUES (NEW.id, NEW.content);
+		END;`
+
+	rebuildSearchSql = "INSERT INTO notes_fts (notes_fts) VALUES ('rebuild');"
+)
+
+// The search index is now an FTS5 table of its own, of the notes that are not encrypted.
+// Triggers queue the notes that change, which do not need FTS5, and the index is updated
+// from the queue before it is used (see syncSearchIndex).
+const (
+	createSearchQueueTableSql = `CREATE TABLE IF NOT EXISTS search_queue (
+		note_id INTEGER NOT NULL PRIMARY KEY);`
+
+	createSearchQueueInsertTriggerSql = `CREATE TRIGGER IF NOT EXISTS search_queue_insert
+		AFTER INSERT ON notes
+		BEGIN
+			INSERT OR IGNORE INTO search_queue (note_id) VALUES (NEW.id);
+		END;`
+
+	createSearchQueueUpdateTriggerSql = `CREATE TRIGGER IF NOT EXISTS search_queue_update
+		AFTER UPDATE OF content, key_id ON notes
+		BEGIN
+			INSERT OR IGNORE INTO search_queue (note_id) VALUES (NEW.id);
+		END;`
+
+	createSearchQueueDeleteTriggerSql = `CREATE TRIGGER IF NOT EXISTS search_queue_delete
+		AFTER DELETE ON notes
+		BEGIN
+			INSERT OR IGNORE INTO search_queue (note_id) VALUES (OLD.id);
+		END;`
+
+	createSearchIndexSql = `CREATE VIRTUAL TABLE notes_fts USING fts5(content);`
+
+	fillSearchIndexSql = `INSERT INTO notes_fts (rowid, content)
+		SELECT id, content FROM notes WHERE key_id IS NULL;`
+
+	syncSearchDeleteSql = `DELETE FROM notes_fts WHERE rowid IN (SELECT note_id FROM search_queue);`
+
+	syncSearchInsertSql = `INSERT INTO notes_fts (rowid, content)
+		SELECT id, content FROM notes
+		WHERE key_id IS NULL AND id IN (SELECT note_id FROM search_queue);`
+)
+
+var (
+	ErrNoSearchIndex = errors.New("full-text search index is not available")
+)
+
+type SearchOpts struct {
+	Spaces []string
+	All    bool // include notes from hidden spaces
+	Filter *FilterOpts
+
+	Prefix bool // every term matches as a prefix
+	Phrase bool // the query is matched as one exact phrase
+
+	// Snippet extraction is enabled when SnippetTokens > 0. Matched terms are
+	// surrounded by HighlightStart and HighlightEnd.
+	SnippetTokens  int
+	HighlightStart string
+	HighlightEnd   string
+
+	Limit  int
+	Offset int // only if Limit > 0
+}
+
+type SearchResult struct {
+	Note
+	Rank    float64 // lower is better
+	Snippet string
+}
+
+// SearchNotes finds notes matching query, using the full-text search index.
+// Results are ordered by relevance. If the index is not available,
+// ErrNoSearchIndex is returned.
+func (d *conn) SearchNotes(ctx context.Context, query string, opts *SearchOpts) ([]SearchResult, error) {
+	if opts == nil {
+		opts = &SearchOpts{}
+	}
+
+	available, err := hasSearchIndex(ctx, d.db)
+	if err != nil {
+		return nil, err
+	} else if !available {
+		return nil, ErrNoSearchIndex
+	}
+	if err := d.syncSearchIndex(ctx); err != nil {
+		return nil, err
+	}
+
+	match := ftsQuery(query, opts.Prefix, opts.Phrase)
+	if match == "" {
+		return nil, fmt.Errorf("empty search query")
+	}
+
+	if opts.Filter != nil {
+		if err := opts.Filter.Check(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		snippetSql = "''"
+		params     = []any{}
+		limit      = ""
+	)
+	if opts.SnippetTokens > 0 {
+		snippetSql = "snippet(notes_fts, 0, ?, ?, '…', ?)"
+		params = append(params, opts.HighlightStart, opts.HighlightEnd, opts.SnippetTokens)
+	}
+	params = append(params, match)
+
+	// The index only holds the ciphertext of encrypted notes, so they are never matched
+	where, whereParams := d.noteWhere(opts.Spaces, opts.All, opts.Filter)
+	where += " AND notes.key_id IS NULL"
+	params = append(params, whereParams...)
+
+	if opts.Limit > 0 {
+		limit = "LIMIT ? OFFSET ?"
+		params = append(params, opts.Limit, opts.Offset)
+	}
+
+	// The search is done in a sub query, so that the content column of the
+	// index is not confused with the one in the notes table.
+	sqlQuery := fmt.Sprintf(`SELECT %v, m.score, m.snip FROM notes
+		JOIN (
+			SELECT rowid, bm25(notes_fts) AS score, %v AS snip
+			FROM notes_fts WHERE notes_fts MATCH ?
+		) AS m ON m.rowid = notes.id
+		%v ORDER BY m.score %v`,
+		allNoteColumns, snippetSql, where, limit,
+	)
+
+	rows, err := d.db.QueryContext(ctx, sqlQuery, params...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		var result SearchResult
+		note, err := d.scanNote(rows, &result.Rank, &result.Snippet)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Note = *note
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// ftsQuery converts user input to an FTS5 query. Every term is quoted, so
+// that FTS5 operators in the input are matched literally.
+func ftsQuery(query string, prefix, phrase bool) string {
+	star := ""
+	if prefix {
+		star = "*"
+	}
+
+	if phrase {
+		trimmed := strings.TrimSpace(query)
+		if trimmed == "" {
+			return ""
+		}
+		return quoteFts(trimmed) + star
+	}
+
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = quoteFts(term) + star
+	}
+	return strings.Join(terms, " ")
+}
+
+func quoteFts(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+// migrateSearchIndex creates the first version of the search index, if the sqlite
+// driver supports it. It is replaced by migrateSearchQueue.
+func migrateSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	available, err := fts5Available(ctx, tx)
+	if err != nil || !available {
+		return err
+	}
+	return execAll(
+		createSearchTableSql,
+		createSearchInsertTriggerSql,
+		createSearchDeleteTriggerSql,
+		createSearchUpdateTriggerSql,
+		rebuildSearchSql,
+	)(ctx, tx)
+}
+
+// migrateSearchQueue replaces the triggers that wrote to the search index with the ones
+// that queue changed notes, and recreates the index if the sqlite driver supports it.
+// Without FTS5, the first version of the index cannot be dropped, it is replaced by
+// ensureSearchIndex once a build with FTS5 opens the database.
+func migrateSearchQueue(ctx context.Context, tx *sql.Tx) error {
+	err := execAll(
+		"DROP TRIGGER IF EXISTS notes_fts_insert",
+		"DROP TRIGGER IF EXISTS notes_fts_delete",
+		"DROP TRIGGER IF EXISTS notes_fts_update",
+		createSearchQueueTableSql,
+		createSearchQueueInsertTriggerSql,
+		createSearchQueueUpdateTriggerSql,
+		createSearchQueueDeleteTriggerSql,
+	)(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	available, err := fts5Available(ctx, tx)
+	if err != nil || !available {
+		return err
+	}
+	return createSearchIndex(ctx, tx)
+}
+
+// createSearchIndex creates the search index of all notes, replacing any previous one
+func createSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	return execAll(
+		"DROP TABLE IF EXISTS notes_fts",
+		createSearchIndexSql,
+		fillSearchIndexSql,
+		"DELETE FROM search_queue",
+	)(ctx, tx)
+}
+
+// ensureSearchIndex creates the search index for databases that were migrated
+// by a build of note without FTS5 support.
+func (d *DB) ensureSearchIndex(ctx context.Context) error {
+	exists, err := hasSearchIndex(ctx, d.db)
+	if err != nil || exists {
+		return err
+	}
+	available, err := fts5Available(ctx, d.db)
+	if err != nil || !available {
+		return err
+	}
+
+	tx, err := d.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := createSearchIndex(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// syncSearchIndex updates the search index with the notes that were queued, as they
+// were added, changed or removed
+func (d *conn) syncSearchIndex(ctx context.Context) error {
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{syncSearchDeleteSql, syncSearchInsertSql, "DELETE FROM search_queue"} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("update search index: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func fts5Available(ctx context.Context, q queryRower) (bool, error) {
+	var used bool
+	err := q.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	if err != nil {
+		return false, fmt.Errorf("compile options: %w", err)
+	}
+	return used, nil
+}
+
+// hasSearchIndex is true if the search index exists, and the sqlite driver supports it.
+// The first version of the index, which had no content table of its own, does not count.
+func hasSearchIndex(ctx context.Context, q queryRower) (bool, error) {
+	available, err := fts5Available(ctx, q)
+	if err != nil || !available {
+		return false, err
+	}
+
+	var count int
+	err = q.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'notes_fts_content'",
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("search index lookup: %w", err)
+	}
+	return count > 0, nil
+}
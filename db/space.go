@@ -0,0 +1,389 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// SpaceSeparator separates the levels of nested spaces, as in work/project
+	SpaceSeparator = "/"
+
+	// A space is hidden, if it starts with '.', unless it is changed.
+	// The default sort and style are used when listing only that space.
+	createSpacesTableSql = `CREATE TABLE IF NOT EXISTS spaces (
+		name TEXT NOT NULL PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		created DATETIME DEFAULT CURRENT_TIMESTAMP,
+		hidden BOOLEAN NOT NULL DEFAULT 0,
+		default_sort TEXT,
+		default_style TEXT);`
+
+	populateSpacesSql = `INSERT OR IGNORE INTO spaces (name, created, hidden)
+		SELECT space, MIN(created), space LIKE '.%' FROM notes GROUP BY space;`
+
+	createSpaceIndexSql = `CREATE INDEX IF NOT EXISTS notes_space ON notes (space);`
+
+	// Spaces are created when a note is added to them
+	createSpaceInsertTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_space_insert
+		AFTER INSERT ON notes
+		FOR EACH ROW
+		BEGIN
+			INSERT OR IGNORE INTO spaces (name, hidden) VALUES (NEW.space, NEW.space LIKE '.%');
+		END;`
+
+	createSpaceUpdateTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_space_update
+		AFTER UPDATE OF space ON notes
+		FOR EACH ROW WHEN OLD.space IS NOT NEW.space
+		BEGIN
+			INSERT OR IGNORE INTO spaces (name, hidden) VALUES (NEW.space, NEW.space LIKE '.%');
+			` + deleteUnusedSpaceSql + `
+		END;`
+
+	createSpaceDeleteTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_space_delete
+		AFTER DELETE ON notes
+		FOR EACH ROW
+		BEGIN
+			` + deleteUnusedSpaceSql + `
+		END;`
+
+	// Empty spaces are removed, unless they have been described or configured
+	deleteUnusedSpaceSql = `DELETE FROM spaces WHERE name = OLD.space
+				AND description = '' AND hidden = (name LIKE '.%')
+				AND default_sort IS NULL AND default_style IS NULL
+				AND NOT EXISTS (SELECT 1 FROM notes WHERE space = OLD.space);`
+
+	spaceColumns = `name, description, created, hidden, default_sort, default_style,
+		(SELECT COUNT(*) FROM notes WHERE notes.space = spaces.name), key_id`
+)
+
+type Space struct {
+	Name         string
+	Description  string
+	Created      time.Time
+	Hidden       bool
+	DefaultSort  Column // Empty means no default
+	DefaultStyle string // Empty means no default
+	Count        int    // Number of notes in the space
+	Encrypted    bool   // New notes in the space are encrypted
+	Locked       bool   // The space is encrypted and its key is not unlocked
+}
+
+// SpaceUpdate changes the fields that are not nil
+type SpaceUpdate struct {
+	Description  *string
+	Hidden       *bool
+	DefaultSort  *Column
+	DefaultStyle *string
+}
+
+// Spaces lists spaces, with the number of notes in each
+func (d *conn) Spaces(ctx context.Context, all bool, ascending bool) ([]Space, error) {
+	where := ""
+	if !all {
+		where = "WHERE NOT hidden"
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %v FROM spaces %v ORDER BY name %v",
+		spaceColumns, where, orderString(ascending),
+	)
+	rows, err := d.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	spaces := make([]Space, 0)
+	for rows.Next() {
+		space, err := d.scanSpace(rows)
+		if err != nil {
+			return nil, err
+		}
+		spaces = append(spaces, *space)
+	}
+	return spaces, rows.Err()
+}
+
+func (d *conn) GetSpace(ctx context.Context, name string) (*Space, error) {
+	query := fmt.Sprintf("SELECT %v FROM spaces WHERE name = ?", spaceColumns)
+	space, err := d.scanSpace(d.db.QueryRowContext(ctx, query, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("space %v: %w", name, ErrNotFound)
+	}
+	return space, err
+}
+
+// UpdateSpace changes the metadata of a space, which is created if it does not exist
+func (d *conn) UpdateSpace(ctx context.Context, name string, update SpaceUpdate) error {
+	var (
+		sets   = []string{}
+		params = []any{}
+	)
+	if update.Description != nil {
+		sets = append(sets, "description = ?")
+		params = append(params, *update.Description)
+	}
+	if update.Hidden != nil {
+		sets = append(sets, "hidden = ?")
+		params = append(params, *update.Hidden)
+	}
+	if update.DefaultSort != nil {
+		sets = append(sets, "default_sort = ?")
+		params = append(params, nullIfEmpty(string(*update.DefaultSort)))
+	}
+	if update.DefaultStyle != nil {
+		sets = append(sets, "default_style = ?")
+		params = append(params, nullIfEmpty(*update.DefaultStyle))
+	}
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT OR IGNORE INTO spaces (name, hidden) VALUES (?, ? LIKE '.%')",
+		name, name,
+	)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+
+	if len(sets) > 0 {
+		query := fmt.Sprintf("UPDATE spaces SET %v WHERE name = ?", strings.Join(sets, ", "))
+		if _, err := tx.ExecContext(ctx, query, append(params, name)...); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RenameSpace renames a space and all spaces nested below it, moving their notes.
+// It is an error if any of the new names already exist.
+func (d *conn) RenameSpace(ctx context.Context, from, to string) error {
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	names, err := subtreeSpaces(ctx, tx, from)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		renamed := to + strings.TrimPrefix(name, from)
+
+		var exists bool
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM spaces WHERE name = ?", renamed).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("query error: %w", err)
+		} else if exists {
+			return fmt.Errorf("space %v: %w", renamed, ErrExists)
+		}
+	}
+
+	for _, name := range names {
+		if err := renameSpace(ctx, tx, name, to+strings.TrimPrefix(name, from)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MergeSpaces moves all notes from the spaces in from, and the spaces nested below them,
+// to the space to. Nested spaces are merged into the corresponding spaces below to.
+func (d *conn) MergeSpaces(ctx context.Context, from []string, to string) error {
+	if len(from) < 1 {
+		return fmt.Errorf("require at least one space")
+	}
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, space := range from {
+		if space == to {
+			continue
+		}
+
+		names, err := subtreeSpaces(ctx, tx, space)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			merged := to + strings.TrimPrefix(name, space)
+
+			var exists bool
+			err = tx.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM spaces WHERE name = ?", merged).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("query error: %w", err)
+			}
+
+			// A space that does not exist in the destination keeps its metadata
+			if !exists {
+				if err := renameSpace(ctx, tx, name, merged); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, "DELETE FROM spaces WHERE name = ?", name); err != nil {
+				return fmt.Errorf("remove space: %w", err)
+			}
+			if err := moveSpace(ctx, tx, name, merged); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The destination exists, even if the merged spaces were empty
+	_, err = tx.ExecContext(ctx,
+		"INSERT OR IGNORE INTO spaces (name, hidden) VALUES (?, ? LIKE '.%')",
+		to, to,
+	)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+
+	// Notes merged into an encrypted space are encrypted
+	sealed, err := d.keys.seal(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return d.commitSealed(ctx, tx, sealed)
+}
+
+// subtreeSpaces lists a space and all spaces nested below it, it is an error if there are none
+func subtreeSpaces(ctx context.Context, tx querier, space string) ([]string, error) {
+	query := fmt.Sprintf("SELECT name FROM spaces WHERE %v ORDER BY name", subtreeCondition("name"))
+	rows, err := tx.QueryContext(ctx, query, subtreeParams(space)...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("row scan error: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("space %v: %w", space, ErrNotFound)
+	}
+	return names, nil
+}
+
+// renameSpace renames a single space row before its notes are moved, so that the metadata is kept
+func renameSpace(ctx context.Context, tx querier, from, to string) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE spaces SET name = ?, hidden = CASE WHEN hidden = (name LIKE '.%') THEN ? LIKE '.%' ELSE hidden END WHERE name = ?",
+		to, to, from,
+	)
+	if err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	return moveSpace(ctx, tx, from, to)
+}
+
+// subtreeCondition matches a space and all spaces nested below it, given subtreeParams
+func subtreeCondition(column string) string {
+	return fmt.Sprintf("(%[1]v = ? OR (%[1]v >= ? AND %[1]v < ?))", column)
+}
+
+// subtreeParams are the parameters of subtreeCondition. All nested spaces begin
+// with "space/", which sorts before "space0" since '0' follows '/'.
+func subtreeParams(space string) []any {
+	return []any{space, space + SpaceSeparator, space + "0"}
+}
+
+// moveSpace moves all notes, including the trashed ones, from a space to another
+func moveSpace(ctx context.Context, tx querier, from, to string) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE notes SET space = ? WHERE space = ?", to, from); err != nil {
+		return fmt.Errorf("move notes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE trash SET origin = ? WHERE origin = ?", to, from); err != nil {
+		return fmt.Errorf("move trash: %w", err)
+	}
+	return nil
+}
+
+func (d *conn) scanSpace(scanner Scanner) (*Space, error) {
+	var (
+		space        Space
+		created      string
+		defaultSort  sql.NullString
+		defaultStyle sql.NullString
+		keyID        sql.NullInt64
+	)
+	err := scanner.Scan(
+		&space.Name,
+		&space.Description,
+		&created,
+		&space.Hidden,
+		&defaultSort,
+		&defaultStyle,
+		&space.Count,
+		&keyID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scan error: %w", err)
+	}
+
+	space.Created, err = parseTime(created)
+	if err != nil {
+		return nil, fmt.Errorf("conversion error: %w", err)
+	}
+	space.DefaultSort = Column(defaultSort.String)
+	space.DefaultStyle = defaultStyle.String
+	if keyID.Valid {
+		space.Encrypted = true
+		_, err := d.keys.get(keyID.Int64)
+		space.Locked = err != nil
+	}
+	return &space, nil
+}
+
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	createTagsTableSql = `CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE);`
+
+	createNoteTagsTableSql = `CREATE TABLE IF NOT EXISTS note_tags (
+		note_id INTEGER NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+		PRIMARY KEY (note_id, tag_id));`
+
+	// Tags only exist as long as some note is tagged with it
+	createTagCleanupTriggerSql = `CREATE TRIGGER IF NOT EXISTS note_tags_cleanup
+		AFTER DELETE ON note_tags
+		FOR EACH ROW
+		BEGIN
+			DELETE FROM tags WHERE id = OLD.tag_id
+				AND NOT EXISTS (SELECT 1 FROM note_tags WHERE tag_id = OLD.tag_id);
+		END;`
+
+	// Selects the tags of a note, as a comma separated list (or NULL)
+	noteTagsSql = `(SELECT group_concat(t.name, ',' ORDER BY t.name)
+		FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id = notes.id)`
+)
+
+// AddTags tags all notes with all tags. Tagging a note twice with the same tag is not an error.
+func (d *conn) AddTags(ctx context.Context, ids []int, tags []string) error {
+	if len(ids) < 1 {
+		return fmt.Errorf("require at least one id")
+	} else if len(tags) < 1 {
+		return fmt.Errorf("require at least one tag")
+	}
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertTags(ctx, tx, ids, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetTags replaces the tags of a note, no tags removes all of them
+func (d *conn) SetTags(ctx context.Context, id int, tags []string) error {
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM note_tags WHERE note_id = ?", id); err != nil {
+		return fmt.Errorf("untag note %v: %w", id, err)
+	}
+	if err := insertTags(ctx, tx, []int{id}, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertTags(ctx context.Context, tx querier, ids []int, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return fmt.Errorf("insert tag: %w", err)
+		}
+
+		for _, id := range ids {
+			_, err := tx.ExecContext(ctx,
+				`INSERT OR IGNORE INTO note_tags (note_id, tag_id)
+				SELECT ?, id FROM tags WHERE name = ?`,
+				id, tag,
+			)
+			if err != nil {
+				return fmt.Errorf("tag note %v: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveTags removes the tags from all notes. Removing a tag that a note does not have is not an error.
+func (d *conn) RemoveTags(ctx context.Context, ids []int, tags []string) error {
+	if len(ids) < 1 {
+		return fmt.Errorf("require at least one id")
+	} else if len(tags) < 1 {
+		return fmt.Errorf("require at least one tag")
+	}
+
+	idsQ := strings.Join(repeatString("?", len(ids)), ", ")
+	tagsQ := strings.Join(repeatString("?", len(tags)), ", ")
+	query := fmt.Sprintf(
+		`DELETE FROM note_tags WHERE note_id IN (%v)
+		AND tag_id IN (SELECT id FROM tags WHERE name IN (%v))`,
+		idsQ, tagsQ,
+	)
+
+	params := append(sliceToAny(ids), sliceToAny(tags)...)
+	if _, err := d.db.ExecContext(ctx, query, params...); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// ListTags lists the tags in use, in alphabetical order.
+// If ids are given, only tags of those notes are listed.
+func (d *conn) ListTags(ctx context.Context, ids []int, ascending bool) ([]string, error) {
+	var (
+		params = []any{}
+		where  = ""
+	)
+	if len(ids) > 0 {
+		idsQ := strings.Join(repeatString("?", len(ids)), ", ")
+		where = fmt.Sprintf(
+			"WHERE id IN (SELECT tag_id FROM note_tags WHERE note_id IN (%v))",
+			idsQ,
+		)
+		params = sliceToAny(ids)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT name FROM tags %v ORDER BY name %v",
+		where, orderString(ascending),
+	)
+	rows, err := d.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make([]string, 0)
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("row scan error: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
@@ -0,0 +1,293 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// ParseDuration extends time.ParseDuration with days (d) and weeks (w).
+// A single unit is supported for days and weeks, for example: 30d or 2w.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = day
+	case strings.HasSuffix(s, "w"):
+		unit = week
+	default:
+		return time.ParseDuration(s)
+	}
+
+	count, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid duration: %v", s)
+	}
+	return time.Duration(count * float64(unit)), nil
+}
+
+var timeLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+}
+
+// ParseTime parses a point in time, either as a duration before now (7d, 12h),
+// as a date or date and time in local time, or in RFC 3339 format.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if age, err := ParseDuration(s); err == nil {
+		return now.Add(-age), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %v (expected e.g. 7d or 2024-10-01)", s)
+}
+
+var (
+	weekdays = map[string]time.Weekday{
+		"sunday": time.Sunday, "sun": time.Sunday,
+		"monday": time.Monday, "mon": time.Monday,
+		"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+		"wednesday": time.Wednesday, "wed": time.Wednesday,
+		"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+		"friday": time.Friday, "fri": time.Friday,
+		"saturday": time.Saturday, "sat": time.Saturday,
+	}
+
+	// Month names are matched regardless of case
+	dayLayouts = []string{
+		"Jan 2 2006", "January 2 2006", "Jan 2, 2006", "January 2, 2006",
+		"2 Jan 2006", "2 January 2006",
+	}
+	dayOfYearLayouts = []string{
+		"Jan 2", "January 2", "2 Jan", "2 January",
+	}
+
+	clockLayouts = []string{"15:04", "15:04:05", "3pm", "3:04pm"}
+)
+
+// ParseDate parses a point in time, as used for due dates and reminders. Besides
+// dates and times in the formats of ParseTime, it understands expressions such as:
+//
+//	now, today, tomorrow, yesterday
+//	friday, this friday, next friday, next week, next month, next year
+//	oct 21, 21 october 2026
+//	in 3 days, in 2 weeks, in 1h30m, +3d
+//
+// followed by an optional time: 10:00, at 9am, 3:30pm, noon or midnight.
+// A day without a time is at midnight, a time without a day is its next occurrence.
+// A weekday is the next one from today, "next" skips today. A day of the year
+// without a year is the next one from today.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	words := strings.Fields(strings.ToLower(s))
+	if n := len(words); n > 1 && (words[n-1] == "am" || words[n-1] == "pm") {
+		words = append(words[:n-2], words[n-2]+words[n-1])
+	}
+
+	clock, hasClock := time.Time{}, false
+	if n := len(words); n > 0 {
+		if clock, hasClock = parseClock(words[n-1]); hasClock {
+			words = words[:n-1]
+			if n := len(words); n > 0 && words[n-1] == "at" {
+				words = words[:n-1]
+			}
+		}
+	}
+
+	invalid := fmt.Errorf("invalid date: %v (expected e.g. tomorrow, next friday 10:00 or 2024-10-01)", s)
+	if len(words) == 0 {
+		if !hasClock {
+			return time.Time{}, invalid
+		}
+		t := atClock(now, clock)
+		if t.Before(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	t, ok := parseDay(strings.Join(words, " "), now)
+	if !ok {
+		return time.Time{}, invalid
+	}
+	if hasClock {
+		t = atClock(t, clock)
+	}
+	return t, nil
+}
+
+// parseDay parses the day of ParseDate, which is at midnight unless it is relative to now
+func parseDay(s string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch s {
+	case "now":
+		return now, true
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	case "next week":
+		days := (int(time.Monday) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return today.AddDate(0, 0, days), true
+	case "next month":
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()), true
+	case "next year":
+		return time.Date(now.Year()+1, time.January, 1, 0, 0, 0, 0, now.Location()), true
+	}
+
+	if rest, ok := strings.CutPrefix(s, "in "); ok {
+		return addRelative(rest, now)
+	} else if rest, ok := strings.CutPrefix(s, "+"); ok {
+		return addRelative(rest, now)
+	}
+
+	name, next := s, false
+	if rest, ok := strings.CutPrefix(s, "next "); ok {
+		name, next = rest, true
+	} else if rest, ok := strings.CutPrefix(s, "this "); ok {
+		name = rest
+	}
+	if weekday, ok := weekdays[name]; ok {
+		days := (int(weekday) - int(today.Weekday()) + 7) % 7
+		if days == 0 && next {
+			days = 7
+		}
+		return today.AddDate(0, 0, days), true
+	}
+
+	if t, err := time.ParseInLocation(time.DateOnly, s, now.Location()); err == nil {
+		return t, true
+	}
+	for _, layout := range dayLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, true
+		}
+	}
+	for _, layout := range dayOfYearLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			t = time.Date(now.Year(), t.Month(), t.Day(), 0, 0, 0, 0, now.Location())
+			if t.Before(today) {
+				t = t.AddDate(1, 0, 0)
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// addRelative adds a duration (1h30m, 3d) or a count of units (3 days, 1 month) to now
+func addRelative(s string, now time.Time) (time.Time, bool) {
+	if d, err := ParseDuration(s); err == nil {
+		return now.Add(d), true
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return time.Time{}, false
+	}
+	count, err := strconv.Atoi(fields[0])
+	if err != nil || count < 0 {
+		return time.Time{}, false
+	}
+
+	switch strings.TrimSuffix(fields[1], "s") {
+	case "minute", "min":
+		return now.Add(time.Duration(count) * time.Minute), true
+	case "hour":
+		return now.Add(time.Duration(count) * time.Hour), true
+	case "day":
+		return now.AddDate(0, 0, count), true
+	case "week":
+		return now.AddDate(0, 0, 7*count), true
+	case "month":
+		return addMonths(now, count), true
+	case "year":
+		return addMonths(now, 12*count), true
+	}
+	return time.Time{}, false
+}
+
+// addMonths adds months to t, on the last day of the month if it is shorter than the day of t
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(t.Day(), last), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// parseClock parses a time of day, the date of the result is not used
+func parseClock(s string) (time.Time, bool) {
+	switch s {
+	case "noon":
+		return time.Date(0, 1, 1, 12, 0, 0, 0, time.UTC), true
+	case "midnight":
+		return time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC), true
+	}
+	for _, layout := range clockLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// atClock is the day of t, at the time of day of clock
+func atClock(t time.Time, clock time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, t.Location())
+}
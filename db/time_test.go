@@ -0,0 +1,175 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// dateNow is a Tuesday afternoon
+var dateNow = time.Date(2024, 10, 15, 14, 30, 0, 0, time.Local)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		// Dates and times
+		{"2024-12-24", localDate(2024, 12, 24, 0, 0)},
+		{"2024-12-24 10:30", localDate(2024, 12, 24, 10, 30)},
+		{"2024-12-24T10:30", localDate(2024, 12, 24, 10, 30)},
+		{"2024-12-24T10:30:00Z", time.Date(2024, 12, 24, 10, 30, 0, 0, time.UTC)},
+
+		// Days
+		{"now", dateNow},
+		{"Today", localDate(2024, 10, 15, 0, 0)},
+		{"tomorrow", localDate(2024, 10, 16, 0, 0)},
+		{"yesterday", localDate(2024, 10, 14, 0, 0)},
+		{"next week", localDate(2024, 10, 21, 0, 0)},
+		{"next month", localDate(2024, 11, 1, 0, 0)},
+		{"next year", localDate(2025, 1, 1, 0, 0)},
+
+		// Weekdays
+		{"friday", localDate(2024, 10, 18, 0, 0)},
+		{"fri", localDate(2024, 10, 18, 0, 0)},
+		{"this friday", localDate(2024, 10, 18, 0, 0)},
+		{"next friday", localDate(2024, 10, 18, 0, 0)},
+		{"tuesday", localDate(2024, 10, 15, 0, 0)},
+		{"this tuesday", localDate(2024, 10, 15, 0, 0)},
+		{"next tuesday", localDate(2024, 10, 22, 0, 0)},
+		{"monday", localDate(2024, 10, 21, 0, 0)},
+		{"sunday", localDate(2024, 10, 20, 0, 0)},
+
+		// Days of the year
+		{"oct 21", localDate(2024, 10, 21, 0, 0)},
+		{"October 15", localDate(2024, 10, 15, 0, 0)},
+		{"oct 1", localDate(2025, 10, 1, 0, 0)},
+		{"2 january", localDate(2025, 1, 2, 0, 0)},
+		{"21 october 2026", localDate(2026, 10, 21, 0, 0)},
+		{"Jan 2, 2023", localDate(2023, 1, 2, 0, 0)},
+
+		// Relative to now
+		{"in 3 days", localDate(2024, 10, 18, 14, 30)},
+		{"in 1 day", localDate(2024, 10, 16, 14, 30)},
+		{"in 2 weeks", localDate(2024, 10, 29, 14, 30)},
+		{"in 1h30m", localDate(2024, 10, 15, 16, 0)},
+		{"in 2 hours", localDate(2024, 10, 15, 16, 30)},
+		{"in 10 min", localDate(2024, 10, 15, 14, 40)},
+		{"in 1 month", localDate(2024, 11, 15, 14, 30)},
+		{"in 1 year", localDate(2025, 10, 15, 14, 30)},
+		{"+3d", localDate(2024, 10, 18, 14, 30)},
+
+		// Times of day, without a day
+		{"15:00", localDate(2024, 10, 15, 15, 0)},
+		{"14:30", localDate(2024, 10, 15, 14, 30)},
+		{"10:00", localDate(2024, 10, 16, 10, 0)},
+		{"3:30pm", localDate(2024, 10, 15, 15, 30)},
+		{"9am", localDate(2024, 10, 16, 9, 0)},
+		{"9 am", localDate(2024, 10, 16, 9, 0)},
+		{"at 9am", localDate(2024, 10, 16, 9, 0)},
+		{"at 6 PM", localDate(2024, 10, 15, 18, 0)},
+		{"noon", localDate(2024, 10, 16, 12, 0)},
+		{"midnight", localDate(2024, 10, 16, 0, 0)},
+
+		// Times of day, with a day
+		{"tomorrow 10:00", localDate(2024, 10, 16, 10, 0)},
+		{"tomorrow at 9am", localDate(2024, 10, 16, 9, 0)},
+		{"today 9am", localDate(2024, 10, 15, 9, 0)},
+		{"next friday 10:00", localDate(2024, 10, 18, 10, 0)},
+		{"friday 3 pm", localDate(2024, 10, 18, 15, 0)},
+		{"oct 21 at noon", localDate(2024, 10, 21, 12, 0)},
+		{"next week at midnight", localDate(2024, 10, 21, 0, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			got, err := ParseDate(test.s, dateNow)
+			if err != nil {
+				t.Fatalf("ParseDate(%q): %v", test.s, err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("ParseDate(%q) = %v, want %v", test.s, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDateEdges(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		now  time.Time
+		want time.Time
+	}{
+		{"weekday wraps", "monday", localDate(2024, 10, 19, 12, 0), localDate(2024, 10, 21, 0, 0)},
+		{"weekday wraps to today", "saturday", localDate(2024, 10, 19, 12, 0), localDate(2024, 10, 19, 0, 0)},
+		{"next skips today", "next saturday", localDate(2024, 10, 19, 12, 0), localDate(2024, 10, 26, 0, 0)},
+		{"next week on monday", "next week", localDate(2024, 10, 21, 12, 0), localDate(2024, 10, 28, 0, 0)},
+		{"next week on sunday", "next week", localDate(2024, 10, 20, 12, 0), localDate(2024, 10, 21, 0, 0)},
+		{"next month at end of month", "next month", localDate(2025, 1, 31, 12, 0), localDate(2025, 2, 1, 0, 0)},
+		{"next month in december", "next month", localDate(2024, 12, 15, 12, 0), localDate(2025, 1, 1, 0, 0)},
+		{"month at end of month", "in 1 month", localDate(2025, 1, 31, 12, 0), localDate(2025, 2, 28, 12, 0)},
+		{"month in leap year", "in 1 month", localDate(2024, 1, 31, 12, 0), localDate(2024, 2, 29, 12, 0)},
+		{"months over a year", "in 13 months", localDate(2024, 1, 31, 12, 0), localDate(2025, 2, 28, 12, 0)},
+		{"year from leap day", "in 1 year", localDate(2024, 2, 29, 12, 0), localDate(2025, 2, 28, 12, 0)},
+		{"day of year wraps", "jan 1", localDate(2024, 12, 31, 12, 0), localDate(2025, 1, 1, 0, 0)},
+		{"time wraps", "1am", localDate(2024, 12, 31, 23, 0), localDate(2025, 1, 1, 1, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseDate(test.s, test.now)
+			if err != nil {
+				t.Fatalf("ParseDate(%q): %v", test.s, err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("ParseDate(%q) = %v, want %v", test.s, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"someday",
+		"at",
+		"at 9am tomorrow",
+		"next",
+		"next noon",
+		"this week",
+		"in",
+		"in 3",
+		"in -3 days",
+		"in 3 fortnights",
+		"in three days",
+		"25:00",
+		"friday 9 xm",
+		"oct 32",
+	}
+	for _, s := range tests {
+		t.Run(s, func(t *testing.T) {
+			if got, err := ParseDate(s, dateNow); err == nil {
+				t.Errorf("ParseDate(%q) = %v, want error", s, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	TrashSpace = ".trash"
+
+	createTrashTableSql = `CREATE TABLE IF NOT EXISTS trash (
+		note_id INTEGER NOT NULL PRIMARY KEY REFERENCES notes (id) ON DELETE CASCADE,
+		origin TEXT NOT NULL,
+		trashed DATETIME DEFAULT CURRENT_TIMESTAMP);`
+
+	// Remember where a note came from, when it is moved to the trash
+	createTrashTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_trash
+		AFTER UPDATE OF space ON notes
+		FOR EACH ROW WHEN NEW.space = '` + TrashSpace + `' AND OLD.space IS NOT '` + TrashSpace + `'
+		BEGIN
+			INSERT OR REPLACE INTO trash (note_id, origin, trashed)
+			VALUES (NEW.id, OLD.space, CURRENT_TIMESTAMP);
+		END;`
+
+	// Forget the origin of a note, when it leaves the trash
+	createUntrashTriggerSql = `CREATE TRIGGER IF NOT EXISTS notes_untrash
+		AFTER UPDATE OF space ON notes
+		FOR EACH ROW WHEN NEW.space IS NOT '` + TrashSpace + `'
+		BEGIN
+			DELETE FROM trash WHERE note_id = NEW.id;
+		END;`
+
+	// Notes trashed before the trash was tracked have no record. For those, the
+	// last update (which was likely the move to trash) is the best guess.
+	trashedSql = "COALESCE(trash.trashed, notes.last_updated)"
+)
+
+// A note in the trash, along with the space it was removed from
+type TrashedNote struct {
+	Note
+	Origin  string // empty if unknown
+	Trashed time.Time
+}
+
+// TrashNotes moves notes to the trash, where they can later be restored from
+func (d *conn) TrashNotes(ctx context.Context, ids []int) error {
+	return d.MoveNotes(ctx, ids, TrashSpace)
+}
+
+// SelectTrash lists the notes in the trash, oldest first.
+// If before is not zero, only notes trashed before that time are listed.
+// Notes that are encrypted and locked are not listed, see LockedTrash.
+func (d *conn) SelectTrash(ctx context.Context, before time.Time) ([]TrashedNote, error) {
+	where, params := trashCondition(before)
+	unlocked, unlockedParams := d.unlockedCondition()
+
+	query := fmt.Sprintf(
+		`SELECT %v, COALESCE(trash.origin, ''), %v
+		FROM notes LEFT JOIN trash ON trash.note_id = notes.id
+		WHERE %v AND %v ORDER BY %v ASC, notes.id ASC`,
+		allNoteColumns, trashedSql, where, unlocked, trashedSql,
+	)
+	params = append(params, unlockedParams...)
+	rows, err := d.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	notes := make([]TrashedNote, 0)
+	for rows.Next() {
+		var (
+			trashed TrashedNote
+			when    string
+		)
+		note, err := d.scanNote(rows, &trashed.Origin, &when)
+		if err != nil {
+			return nil, err
+		}
+
+		trashed.Note = *note
+		if trashed.Trashed, err = parseTime(when); err != nil {
+			return nil, fmt.Errorf("conversion error: %w", err)
+		}
+		notes = append(notes, trashed)
+	}
+
+	return notes, rows.Err()
+}
+
+// LockedTrash counts the notes in the trash that SelectTrash leaves out,
+// as they are encrypted and locked
+func (d *conn) LockedTrash(ctx context.Context, before time.Time) (int, error) {
+	where, params := trashCondition(before)
+	unlocked, unlockedParams := d.unlockedCondition()
+
+	query := fmt.Sprintf(
+		`SELECT COUNT(*) FROM notes LEFT JOIN trash ON trash.note_id = notes.id
+		WHERE %v AND NOT (%v)`,
+		where, unlocked,
+	)
+	var count int
+	if err := d.db.QueryRowContext(ctx, query, append(params, unlockedParams...)...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("query error: %w", err)
+	}
+	return count, nil
+}
+
+// trashCondition selects the notes in the trash, that were trashed before unless it is zero
+func trashCondition(before time.Time) (string, []any) {
+	if before.IsZero() {
+		return "notes.space = ?", []any{TrashSpace}
+	}
+	return fmt.Sprintf("notes.space = ? AND %v < ?", trashedSql), []any{TrashSpace, formatTime(before)}
+}
+
+// RestoreNotes moves notes from the trash back to the space they were removed from.
+// Notes with an unknown origin are moved to the fallback space.
+func (d *conn) RestoreNotes(ctx context.Context, ids []int, fallback string) error {
+	count := len(ids)
+	if count < 1 {
+		return fmt.Errorf("require at least one id")
+	}
+
+	bracketQ := strings.Join(repeatString("?", count), ", ")
+	query := fmt.Sprintf(
+		`UPDATE notes SET space = COALESCE(
+			(SELECT origin FROM trash WHERE trash.note_id = notes.id), ?)
+		WHERE space = ? AND id IN (%v)`,
+		bracketQ,
+	)
+
+	// Nothing is restored unless all notes were in the trash
+	return d.sealed(ctx, func(c *conn) error {
+		return c.execIDs(ctx, "restored", query, ids, fallback, TrashSpace)
+	})
+}
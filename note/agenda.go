@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"slices"
+	"time"
+)
+
+// A group of notes in the agenda, such as the notes due today
+type AgendaGroup struct {
+	Name  string
+	Notes Notes
+}
+
+const (
+	AgendaOverdue  = "Overdue"
+	AgendaToday    = "Today"
+	AgendaThisWeek = "This week"
+	AgendaLater    = "Later"
+)
+
+// Agenda groups the notes with a due date by when they are due, relative to now: before today,
+// today, later this week (which ends on Sunday) and after this week. Each group is ordered by
+// due date, and every group is returned even if it is empty.
+func Agenda(notes Notes, now time.Time) []AgendaGroup {
+	due := make(Notes, 0, len(notes))
+	for _, n := range notes {
+		if n.Due != nil {
+			due = append(due, n)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b Note) int {
+		return a.Due.Compare(*b.Due)
+	})
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+	nextWeek := today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7)
+
+	groups := []AgendaGroup{
+		{Name: AgendaOverdue},
+		{Name: AgendaToday},
+		{Name: AgendaThisWeek},
+		{Name: AgendaLater},
+	}
+	for _, n := range due {
+		var i int
+		switch {
+		case n.Due.Before(today):
+			i = 0
+		case n.Due.Before(tomorrow):
+			i = 1
+		case n.Due.Before(nextWeek):
+			i = 2
+		default:
+			i = 3
+		}
+		groups[i].Notes = append(groups[i].Notes, n)
+	}
+	return groups
+}
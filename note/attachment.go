@@ -0,0 +1,206 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The directory next to a markdown or HTML note, in which its attachments are written
+const AttachmentsDirExt = ".attachments"
+
+// FileAttachment is the representation of an attachment in exported files, the data is base64 encoded
+type FileAttachment struct {
+	Filename string `json:"filename" yaml:"filename"`
+	MimeType string `json:"mime_type,omitempty" yaml:"mime_type,omitempty"`
+	SHA256   string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Size     int64  `json:"size" yaml:"size"`
+	Data     string `json:"data" yaml:"data"`
+}
+
+// NewAttachment creates an attachment of the file contents, the mime type is guessed
+// from the extension of the filename or, failing that, from the data
+func NewAttachment(filename string, data []byte) Attachment {
+	mimeType := mime.TypeByExtension(filepath.Ext(filename))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return Attachment{
+		Filename: filepath.Base(filename),
+		MimeType: mimeType,
+		Data:     data,
+	}
+}
+
+func FromAttachment(a Attachment) FileAttachment {
+	return FileAttachment{
+		Filename: a.Filename,
+		MimeType: a.MimeType,
+		SHA256:   a.SHA256,
+		Size:     a.Size,
+		Data:     base64.StdEncoding.EncodeToString(a.Data),
+	}
+}
+
+// ToAttachment decodes the data, which must match the checksum if there is one
+func (f FileAttachment) ToAttachment(noteID int) (Attachment, error) {
+	if err := CheckAttachmentName(f.Filename); err != nil {
+		return Attachment{}, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(f.Data)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("attachment %v: %w", f.Filename, err)
+	}
+
+	a := NewAttachment(f.Filename, data)
+	a.NoteID = noteID
+	if f.MimeType != "" {
+		a.MimeType = f.MimeType
+	}
+	if f.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(f.SHA256, hex.EncodeToString(sum[:])) {
+			return Attachment{}, fmt.Errorf("attachment %v: checksum mismatch", f.Filename)
+		}
+	}
+	return a, nil
+}
+
+// CheckAttachmentName verifies that the filename can be written to a directory as is
+func CheckAttachmentName(filename string) error {
+	if filename == "" || filename == "." || filename == ".." || filepath.Base(filename) != filename {
+		return fmt.Errorf("invalid attachment filename: %q", filename)
+	}
+	return nil
+}
+
+// WithAttachments reads the attachments of the note, including their data, into the file note
+func WithAttachments(ctx context.Context, s Ops, note FileNote) (FileNote, error) {
+	attachments, err := s.Attachments(ctx, note.ID, true)
+	if err != nil {
+		return note, err
+	}
+
+	note.Attachments = nil
+	for _, a := range attachments {
+		note.Attachments = append(note.Attachments, FromAttachment(a))
+	}
+	return note, nil
+}
+
+// addAttachments adds the attachments of an imported note, replacing those of the same name
+func addAttachments(ctx context.Context, s Ops, id int, attachments []FileAttachment) error {
+	for _, f := range attachments {
+		a, err := f.ToAttachment(id)
+		if err != nil {
+			return err
+		}
+		if _, err := s.AddAttachment(ctx, a, true); err != nil {
+			return fmt.Errorf("attach %v: %w", f.Filename, err)
+		}
+	}
+	return nil
+}
+
+// WriteAttachments writes the attachments as files in dir, which is created if needed.
+// Unless overwrite is set, no files are written if any of them already exist. If private
+// is set, the files and dir are only accessible by the user, as for an encrypted note.
+func WriteAttachments(dir string, attachments []FileAttachment, overwrite, private bool) ([]string, error) {
+	paths := make([]string, len(attachments))
+	data := make([][]byte, len(attachments))
+	for i, a := range attachments {
+		if err := CheckAttachmentName(a.Filename); err != nil {
+			return nil, err
+		}
+		paths[i] = filepath.Join(dir, a.Filename)
+
+		if _, err := os.Stat(paths[i]); err == nil && !overwrite {
+			return nil, fmt.Errorf("file already exists: %v", paths[i])
+		}
+
+		var err error
+		if data[i], err = base64.StdEncoding.DecodeString(a.Data); err != nil {
+			return nil, fmt.Errorf("attachment %v: %w", a.Filename, err)
+		}
+	}
+
+	dirPerm, filePerm := os.FileMode(0o755), os.FileMode(0o644)
+	if private {
+		dirPerm, filePerm = 0o700, 0o600
+	}
+	if len(attachments) > 0 {
+		if err := os.MkdirAll(dir, dirPerm); err != nil {
+			return nil, err
+		}
+	}
+	for i := range attachments {
+		// An existing file is replaced, rather than written, so that it does not keep its permissions
+		if private {
+			if err := os.Remove(paths[i]); err != nil && !os.IsNotExist(err) {
+				return paths[:i], err
+			}
+		}
+		if err := os.WriteFile(paths[i], data[i], filePerm); err != nil {
+			return paths[:i], err
+		}
+	}
+	return paths, nil
+}
+
+// readAttachments reads every file in dir as an attachment, a missing dir has none
+func readAttachments(dir string) ([]FileAttachment, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var attachments []FileAttachment
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, FromAttachment(NewAttachment(entry.Name(), data)))
+	}
+	return attachments, nil
+}
+
+// attachmentsDir is the sidecar directory of a note file: notes/12.md has notes/12.attachments
+func attachmentsDir(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + AttachmentsDirExt
+}
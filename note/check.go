@@ -0,0 +1,78 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"fmt"
+	"strings"
+)
+
+func CheckSpace(space string) error {
+	if strings.Contains(space, ",") {
+		return fmt.Errorf("space cannot contain the following character ','")
+	}
+	if space == "" {
+		return nil
+	}
+	for _, level := range strings.Split(space, SpaceSeparator) {
+		if level == "" {
+			return fmt.Errorf("nested space cannot have an empty level: %q", space)
+		}
+	}
+	return nil
+}
+
+func CheckTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tag cannot be empty")
+	}
+	if strings.Contains(tag, ",") {
+		return fmt.Errorf("tag cannot contain the following character ','")
+	}
+	return nil
+}
+
+// ParseTags splits a comma separated list of tags
+func ParseTags(arg string) ([]string, error) {
+	tags := strings.Split(arg, ",")
+	for i, tag := range tags {
+		tags[i] = strings.TrimSpace(tag)
+		if err := CheckTag(tags[i]); err != nil {
+			return nil, err
+		}
+	}
+	return unique(tags), nil
+}
+
+func unique[T comparable](slice []T) []T {
+	seen := make(map[T]bool)
+	result := []T{}
+
+	for _, value := range slice {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
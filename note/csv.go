@@ -0,0 +1,301 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// CSVColumns are the columns of a CSV file, as named in the header row
+	CSVColumns = []string{"id", "pinned", "space", "content", "created", "last_updated", "tags", "due", "remind_at"}
+
+	csvTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05"}
+)
+
+// CSVOpts controls how notes are written to, and read from, CSV (or TSV) files
+type CSVOpts struct {
+	Comma          rune     // field delimiter, ',' if zero
+	Columns        []string // columns in order, all CSVColumns if empty
+	NoHeader       bool     // the file has no header row, when reading the columns are given by Columns
+	QuoteAll       bool     // quote every field, not only the fields that need it
+	EscapeFormulas bool     // prefix fields a spreadsheet would read as a formula with ', which is kept on import
+}
+
+func (o CSVOpts) Check() error {
+	if o.Comma == '"' || o.Comma == '\r' || o.Comma == '\n' {
+		return fmt.Errorf("invalid delimiter: %q", o.Comma)
+	}
+	return checkCSVColumns(o.Columns)
+}
+
+func (o CSVOpts) comma() rune {
+	if o.Comma == 0 {
+		return ','
+	}
+	return o.Comma
+}
+
+func (o CSVOpts) columns() []string {
+	if len(o.Columns) == 0 {
+		return CSVColumns
+	}
+	return o.Columns
+}
+
+func checkCSVColumns(columns []string) error {
+	seen := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		if !slices.Contains(CSVColumns, column) {
+			return fmt.Errorf("unknown column: %v", column)
+		} else if seen[column] {
+			return fmt.Errorf("duplicate column: %v", column)
+		}
+		seen[column] = true
+	}
+	return nil
+}
+
+// NewCSVEncoder writes one row per note, after the header row. Content with line breaks
+// is quoted, so it stays within one field.
+func NewCSVEncoder(w io.Writer, opts CSVOpts) (Encoder, error) {
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.comma()
+	return &csvEncoder{w: w, writer: writer, opts: opts, header: !opts.NoHeader}, nil
+}
+
+type csvEncoder struct {
+	w      io.Writer
+	writer *csv.Writer
+	opts   CSVOpts
+	header bool // the header is yet to be written
+}
+
+func (e *csvEncoder) Encode(note FileNote) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	columns := e.opts.columns()
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = csvField(note, column)
+		if e.opts.EscapeFormulas {
+			record[i] = escapeFormula(record[i])
+		}
+	}
+	return e.write(record)
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if !e.header {
+		return nil
+	}
+	e.header = false
+	return e.write(e.opts.columns())
+}
+
+func (e *csvEncoder) write(record []string) error {
+	if !e.opts.QuoteAll {
+		return e.writer.Write(record)
+	}
+
+	// The csv package only quotes fields when necessary
+	quoted := make([]string, len(record))
+	for i, field := range record {
+		quoted[i] = `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+	}
+	_, err := io.WriteString(e.w, strings.Join(quoted, string(e.opts.comma()))+"\n")
+	return err
+}
+
+func csvField(note FileNote, column string) string {
+	switch column {
+	case "id":
+		return strconv.Itoa(note.ID)
+	case "pinned":
+		return strconv.FormatBool(note.Pinned)
+	case "space":
+		return note.Space
+	case "content":
+		return note.Content
+	case "created":
+		return note.Created.Format(time.RFC3339)
+	case "last_updated":
+		return note.LastUpdated.Format(time.RFC3339)
+	case "tags":
+		return strings.Join(note.Tags, ",")
+	case "due":
+		return csvTime(note.Due)
+	case "remind_at":
+		return csvTime(note.RemindAt)
+	}
+	return ""
+}
+
+// escapeFormula prefixes a field with ', if a spreadsheet would otherwise read it as a formula
+func escapeFormula(field string) string {
+	if field != "" && strings.ContainsRune("=+-@\t\r", rune(field[0])) {
+		return "'" + field
+	}
+	return field
+}
+
+// DecodeCSV reads one note per row. Unless opts.NoHeader is set, the columns are named by
+// the header row. Empty fields keep their zero value.
+func DecodeCSV(r io.Reader, opts CSVOpts) iter.Seq2[FileNote, error] {
+	return func(yield func(FileNote, error) bool) {
+		if err := opts.Check(); err != nil {
+			yield(FileNote{}, err)
+			return
+		}
+
+		reader := csv.NewReader(r)
+		reader.Comma = opts.comma()
+		reader.ReuseRecord = true
+
+		columns := opts.columns()
+		if !opts.NoHeader {
+			header, err := reader.Read()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(FileNote{}, err)
+				return
+			}
+
+			// Spreadsheet programs may begin the file with a byte order mark
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+			columns = slices.Clone(header)
+			if err = checkCSVColumns(columns); err != nil {
+				yield(FileNote{}, fmt.Errorf("header: %w", err))
+				return
+			}
+		}
+		if !slices.Contains(columns, "content") {
+			yield(FileNote{}, fmt.Errorf("missing column: content"))
+			return
+		}
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(FileNote{}, err)
+				return
+			}
+
+			if len(record) != len(columns) {
+				line, _ := reader.FieldPos(0)
+				yield(FileNote{}, fmt.Errorf("line %v: expected %v fields, got %v", line, len(columns), len(record)))
+				return
+			}
+
+			var note FileNote
+			for i, column := range columns {
+				if err = setCSVField(&note, column, record[i]); err != nil {
+					line, _ := reader.FieldPos(i)
+					err = fmt.Errorf("line %v, column %v: %w", line, column, err)
+					break
+				}
+			}
+			if !yield(note, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func setCSVField(note *FileNote, column, field string) error {
+	if field == "" {
+		return nil
+	}
+
+	var err error
+	switch column {
+	case "id":
+		note.ID, err = strconv.Atoi(field)
+	case "pinned":
+		note.Pinned, err = strconv.ParseBool(field)
+	case "space":
+		note.Space = field
+	case "content":
+		note.Content = field
+	case "created":
+		note.Created, err = parseCSVTime(field)
+	case "last_updated":
+		note.LastUpdated, err = parseCSVTime(field)
+	case "tags":
+		note.Tags, err = ParseTags(field)
+	case "due":
+		note.Due, err = parseCSVTimePtr(field)
+	case "remind_at":
+		note.RemindAt, err = parseCSVTimePtr(field)
+	}
+	return err
+}
+
+// csvTime formats an optional time, which is empty if it is not set
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseCSVTimePtr(field string) (*time.Time, error) {
+	t, err := parseCSVTime(field)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func parseCSVTime(field string) (time.Time, error) {
+	for _, layout := range csvTimeLayouts {
+		if t, err := time.Parse(layout, field); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %v", field)
+}
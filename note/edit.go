@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type AddOpts struct {
+	Space    string
+	Pinned   bool
+	Tags     []string
+	Due      *time.Time
+	RemindAt *time.Time
+}
+
+type EditOpts struct {
+	// Number of revisions kept, zero or less keeps all
+	KeepRevisions int
+}
+
+type RemoveOpts struct {
+	// Remove the notes from the database, instead of moving them to the trash
+	Permanent bool
+}
+
+// Add creates a new note and returns its id
+func Add(ctx context.Context, s Ops, content string, opts AddOpts) (int, error) {
+	if err := CheckSpace(opts.Space); err != nil {
+		return 0, err
+	}
+	for _, tag := range opts.Tags {
+		if err := CheckTag(tag); err != nil {
+			return 0, err
+		}
+	}
+
+	note := Note{
+		Space:    opts.Space,
+		Content:  content,
+		Pinned:   opts.Pinned,
+		Due:      opts.Due,
+		RemindAt: opts.RemindAt,
+	}
+
+	var id int64
+	err := inTx(ctx, s, func(s Ops) error {
+		var err error
+		if id, err = s.AddNote(ctx, note, false); err != nil {
+			return fmt.Errorf("add: %w", err)
+		}
+
+		if len(opts.Tags) > 0 {
+			if err = s.AddTags(ctx, []int{int(id)}, unique(opts.Tags)); err != nil {
+				return fmt.Errorf("tag: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// Edit replaces the content of a note, the previous content is kept as a revision
+func Edit(ctx context.Context, s Ops, id int, content string, opts EditOpts) error {
+	return inTx(ctx, s, func(s Ops) error {
+		if err := s.ReplaceContent(ctx, id, content); err != nil {
+			return fmt.Errorf("replace: %w", err)
+		}
+		if err := s.PruneRevisions(ctx, id, opts.KeepRevisions); err != nil {
+			return fmt.Errorf("prune revisions: %w", err)
+		}
+		return nil
+	})
+}
+
+// Move notes to another space. Unless all notes are moved, none are.
+func Move(ctx context.Context, s Ops, ids []int, space string) error {
+	if err := CheckSpace(space); err != nil {
+		return err
+	}
+	return inTx(ctx, s, func(s Ops) error {
+		return s.MoveNotes(ctx, unique(ids), space)
+	})
+}
+
+// Remove moves notes to the trash, or removes them permanently. Unless all notes are removed, none are.
+func Remove(ctx context.Context, s Ops, ids []int, opts RemoveOpts) error {
+	return inTx(ctx, s, func(s Ops) error {
+		if opts.Permanent {
+			return s.PermanentRemoveNotes(ctx, unique(ids))
+		}
+		return s.TrashNotes(ctx, unique(ids))
+	})
+}
+
+// Restore moves notes from the trash to the space they were removed from.
+// Notes with an unknown origin are moved to the fallback space.
+func Restore(ctx context.Context, s Ops, ids []int, fallback string) error {
+	if err := CheckSpace(fallback); err != nil {
+		return err
+	}
+	return s.RestoreNotes(ctx, unique(ids), fallback)
+}
+
+// TrashedIDs lists the notes in the trash, that were trashed before a point
+// in time. The zero time lists all of them.
+func TrashedIDs(ctx context.Context, s Ops, before time.Time) ([]int, error) {
+	trashed, err := s.SelectTrash(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(trashed))
+	for i, note := range trashed {
+		ids[i] = note.ID
+	}
+	return ids, nil
+}
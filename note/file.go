@@ -0,0 +1,118 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"fmt"
+	"time"
+)
+
+// FileNote is the representation of a note in exported files and in the HTTP API
+type FileNote struct {
+	ID          int       `json:"id" yaml:"id"`
+	Pinned      bool      `json:"pinned" yaml:"pinned"`
+	Space       string    `json:"space" yaml:"space"`
+	Content     string    `json:"content" yaml:"content"`
+	Created     time.Time `json:"created" yaml:"created"`
+	LastUpdated time.Time `json:"last_updated" yaml:"last_updated"`
+	Tags        []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	Due      *time.Time `json:"due,omitempty" yaml:"due,omitempty"`
+	RemindAt *time.Time `json:"remind_at,omitempty" yaml:"remind_at,omitempty"`
+
+	Attachments []FileAttachment `json:"attachments,omitempty" yaml:"attachments,omitempty"`
+}
+
+func FromNote(note Note) FileNote {
+	return FileNote{
+		ID:          note.ID,
+		Pinned:      note.Pinned,
+		Space:       note.Space,
+		Content:     note.Content,
+		Created:     note.Created,
+		LastUpdated: note.LastUpdated,
+		Tags:        note.Tags,
+		Due:         note.Due,
+		RemindAt:    note.RemindAt,
+	}
+}
+
+func FromNotes(notes Notes) []FileNote {
+	converted := make([]FileNote, len(notes))
+	for i, note := range notes {
+		converted[i] = FromNote(note)
+	}
+	return converted
+}
+
+// ToNote converts the file note, the ID is kept but ignored when the note is added
+func (f FileNote) ToNote() Note {
+	return Note{
+		ID:          f.ID,
+		Pinned:      f.Pinned,
+		Space:       f.Space,
+		Content:     f.Content,
+		Created:     f.Created,
+		LastUpdated: f.LastUpdated,
+		Tags:        f.Tags,
+		Due:         f.Due,
+		RemindAt:    f.RemindAt,
+	}
+}
+
+// SetDefaults fills in what a file may leave out. A note without a space is put in space,
+// and one without timestamps was created and last updated at now. If only one of the
+// timestamps is given, it is used for both.
+func (f *FileNote) SetDefaults(space string, now time.Time) {
+	if f.Space == "" {
+		f.Space = space
+	}
+	switch {
+	case f.Created.IsZero() && f.LastUpdated.IsZero():
+		f.Created, f.LastUpdated = now, now
+	case f.Created.IsZero():
+		f.Created = f.LastUpdated
+	case f.LastUpdated.IsZero():
+		f.LastUpdated = f.Created
+	}
+}
+
+func (f FileNote) Check() error {
+	if f.Space == "" {
+		return fmt.Errorf("space cannot be empty")
+	}
+	if err := CheckSpace(f.Space); err != nil {
+		return err
+	}
+	for _, tag := range f.Tags {
+		if err := CheckTag(tag); err != nil {
+			return err
+		}
+	}
+	for _, a := range f.Attachments {
+		if err := CheckAttachmentName(a.Filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
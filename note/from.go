@@ -0,0 +1,184 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// ImportFunc reads the notes of another program from a file or directory. Notes that are not
+// organized into anything resembling a space are put into defaultSpace.
+type ImportFunc func(path string, defaultSpace string) ([]FileNote, error)
+
+type importer struct {
+	description string
+	fn          ImportFunc
+}
+
+var importers = map[string]importer{}
+
+// RegisterImporter makes an importer available to ImportFrom, it panics if the name is taken
+func RegisterImporter(name, description string, fn ImportFunc) {
+	if _, ok := importers[name]; ok {
+		panic(fmt.Sprintf("importer already registered: %v", name))
+	}
+	importers[name] = importer{description: description, fn: fn}
+}
+
+// Importers are the names of the registered importers, sorted
+func Importers() []string {
+	names := maps.Keys(importers)
+	slices.Sort(names)
+	return names
+}
+
+// ImporterDescription describes what the named importer reads
+func ImporterDescription(name string) string {
+	return importers[name].description
+}
+
+// ImportFrom reads notes with a registered importer. The notes can be imported with Import.
+func ImportFrom(name, path, defaultSpace string) ([]FileNote, error) {
+	imp, ok := importers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown importer: %v (choose one of: %v)", name, strings.Join(Importers(), ", "))
+	}
+
+	notes, err := imp.fn(path, defaultSpace)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+
+	// Timestamps may come from different sources, such as metadata and the file system
+	for i := range notes {
+		if notes[i].LastUpdated.Before(notes[i].Created) {
+			notes[i].Created = notes[i].LastUpdated
+		}
+	}
+	return notes, nil
+}
+
+// walkFiles calls fn for each regular file below dir, hidden files and directories are skipped
+func walkFiles(dir string, fn func(name string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(name, info)
+	})
+}
+
+// relativeSpace is the space of a file in a directory structure: the directories
+// from root to the file, or defaultSpace for files directly in root
+func relativeSpace(root, name, defaultSpace string) (string, error) {
+	rel, err := filepath.Rel(root, filepath.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return defaultSpace, nil
+	}
+
+	levels := make([]string, 0)
+	for _, dir := range strings.Split(filepath.ToSlash(rel), "/") {
+		if level := sanitizeSpaceLevel(dir); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	if len(levels) == 0 {
+		return defaultSpace, nil
+	}
+	return strings.Join(levels, SpaceSeparator), nil
+}
+
+// readNoteFile reads a text file, the timestamps are taken from the file
+func readNoteFile(name string, info fs.FileInfo) (FileNote, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return FileNote{}, err
+	}
+	return FileNote{
+		Content:     strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"),
+		Created:     info.ModTime(),
+		LastUpdated: info.ModTime(),
+	}, nil
+}
+
+// parseTime accepts the layouts used by the supported programs
+func parseTime(value string) (time.Time, error) {
+	layouts := []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %v", value)
+}
+
+// sanitizeSpaceLevel makes a folder name of other programs a valid level of a nested space,
+// which is empty if nothing is left of it
+func sanitizeSpaceLevel(name string) string {
+	level := strings.ReplaceAll(name, SpaceSeparator, "-")
+	return strings.Join(strings.Fields(strings.ReplaceAll(level, ",", " ")), " ")
+}
+
+// sanitizeTags makes tags of other programs valid, or drops them
+func sanitizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ReplaceAll(tag, ",", " ")), " ")
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// sortFileNotes orders notes by creation, for importers that read them in no particular order
+func sortFileNotes(notes []FileNote) {
+	slices.SortStableFunc(notes, func(a, b FileNote) int {
+		return a.Created.Compare(b.Created)
+	})
+}
@@ -0,0 +1,192 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The types of items in a Joplin export
+const (
+	joplinNote    = "1"
+	joplinFolder  = "2"
+	joplinTag     = "5"
+	joplinNoteTag = "6"
+)
+
+var joplinProperty = regexp.MustCompile(`^([a-z_]+): ?(.*)$`)
+
+// An item of a Joplin RAW export: a note, folder, tag or a link between a note and a tag
+type joplinItem struct {
+	Title      string
+	Body       string
+	Properties map[string]string
+}
+
+func init() {
+	RegisterImporter("joplin", "a Joplin RAW export directory, notebooks are mapped to spaces", importJoplin)
+}
+
+// importJoplin reads a Joplin RAW export, where every item is a file of the form:
+//
+//	Title
+//
+//	Body
+//
+//	id: 0123456789abcdef0123456789abcdef
+//	parent_id: ...
+//	type_: 1
+//
+// Notes are put into a space named by their notebook, nested notebooks are nested spaces.
+// The content of a note is its title, as a heading, followed by the body.
+func importJoplin(path string, defaultSpace string) ([]FileNote, error) {
+	items := make(map[string]joplinItem)
+	err := walkFiles(path, func(name string, info fs.FileInfo) error {
+		if filepath.Dir(name) != filepath.Clean(path) || filepath.Ext(name) != MarkdownExt {
+			return nil // Resources are in a subdirectory
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		item := parseJoplinItem(string(data))
+		if item.Properties["encryption_applied"] == "1" {
+			return fmt.Errorf("%v: encrypted items are not supported, decrypt them in Joplin first", name)
+		}
+		items[item.Properties["id"]] = item
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string][]string)
+	for _, item := range items {
+		if item.Properties["type_"] == joplinNoteTag {
+			noteID := item.Properties["note_id"]
+			if tag, ok := items[item.Properties["tag_id"]]; ok {
+				tags[noteID] = append(tags[noteID], tag.Title)
+			}
+		}
+	}
+
+	notes := make([]FileNote, 0)
+	for id, item := range items {
+		if item.Properties["type_"] != joplinNote || joplinDeleted(item) {
+			continue
+		}
+
+		note := FileNote{
+			Space:   joplinSpace(items, item.Properties["parent_id"], defaultSpace),
+			Content: joplinContent(item),
+			Tags:    sanitizeTags(tags[id]),
+		}
+		if note.Created, err = joplinTime(item, "user_created_time", "created_time"); err != nil {
+			return nil, err
+		}
+		if note.LastUpdated, err = joplinTime(item, "user_updated_time", "updated_time"); err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+
+	sortFileNotes(notes)
+	return notes, nil
+}
+
+func parseJoplinItem(text string) joplinItem {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+
+	// The properties are the lines at the end, after the last empty line
+	item := joplinItem{Properties: make(map[string]string)}
+	end := len(lines)
+	for ; end > 0; end-- {
+		match := joplinProperty.FindStringSubmatch(lines[end-1])
+		if match == nil {
+			break
+		}
+		item.Properties[match[1]] = match[2]
+	}
+
+	text = strings.TrimRight(strings.Join(lines[:end], "\n"), "\n")
+	title, body, _ := strings.Cut(text, "\n")
+	item.Title = strings.TrimSpace(title)
+	item.Body = strings.TrimPrefix(body, "\n")
+	return item
+}
+
+// joplinSpace is the path of a notebook, with the notebooks above it
+func joplinSpace(items map[string]joplinItem, id, defaultSpace string) string {
+	levels := make([]string, 0)
+	for id != "" && len(levels) < len(items) {
+		folder, ok := items[id]
+		if !ok || folder.Properties["type_"] != joplinFolder {
+			break
+		}
+
+		if level := sanitizeSpaceLevel(folder.Title); level != "" {
+			levels = append([]string{level}, levels...)
+		}
+		id = folder.Properties["parent_id"]
+	}
+
+	if len(levels) == 0 {
+		return defaultSpace
+	}
+	return strings.Join(levels, SpaceSeparator)
+}
+
+func joplinContent(item joplinItem) string {
+	if item.Title == "" {
+		return item.Body
+	} else if item.Body == "" {
+		return "# " + item.Title
+	}
+	return "# " + item.Title + "\n\n" + item.Body
+}
+
+func joplinDeleted(item joplinItem) bool {
+	deleted := item.Properties["deleted_time"]
+	return deleted != "" && deleted != "0"
+}
+
+// joplinTime is the first of the properties that is set
+func joplinTime(item joplinItem, keys ...string) (time.Time, error) {
+	for _, key := range keys {
+		if value := item.Properties[key]; value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("note %v: %v: %w", item.Properties["id"], key, err)
+			}
+			return t, nil
+		}
+	}
+	return time.Now(), nil
+}
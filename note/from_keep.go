@@ -0,0 +1,133 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A note in Google Keep, as exported by Google Takeout
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	IsPinned    bool   `json:"isPinned"`
+	IsArchived  bool   `json:"isArchived"`
+	IsTrashed   bool   `json:"isTrashed"`
+	Created     int64  `json:"createdTimestampUsec"`
+	Updated     int64  `json:"userEditedTimestampUsec"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+func init() {
+	RegisterImporter("keep", "a Google Takeout directory with Google Keep notes", importKeep)
+}
+
+// importKeep reads the JSON files of Google Keep, from a Takeout directory. All notes are
+// put into defaultSpace, labels are tags and archived notes are tagged "archived".
+// Notes in the trash are not imported. Checklists are written as markdown task lists.
+func importKeep(path string, defaultSpace string) ([]FileNote, error) {
+	notes := make([]FileNote, 0)
+	err := walkFiles(path, func(name string, info fs.FileInfo) error {
+		if strings.ToLower(filepath.Ext(name)) != ".json" {
+			return nil
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var keep keepNote
+		if err = json.Unmarshal(data, &keep); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		if keep.IsTrashed {
+			return nil
+		}
+
+		note := FileNote{
+			Pinned:      keep.IsPinned,
+			Space:       defaultSpace,
+			Content:     keepContent(keep),
+			Created:     time.UnixMicro(keep.Created),
+			LastUpdated: time.UnixMicro(keep.Updated),
+		}
+		if keep.Created == 0 {
+			note.Created = info.ModTime()
+		}
+		if keep.Updated == 0 {
+			note.LastUpdated = note.Created
+		}
+
+		tags := make([]string, 0, len(keep.Labels)+1)
+		for _, label := range keep.Labels {
+			tags = append(tags, label.Name)
+		}
+		if keep.IsArchived {
+			tags = append(tags, "archived")
+		}
+		note.Tags = sanitizeTags(tags)
+
+		notes = append(notes, note)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortFileNotes(notes)
+	return notes, nil
+}
+
+func keepContent(keep keepNote) string {
+	parts := make([]string, 0, 3)
+	if keep.Title != "" {
+		parts = append(parts, "# "+keep.Title)
+	}
+	if keep.TextContent != "" {
+		parts = append(parts, keep.TextContent)
+	}
+	if len(keep.ListContent) > 0 {
+		items := make([]string, len(keep.ListContent))
+		for i, item := range keep.ListContent {
+			check := " "
+			if item.IsChecked {
+				check = "x"
+			}
+			items[i] = fmt.Sprintf("- [%v] %v", check, item.Text)
+		}
+		parts = append(parts, strings.Join(items, "\n"))
+	}
+	return strings.Join(parts, "\n\n")
+}
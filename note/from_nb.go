@@ -0,0 +1,106 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An nb notebook is a directory with an index of its files
+const nbIndex = ".index"
+
+var nbExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+	".org":      true,
+	".rst":      true,
+	".adoc":     true,
+}
+
+func init() {
+	RegisterImporter("nb", "an nb notebook, or the nb directory with all notebooks", importNb)
+}
+
+// importNb reads the text files of nb notebooks. Each notebook is a space named like the
+// notebook, and folders in the notebook are nested spaces. The timestamps are those of the files.
+func importNb(path string, defaultSpace string) ([]FileNote, error) {
+	if isNbNotebook(path) {
+		return importNbNotebook(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]FileNote, 0)
+	for _, entry := range entries {
+		dir := filepath.Join(path, entry.Name())
+		if !entry.IsDir() || !isNbNotebook(dir) {
+			continue
+		}
+
+		notebook, err := importNbNotebook(dir)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, notebook...)
+	}
+	return notes, nil
+}
+
+func importNbNotebook(dir string) ([]FileNote, error) {
+	dir = filepath.Clean(dir)
+	space := filepath.Base(dir)
+
+	notes := make([]FileNote, 0)
+	err := walkFiles(dir, func(name string, info fs.FileInfo) error {
+		if !nbExtensions[strings.ToLower(filepath.Ext(name))] {
+			return nil
+		}
+
+		note, err := readNoteFile(name, info)
+		if err != nil {
+			return err
+		}
+		if note.Space, err = relativeSpace(dir, name, space); err != nil {
+			return err
+		}
+		if note.Space != space {
+			note.Space = space + SpaceSeparator + note.Space
+		}
+
+		notes = append(notes, note)
+		return nil
+	})
+	return notes, err
+}
+
+func isNbNotebook(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, nbIndex))
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	RegisterImporter("notes-cli", "the home directory of notes-cli", importNotesCli)
+}
+
+// importNotesCli reads the notes of notes-cli, which are markdown files in a directory per
+// category. The category and tags are read from the header of the note:
+//
+//	Title
+//	=====
+//	- Category: work
+//	- Tags: todo, meeting
+//	- Created: 2018-10-30T11:22:33+09:00
+//
+// The header lines with metadata are not kept in the content.
+func importNotesCli(path string, defaultSpace string) ([]FileNote, error) {
+	notes := make([]FileNote, 0)
+	err := walkFiles(path, func(name string, info fs.FileInfo) error {
+		if strings.ToLower(filepath.Ext(name)) != MarkdownExt {
+			return nil
+		}
+
+		note, err := readNoteFile(name, info)
+		if err != nil {
+			return err
+		}
+		if note.Space, err = relativeSpace(path, name, defaultSpace); err != nil {
+			return err
+		}
+		if err = parseNotesCliHeader(&note); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+
+		notes = append(notes, note)
+		return nil
+	})
+	return notes, err
+}
+
+func parseNotesCliHeader(note *FileNote) error {
+	lines := strings.Split(note.Content, "\n")
+	if len(lines) < 2 || strings.Trim(lines[1], "=") != "" {
+		return nil // Not written by notes-cli
+	}
+
+	end := 2
+	for ; end < len(lines); end++ {
+		key, value, ok := strings.Cut(strings.TrimPrefix(lines[end], "- "), ":")
+		if !strings.HasPrefix(lines[end], "- ") || !ok {
+			break
+		}
+
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Category":
+			if value != "" {
+				note.Space = value
+			}
+		case "Tags":
+			note.Tags = sanitizeTags(strings.Split(value, ","))
+		case "Created":
+			created, err := parseTime(value)
+			if err != nil {
+				return err
+			}
+			note.Created = created
+		default:
+			return nil // Not metadata, leave the content as it is
+		}
+	}
+
+	body := strings.TrimLeft(strings.Join(lines[end:], "\n"), "\n")
+	note.Content = strings.Join(lines[:2], "\n") + "\n\n" + body
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	RegisterImporter("obsidian", "an Obsidian vault, folders are mapped to spaces", importObsidian)
+}
+
+// importObsidian reads the markdown files of an Obsidian vault. The folders of the vault are
+// spaces and files at the top are put into defaultSpace. Tags and timestamps are read from
+// the properties (front matter) of a note, if they exist, the content is kept as it is.
+func importObsidian(path string, defaultSpace string) ([]FileNote, error) {
+	notes := make([]FileNote, 0)
+	err := walkFiles(path, func(name string, info fs.FileInfo) error {
+		if strings.ToLower(filepath.Ext(name)) != MarkdownExt {
+			return nil
+		}
+
+		note, err := readNoteFile(name, info)
+		if err != nil {
+			return err
+		}
+		if note.Space, err = relativeSpace(path, name, defaultSpace); err != nil {
+			return err
+		}
+		if err = parseObsidianProperties(&note); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+
+		notes = append(notes, note)
+		return nil
+	})
+	return notes, err
+}
+
+func parseObsidianProperties(note *FileNote) error {
+	if !strings.HasPrefix(note.Content, frontMatterDelim+"\n") {
+		return nil
+	}
+	rest := note.Content[len(frontMatterDelim)+1:]
+	end := frontMatterEnd(rest)
+	if end < 0 {
+		return nil
+	}
+
+	var properties map[string]any
+	if err := yaml.Unmarshal([]byte(rest[:end]), &properties); err != nil {
+		return fmt.Errorf("properties: %w", err)
+	}
+
+	var tags []string
+	switch value := properties["tags"].(type) {
+	case string:
+		tags = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	case []any:
+		for _, tag := range value {
+			tags = append(tags, fmt.Sprint(tag))
+		}
+	}
+	for i, tag := range tags {
+		tags[i] = strings.TrimPrefix(tag, "#")
+	}
+	note.Tags = sanitizeTags(tags)
+
+	times := []struct {
+		keys  []string
+		value *time.Time
+	}{
+		{[]string{"created", "date"}, &note.Created},
+		{[]string{"updated", "modified"}, &note.LastUpdated},
+	}
+	for _, t := range times {
+		for _, key := range t.keys {
+			if value, ok := propertyTime(properties[key]); ok {
+				*t.value = value
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func propertyTime(value any) (time.Time, bool) {
+	switch value := value.(type) {
+	case time.Time:
+		return value, true
+	case string:
+		t, err := parseTime(value)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,358 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+const (
+	HTMLIndex  = "index.html"
+	HTMLSearch = "search.js"
+
+	htmlTimeFormat = "2006-01-02 15:04"
+	htmlTitleLen   = 80
+)
+
+var (
+	//go:embed html/*.tmpl
+	htmlTemplates embed.FS
+
+	indexTemplate = htmlTemplate("index.tmpl")
+	spaceTemplate = htmlTemplate("space.tmpl")
+	noteTemplate  = htmlTemplate("note.tmpl")
+
+	// Line breaks are kept, since most notes are not written as markdown.
+	// Raw HTML in notes is not rendered.
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(html.WithHardWraps()),
+	)
+)
+
+// HTMLOpts controls the static site written by ExportHTML
+type HTMLOpts struct {
+	Title string // name of the site, shown on every page
+}
+
+// The data of a page
+type htmlPage struct {
+	Site        string
+	Heading     string
+	Root        string // relative URL of the export directory, from the page
+	Breadcrumbs []htmlLink
+
+	Spaces []*htmlSpace // index page
+	Space  *htmlSpace   // space page
+	Note   *htmlNote    // note page
+}
+
+type htmlLink struct {
+	Name string
+	URL  string
+}
+
+type htmlSpace struct {
+	Name      string
+	URL       string // relative to the parent directory
+	Count     int    // notes in the space and its subspaces
+	Subspaces []*htmlSpace
+	Notes     []*htmlNote
+}
+
+type htmlNote struct {
+	ID          int
+	Pinned      bool
+	Space       string
+	Tags        []string
+	Title       string
+	URL         string // relative to the space directory
+	Created     string
+	LastUpdated string
+	HTML        template.HTML
+	Attachments []htmlLink // relative to the space directory
+}
+
+// An entry of the search index
+type htmlSearchEntry struct {
+	ID      int      `json:"id"`
+	Space   string   `json:"space"`
+	Tags    []string `json:"tags"`
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	URL     string   `json:"url"`
+}
+
+type htmlFile struct {
+	path   string
+	render func(w io.Writer) error
+}
+
+// ExportHTML writes a static site into dir: an index of all spaces, a page per space
+// (dir/<space>/index.html) with its notes in the given order, and a page per note
+// (dir/<space>/<id>.html) with the content rendered as markdown, linking to the
+// attachments in dir/<space>/<id>.attachments. Pages are searched
+// with the index in dir/search.js, no other files are needed.
+// Unless overwrite is set, no files are written if any of them already exist.
+func ExportHTML(dir string, notes []FileNote, opts HTMLOpts, overwrite bool) ([]string, error) {
+	site := opts.Title
+	if site == "" {
+		site = "Notes"
+	}
+
+	spaces := make(map[string]*htmlSpace)
+	space := func(name string) *htmlSpace {
+		if s, ok := spaces[name]; ok {
+			return s
+		}
+		s := &htmlSpace{Name: name, URL: url.PathEscape(path.Base(name)) + "/" + HTMLIndex}
+		spaces[name] = s
+		return s
+	}
+
+	index := make([]htmlSearchEntry, 0, len(notes))
+	attachments := make([]htmlFile, 0)
+	for _, note := range notes {
+		if _, err := spaceDir(note.Space); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := markdown.Convert([]byte(note.Content), &buf); err != nil {
+			return nil, fmt.Errorf("note %v: %w", note.ID, err)
+		}
+
+		n := &htmlNote{
+			ID:          note.ID,
+			Pinned:      note.Pinned,
+			Space:       note.Space,
+			Tags:        note.Tags,
+			Title:       htmlTitle(note),
+			URL:         strconv.Itoa(note.ID) + ".html",
+			Created:     note.Created.Local().Format(htmlTimeFormat),
+			LastUpdated: note.LastUpdated.Local().Format(htmlTimeFormat),
+			HTML:        template.HTML(buf.String()),
+		}
+		space(note.Space).Notes = append(space(note.Space).Notes, n)
+
+		for _, a := range note.Attachments {
+			if err := CheckAttachmentName(a.Filename); err != nil {
+				return nil, fmt.Errorf("note %v: %w", note.ID, err)
+			}
+			data, err := base64.StdEncoding.DecodeString(a.Data)
+			if err != nil {
+				return nil, fmt.Errorf("note %v: attachment %v: %w", note.ID, a.Filename, err)
+			}
+
+			dir := strconv.Itoa(note.ID) + AttachmentsDirExt
+			n.Attachments = append(n.Attachments, htmlLink{
+				Name: a.Filename,
+				URL:  dir + "/" + url.PathEscape(a.Filename),
+			})
+			attachments = append(attachments, htmlFile{
+				path.Join(note.Space, dir, a.Filename),
+				func(w io.Writer) error {
+					_, err := w.Write(data)
+					return err
+				},
+			})
+		}
+
+		// Every space above the note is counted, and gets a page
+		for name := note.Space; name != ""; name = ParentSpace(name) {
+			space(name).Count++
+		}
+
+		index = append(index, htmlSearchEntry{
+			ID:      note.ID,
+			Space:   note.Space,
+			Tags:    append([]string{}, note.Tags...),
+			Title:   n.Title,
+			Content: note.Content,
+			URL:     spaceURL(note.Space) + n.URL,
+		})
+	}
+
+	names := make([]string, 0, len(spaces))
+	for name := range spaces {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	root := &htmlPage{Site: site}
+	for _, name := range names {
+		s := spaces[name]
+		if parent := ParentSpace(name); parent != "" {
+			spaces[parent].Subspaces = append(spaces[parent].Subspaces, s)
+		}
+		root.Spaces = append(root.Spaces, &htmlSpace{Name: name, URL: spaceURL(name) + HTMLIndex, Count: s.Count})
+	}
+
+	files := []htmlFile{
+		{HTMLIndex, func(w io.Writer) error { return indexTemplate.Execute(w, root) }},
+		{HTMLSearch, func(w io.Writer) error { return writeSearchIndex(w, index) }},
+	}
+	for _, name := range names {
+		s := spaces[name]
+		spacePage := &htmlPage{
+			Site:        site,
+			Heading:     name,
+			Root:        spaceRoot(name),
+			Breadcrumbs: spaceBreadcrumbs(name),
+			Space:       s,
+		}
+		files = append(files, htmlFile{
+			path.Join(name, HTMLIndex),
+			func(w io.Writer) error { return spaceTemplate.Execute(w, spacePage) },
+		})
+
+		for _, n := range s.Notes {
+			notePage := &htmlPage{
+				Site:        site,
+				Heading:     n.Title,
+				Root:        spaceRoot(name),
+				Breadcrumbs: spaceBreadcrumbs(name),
+				Note:        n,
+			}
+			files = append(files, htmlFile{
+				path.Join(name, n.URL),
+				func(w io.Writer) error { return noteTemplate.Execute(w, notePage) },
+			})
+		}
+	}
+
+	files = append(files, attachments...)
+
+	return writeHTMLFiles(dir, files, spaces, overwrite)
+}
+
+func writeHTMLFiles(dir string, files []htmlFile, spaces map[string]*htmlSpace, overwrite bool) ([]string, error) {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		// A space can be named like a file of the export, as in "index.html"
+		if _, ok := spaces[file.path]; ok {
+			return nil, fmt.Errorf("space cannot be used as a directory: %q", file.path)
+		}
+
+		paths[i] = filepath.Join(dir, filepath.FromSlash(file.path))
+		if _, err := os.Stat(paths[i]); err == nil && !overwrite {
+			return nil, fmt.Errorf("file already exists: %v", paths[i])
+		}
+	}
+
+	for i, file := range files {
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0o755); err != nil {
+			return paths[:i], err
+		}
+		if err := writeHTMLFile(paths[i], file.render); err != nil {
+			return paths[:i], err
+		}
+	}
+	return paths, nil
+}
+
+func writeHTMLFile(name string, render func(w io.Writer) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := render(file); err != nil {
+		file.Close()
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	return file.Close()
+}
+
+func writeSearchIndex(w io.Writer, index []htmlSearchEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "window.noteIndex = %s;\n", data)
+	return err
+}
+
+func htmlTemplate(name string) *template.Template {
+	return template.Must(template.New(name).ParseFS(htmlTemplates, "html/base.tmpl", "html/"+name)).Lookup("base")
+}
+
+// htmlTitle is the first line of the content, without markdown heading markers
+func htmlTitle(note FileNote) string {
+	for _, line := range strings.Split(note.Content, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "# \t"))
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > htmlTitleLen {
+			line = string([]rune(line)[:htmlTitleLen-3]) + "..."
+		}
+		return line
+	}
+	return fmt.Sprintf("Note %v", note.ID)
+}
+
+// spaceURL is the URL of a space directory, relative to the export directory
+func spaceURL(space string) string {
+	levels := strings.Split(space, SpaceSeparator)
+	for i, level := range levels {
+		levels[i] = url.PathEscape(level)
+	}
+	return strings.Join(levels, "/") + "/"
+}
+
+// spaceRoot is the URL of the export directory, relative to a space directory
+func spaceRoot(space string) string {
+	return strings.Repeat("../", strings.Count(space, SpaceSeparator)+1)
+}
+
+// spaceBreadcrumbs links to the space, and every space above it, from the space directory
+func spaceBreadcrumbs(space string) []htmlLink {
+	levels := strings.Split(space, SpaceSeparator)
+	links := make([]htmlLink, len(levels))
+	for i, level := range levels {
+		links[i] = htmlLink{
+			Name: level,
+			URL:  strings.Repeat("../", len(levels)-1-i) + HTMLIndex,
+		}
+	}
+	return links
+}
@@ -0,0 +1,398 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+)
+
+const (
+	// Every imported note is created with a new ID
+	ImportAppend ImportMode = iota
+	// Notes keep their ID, it is an error if the ID is taken
+	ImportPreserveIDs
+	// Notes are matched by ID, or by content, and the newer note is kept
+	ImportMerge
+)
+
+const (
+	ImportCreate ImportAction = iota
+	ImportUpdate
+	ImportSkip
+)
+
+var importModeNames = map[ImportMode]string{
+	ImportAppend:      "append",
+	ImportPreserveIDs: "preserve-ids",
+	ImportMerge:       "merge",
+}
+
+type ImportMode int
+type ImportAction int
+
+// ImportStep is what happens to one imported note
+type ImportStep struct {
+	Action ImportAction
+	Note   FileNote
+
+	// ID of the created or updated note, or of the note that caused a skip.
+	// Zero when a created note gets a new ID.
+	ID     int
+	Reason string
+}
+
+type ImportPlan []ImportStep
+
+func ParseImportMode(name string) (ImportMode, error) {
+	for mode, modeName := range importModeNames {
+		if name == modeName {
+			return mode, nil
+		}
+	}
+	return ImportAppend, fmt.Errorf("unknown import mode: %v", name)
+}
+
+func (m ImportMode) String() string {
+	return importModeNames[m]
+}
+
+func (a ImportAction) String() string {
+	switch a {
+	case ImportCreate:
+		return "create"
+	case ImportUpdate:
+		return "update"
+	}
+	return "skip"
+}
+
+// Count the steps of a specific action
+func (p ImportPlan) Count(action ImportAction) int {
+	count := 0
+	for _, step := range p {
+		if step.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Import plans and applies the import of notes in one transaction, see PlanImport.
+// If an error occurs, no notes are imported.
+func Import(ctx context.Context, s Ops, notes []FileNote, mode ImportMode) (ImportPlan, error) {
+	var applied ImportPlan
+	err := inTx(ctx, s, func(s Ops) error {
+		plan, err := PlanImport(ctx, s, notes, mode)
+		if err != nil {
+			return err
+		}
+		applied, err = ApplyImport(ctx, s, plan)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// ImportStream imports the notes as they are read, in one transaction, and calls report with
+// each applied step. Unlike Import, the notes are not held in memory all at once.
+// If an error occurs, no notes are imported.
+func ImportStream(ctx context.Context, s Ops, notes iter.Seq2[FileNote, error], mode ImportMode, report func(ImportStep)) error {
+	return inTx(ctx, s, func(s Ops) error {
+		planner, err := newImportPlanner(ctx, s, mode)
+		if err != nil {
+			return err
+		}
+
+		for note, err := range notes {
+			if err != nil {
+				return err
+			}
+			if err = note.Check(); err != nil {
+				return err
+			}
+
+			step, err := planner.plan(ctx, note)
+			if err != nil {
+				return err
+			}
+			if step, err = applyStep(ctx, s, step); err != nil {
+				return err
+			}
+			if report != nil {
+				report(step)
+			}
+		}
+		return nil
+	})
+}
+
+// PlanImport decides what happens to each note, without modifying the store
+func PlanImport(ctx context.Context, s Ops, notes []FileNote, mode ImportMode) (ImportPlan, error) {
+	for _, note := range notes {
+		if err := note.Check(); err != nil {
+			return nil, err
+		}
+	}
+
+	planner, err := newImportPlanner(ctx, s, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make(ImportPlan, 0, len(notes))
+	collisions := make([]string, 0)
+	for _, note := range notes {
+		step, err := planner.plan(ctx, note)
+		if mode == ImportPreserveIDs && errors.Is(err, ErrExists) {
+			collisions = append(collisions, fmt.Sprint(note.ID))
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		plan = append(plan, step)
+	}
+
+	if len(collisions) > 0 {
+		return nil, fmt.Errorf("ids %v: %w", strings.Join(collisions, ", "), ErrExists)
+	}
+	return plan, nil
+}
+
+// importPlanner plans one note at a time. The notes planned before are taken into account,
+// whether they have been applied to the store or not.
+type importPlanner struct {
+	s    Ops
+	mode ImportMode
+
+	// preserve-ids: the ids in the store, or planned to be created
+	taken map[int]bool
+
+	// merge: the last update of notes planned to be created or updated, and
+	// the id of the first note (in the store, or planned) with some content.
+	// Notes planned to be created without an id are only known by content.
+	updated map[int]time.Time
+	hashes  map[[sha256.Size]byte]int
+	created map[[sha256.Size]byte]bool
+}
+
+func newImportPlanner(ctx context.Context, s Ops, mode ImportMode) (*importPlanner, error) {
+	p := &importPlanner{s: s, mode: mode}
+	switch mode {
+	case ImportAppend:
+	case ImportPreserveIDs:
+		ids, err := s.GetIDs(ctx, nil, true)
+		if err != nil {
+			return nil, err
+		}
+
+		p.taken = make(map[int]bool, len(ids))
+		for _, id := range ids {
+			p.taken[id] = true
+		}
+	case ImportMerge:
+		p.updated = make(map[int]time.Time)
+		p.hashes = make(map[[sha256.Size]byte]int)
+		p.created = make(map[[sha256.Size]byte]bool)
+		for note, err := range s.IterateNotes(ctx, nil, true, nil, nil, DefaultBatchSize) {
+			if err != nil {
+				return nil, err
+			}
+			p.known(FromNote(note))
+		}
+	default:
+		return nil, fmt.Errorf("unknown import mode: %v", int(mode))
+	}
+	return p, nil
+}
+
+// plan decides what happens to a note. A note that keeps an id which is taken is an
+// ErrExists error, when preserving ids.
+func (p *importPlanner) plan(ctx context.Context, note FileNote) (ImportStep, error) {
+	switch p.mode {
+	case ImportPreserveIDs:
+		if note.ID != 0 && p.taken[note.ID] {
+			return ImportStep{}, fmt.Errorf("id %v: %w", note.ID, ErrExists)
+		}
+		p.taken[note.ID] = true
+		return ImportStep{Action: ImportCreate, Note: note, ID: note.ID}, nil
+	case ImportMerge:
+		return p.planMerge(ctx, note)
+	}
+	return ImportStep{Action: ImportCreate, Note: note}, nil
+}
+
+func (p *importPlanner) planMerge(ctx context.Context, note FileNote) (ImportStep, error) {
+	var (
+		matchID   = 0
+		matchedBy = "id"
+	)
+	if note.ID != 0 {
+		if _, err := p.lastUpdated(ctx, note.ID); err == nil {
+			matchID = note.ID
+		} else if !errors.Is(err, ErrNotFound) {
+			return ImportStep{}, err
+		}
+	}
+	if matchID == 0 {
+		matchID = p.hashes[contentHash(note)]
+		matchedBy = "content"
+	}
+
+	if matchID == 0 {
+		if note.ID != 0 {
+			p.known(note)
+		} else if hash := contentHash(note); p.created[hash] {
+			return ImportStep{
+				Action: ImportSkip,
+				Note:   note,
+				Reason: "matched a note to be created by content",
+			}, nil
+		} else {
+			p.created[hash] = true
+		}
+		return ImportStep{Action: ImportCreate, Note: note, ID: note.ID}, nil
+	}
+
+	lastUpdated, err := p.lastUpdated(ctx, matchID)
+	if err != nil {
+		return ImportStep{}, err
+	}
+	if !truncate(note.LastUpdated).After(truncate(lastUpdated)) {
+		return ImportStep{
+			Action: ImportSkip,
+			Note:   note,
+			ID:     matchID,
+			Reason: fmt.Sprintf("matched note %v by %v, which is not older", matchID, matchedBy),
+		}, nil
+	}
+
+	note.ID = matchID
+	p.known(note)
+	return ImportStep{
+		Action: ImportUpdate,
+		Note:   note,
+		ID:     matchID,
+		Reason: fmt.Sprintf("matched note %v by %v, which is older", matchID, matchedBy),
+	}, nil
+}
+
+// known records a note, in the store or planned, that later notes can be matched with
+func (p *importPlanner) known(note FileNote) {
+	p.updated[note.ID] = note.LastUpdated
+	if _, ok := p.hashes[contentHash(note)]; !ok {
+		p.hashes[contentHash(note)] = note.ID
+	}
+}
+
+func (p *importPlanner) lastUpdated(ctx context.Context, id int) (time.Time, error) {
+	if t, ok := p.updated[id]; ok {
+		return t, nil
+	}
+	note, err := p.s.GetNote(ctx, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return note.LastUpdated, nil
+}
+
+// ApplyImport carries out a plan in one transaction and returns the steps that were applied.
+// If an error occurs, no notes are imported.
+func ApplyImport(ctx context.Context, s Ops, plan ImportPlan) (ImportPlan, error) {
+	var applied ImportPlan
+	err := inTx(ctx, s, func(s Ops) error {
+		var err error
+		applied, err = applyImport(ctx, s, plan)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func applyImport(ctx context.Context, s Ops, plan ImportPlan) (ImportPlan, error) {
+	applied := make(ImportPlan, 0, len(plan))
+	for _, step := range plan {
+		step, err := applyStep(ctx, s, step)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, step)
+	}
+	return applied, nil
+}
+
+// applyStep applies one step, a created note gets its new ID
+func applyStep(ctx context.Context, s Ops, step ImportStep) (ImportStep, error) {
+	switch step.Action {
+	case ImportCreate:
+		if step.ID != 0 {
+			if err := s.InsertNote(ctx, step.Note.ToNote()); err != nil {
+				return step, fmt.Errorf("insert: %w", err)
+			}
+		} else {
+			id, err := s.AddNote(ctx, step.Note.ToNote(), true)
+			if err != nil {
+				return step, fmt.Errorf("add: %w", err)
+			}
+			step.ID = int(id)
+		}
+
+		if len(step.Note.Tags) > 0 {
+			if err := s.AddTags(ctx, []int{step.ID}, step.Note.Tags); err != nil {
+				return step, fmt.Errorf("tag note %v: %w", step.ID, err)
+			}
+		}
+		if err := addAttachments(ctx, s, step.ID, step.Note.Attachments); err != nil {
+			return step, fmt.Errorf("note %v: %w", step.ID, err)
+		}
+	case ImportUpdate:
+		if err := s.UpdateNote(ctx, step.Note.ToNote()); err != nil {
+			return step, fmt.Errorf("update: %w", err)
+		}
+		if err := s.SetTags(ctx, step.ID, step.Note.Tags); err != nil {
+			return step, fmt.Errorf("tag note %v: %w", step.ID, err)
+		}
+		// Attachments that are not in the imported note are kept
+		if err := addAttachments(ctx, s, step.ID, step.Note.Attachments); err != nil {
+			return step, fmt.Errorf("note %v: %w", step.ID, err)
+		}
+	}
+	return step, nil
+}
+
+func contentHash(note FileNote) [sha256.Size]byte {
+	return sha256.Sum256([]byte(note.Content))
+}
+
+// Timestamps are stored with a precision of seconds
+func truncate(t time.Time) time.Time {
+	return t.Truncate(time.Second)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"context"
+
+	"github.com/bdazl/note/db"
+)
+
+// ParseLinks returns the IDs of the notes linked from content, as [[123]] or note:123
+func ParseLinks(content string) []int {
+	return db.ParseLinks(content)
+}
+
+// DanglingLinks lists the links from other notes to the notes with ids,
+// which would be left dangling if the notes were removed
+func DanglingLinks(ctx context.Context, s Ops, ids []int) ([]Link, error) {
+	ids = unique(ids)
+	links, err := s.Backlinks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+	}
+
+	dangling := make([]Link, 0, len(links))
+	for _, link := range links {
+		if !removed[link.Source] {
+			dangling = append(dangling, link)
+		}
+	}
+	return dangling, nil
+}
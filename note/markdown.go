@@ -0,0 +1,290 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MarkdownExt = ".md"
+
+	frontMatterDelim = "---"
+)
+
+// Directories that belong to other programs, which are never imported
+var skipMarkdownDirs = map[string]bool{
+	".git":      true,
+	".obsidian": true,
+}
+
+// The YAML front matter of a markdown note
+type markdownHeader struct {
+	ID          int        `yaml:"id,omitempty"`
+	Space       string     `yaml:"space,omitempty"`
+	Pinned      bool       `yaml:"pinned"`
+	Created     time.Time  `yaml:"created,omitempty"`
+	LastUpdated time.Time  `yaml:"last_updated,omitempty"`
+	Tags        []string   `yaml:"tags,omitempty"`
+	Due         *time.Time `yaml:"due,omitempty"`
+	RemindAt    *time.Time `yaml:"remind_at,omitempty"`
+}
+
+// WriteMarkdown writes the note as YAML front matter, followed by the content.
+// A newline is always appended to the content, which ReadMarkdown removes.
+func WriteMarkdown(w io.Writer, note FileNote) error {
+	header := markdownHeader{
+		ID:          note.ID,
+		Space:       note.Space,
+		Pinned:      note.Pinned,
+		Created:     note.Created,
+		LastUpdated: note.LastUpdated,
+		Tags:        note.Tags,
+		Due:         note.Due,
+		RemindAt:    note.RemindAt,
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(frontMatterDelim + "\n")
+	encoder := yaml.NewEncoder(&buf)
+	if err := encoder.Encode(header); err != nil {
+		return fmt.Errorf("front matter: %w", err)
+	}
+	encoder.Close()
+	buf.WriteString(frontMatterDelim + "\n")
+	buf.WriteString(note.Content)
+	buf.WriteString("\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadMarkdown parses a note written by WriteMarkdown.
+// The front matter is optional, without it the whole file is content.
+func ReadMarkdown(r io.Reader) (FileNote, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return FileNote{}, err
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	var (
+		header  markdownHeader
+		content = text
+	)
+	if strings.HasPrefix(text, frontMatterDelim+"\n") {
+		rest := text[len(frontMatterDelim)+1:]
+		end := frontMatterEnd(rest)
+		if end < 0 {
+			return FileNote{}, fmt.Errorf("front matter is not terminated by '%v'", frontMatterDelim)
+		}
+
+		if err := yaml.Unmarshal([]byte(rest[:end]), &header); err != nil {
+			return FileNote{}, fmt.Errorf("front matter: %w", err)
+		}
+		content = strings.TrimPrefix(rest[end:], frontMatterDelim)
+		content = strings.TrimPrefix(content, "\n")
+	}
+
+	return FileNote{
+		ID:          header.ID,
+		Pinned:      header.Pinned,
+		Space:       header.Space,
+		Content:     strings.TrimSuffix(content, "\n"),
+		Created:     header.Created,
+		LastUpdated: header.LastUpdated,
+		Tags:        header.Tags,
+		Due:         header.Due,
+		RemindAt:    header.RemindAt,
+	}, nil
+}
+
+// frontMatterEnd finds the offset of the closing delimiter line, or -1
+func frontMatterEnd(text string) int {
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.TrimSuffix(line, "\n") == frontMatterDelim {
+			return offset
+		}
+		offset += len(line)
+	}
+	return -1
+}
+
+// MarkdownPath is the path of a note, relative to the export directory: space/id.md
+func MarkdownPath(note FileNote) (string, error) {
+	dir, err := spaceDir(note.Space)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(note.ID)+MarkdownExt), nil
+}
+
+// spaceDir is the directory of a space, relative to an export directory
+func spaceDir(space string) (string, error) {
+	if space == "" || path.Clean("/"+space) != "/"+space {
+		return "", fmt.Errorf("space cannot be used as a directory: %q", space)
+	}
+	return filepath.FromSlash(space), nil
+}
+
+// ExportMarkdown writes one file per note into dir, organized by space.
+// The attachments of a note are written next to it, in space/id.attachments.
+// Unless overwrite is set, no files are written if any of them already exist.
+func ExportMarkdown(dir string, notes []FileNote, overwrite bool) ([]string, error) {
+	paths := make([]string, len(notes))
+	for i, note := range notes {
+		rel, err := MarkdownPath(note)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = filepath.Join(dir, rel)
+
+		if _, err := os.Stat(paths[i]); err == nil && !overwrite {
+			return nil, fmt.Errorf("file already exists: %v", paths[i])
+		}
+		for _, a := range note.Attachments {
+			name := filepath.Join(attachmentsDir(paths[i]), a.Filename)
+			if _, err := os.Stat(name); err == nil && !overwrite {
+				return nil, fmt.Errorf("file already exists: %v", name)
+			}
+		}
+	}
+
+	for i, note := range notes {
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0o755); err != nil {
+			return paths[:i], err
+		}
+		if err := writeMarkdownFile(paths[i], note); err != nil {
+			return paths[:i], err
+		}
+		if _, err := WriteAttachments(attachmentsDir(paths[i]), note.Attachments, true, false); err != nil {
+			return paths[:i], err
+		}
+	}
+	return paths, nil
+}
+
+func writeMarkdownFile(name string, note FileNote) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteMarkdown(file, note); err != nil {
+		file.Close()
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	return file.Close()
+}
+
+// ImportMarkdown reads every markdown file in dir and its subdirectories, along with
+// the files in the attachments directory next to it.
+// Without front matter the space is the relative directory of the file, or
+// defaultSpace at the top level, and the timestamps are the modification time.
+func ImportMarkdown(dir string, defaultSpace string) ([]FileNote, error) {
+	notes := make([]FileNote, 0)
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if skipMarkdownDirs[entry.Name()] || isAttachmentsDir(name) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(name), MarkdownExt) {
+			return nil
+		}
+
+		note, err := readMarkdownFile(name)
+		if err != nil {
+			return err
+		}
+		if note.Attachments, err = readAttachments(attachmentsDir(name)); err != nil {
+			return err
+		}
+
+		if note.Space == "" {
+			rel, err := filepath.Rel(dir, filepath.Dir(name))
+			if err != nil {
+				return err
+			}
+			note.Space = filepath.ToSlash(rel)
+			if note.Space == "." {
+				note.Space = defaultSpace
+			}
+		}
+		if note.Created.IsZero() || note.LastUpdated.IsZero() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if note.LastUpdated.IsZero() {
+				note.LastUpdated = info.ModTime()
+			}
+			if note.Created.IsZero() {
+				note.Created = note.LastUpdated
+			}
+		}
+
+		notes = append(notes, note)
+		return nil
+	})
+	return notes, err
+}
+
+// isAttachmentsDir reports whether dir holds the attachments of a markdown file
+func isAttachmentsDir(dir string) bool {
+	if !strings.HasSuffix(dir, AttachmentsDirExt) {
+		return false
+	}
+	_, err := os.Stat(strings.TrimSuffix(dir, AttachmentsDirExt) + MarkdownExt)
+	return err == nil
+}
+
+func readMarkdownFile(name string) (FileNote, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return FileNote{}, err
+	}
+	defer file.Close()
+
+	note, err := ReadMarkdown(file)
+	if err != nil {
+		return FileNote{}, fmt.Errorf("%v: %w", name, err)
+	}
+	return note, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package note is the library behind the note command line program.
+// Notes are kept in a SQLite database, organized in spaces, and can be
+// tagged, pinned, searched, trashed and restored.
+//
+// Open a database with Open and use it through the Store interface, or
+// through the functions of this package, which validate their input the
+// same way the note commands do.
+package note
+
+import (
+	"time"
+
+	"github.com/bdazl/note/db"
+)
+
+type (
+	DB            = db.DB
+	Tx            = db.Tx
+	Note          = db.Note
+	Notes         = db.Notes
+	Column        = db.Column
+	SortOpts      = db.SortOpts
+	PageOpts      = db.PageOpts
+	FilterOpts    = db.FilterOpts
+	SearchOpts    = db.SearchOpts
+	SearchResult  = db.SearchResult
+	Revision      = db.Revision
+	Space         = db.Space
+	SpaceUpdate   = db.SpaceUpdate
+	SpaceKey      = db.SpaceKey
+	Link          = db.Link
+	Attachment    = db.Attachment
+	TrashedNote   = db.TrashedNote
+	Expr          = db.Expr
+	NotFoundError = db.NotFoundError
+	PartialError  = db.PartialError
+)
+
+const (
+	IDColumn          = db.IDColumn
+	SpaceColumn       = db.SpaceColumn
+	CreatedColumn     = db.CreatedColumn
+	LastUpdatedColumn = db.LastUpdatedColumn
+	ContentColumn     = db.ContentColumn
+	PinnedColumn      = db.PinnedColumn
+
+	TrashSpace     = db.TrashSpace
+	SpaceSeparator = db.SpaceSeparator
+
+	DefaultBatchSize = db.DefaultBatchSize
+)
+
+var (
+	// ErrNotFound matches errors about notes or revisions that do not exist
+	ErrNotFound = db.ErrNotFound
+
+	// ErrExists is returned when a note is inserted with an ID that is taken
+	ErrExists = db.ErrExists
+
+	// ErrNoSearchIndex is returned by SearchNotes, if the database lacks FTS5 support
+	ErrNoSearchIndex = db.ErrNoSearchIndex
+
+	// ErrLocked is returned when reading or writing a note in a locked, encrypted space
+	ErrLocked = db.ErrLocked
+
+	// ErrWrongPassphrase is returned when a key is derived from the wrong passphrase
+	ErrWrongPassphrase = db.ErrWrongPassphrase
+)
+
+// Open an existing database, upgrading its schema if needed
+func Open(path string) (*DB, error) {
+	return db.Open(path)
+}
+
+// ParseDate parses a due date or the time of a reminder, such as "next friday 10:00".
+// See db.ParseDate for the syntax.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	return db.ParseDate(s, now)
+}
+
+// ParseQuery parses a query expression, used as FilterOpts.Query. See db.ParseQuery for the syntax.
+func ParseQuery(query string, now time.Time) (Expr, error) {
+	return db.ParseQuery(query, now)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RenameSpace renames a space and the spaces nested below it,
+// including the trash origin of their removed notes
+func RenameSpace(ctx context.Context, s Ops, from, to string) error {
+	if err := checkSpaceChange(from, to); err != nil {
+		return err
+	}
+	return s.RenameSpace(ctx, from, to)
+}
+
+// MergeSpaces moves all notes from the spaces in from, and the spaces nested below them, to the space to
+func MergeSpaces(ctx context.Context, s Ops, from []string, to string) error {
+	for _, space := range from {
+		if err := checkSpaceChange(space, to); err != nil {
+			return err
+		}
+	}
+
+	// Nested spaces are merged along with their parent
+	spaces := []string{}
+	for _, space := range unique(from) {
+		nested := false
+		for _, parent := range from {
+			nested = nested || IsSubspace(space, parent)
+		}
+		if !nested {
+			spaces = append(spaces, space)
+		}
+	}
+	return s.MergeSpaces(ctx, spaces, to)
+}
+
+// IsSubspace reports whether space is nested below parent, at any depth
+func IsSubspace(space, parent string) bool {
+	return strings.HasPrefix(space, parent+SpaceSeparator)
+}
+
+// ParentSpace is the space directly above space, or empty if it is not nested
+func ParentSpace(space string) string {
+	i := strings.LastIndex(space, SpaceSeparator)
+	if i < 0 {
+		return ""
+	}
+	return space[:i]
+}
+
+// DescribeSpace changes the metadata of a space, which is created if it does not exist
+func DescribeSpace(ctx context.Context, s Ops, name string, update SpaceUpdate) error {
+	if name == "" {
+		return fmt.Errorf("space cannot be empty")
+	}
+	if err := CheckSpace(name); err != nil {
+		return err
+	}
+	if update.DefaultSort != nil && *update.DefaultSort != "" {
+		sortOpts := SortOpts{SortColumn: *update.DefaultSort}
+		if err := sortOpts.Check(); err != nil {
+			return err
+		}
+	}
+	return s.UpdateSpace(ctx, name, update)
+}
+
+// EncryptSpace encrypts the notes of a space, and the notes later added to it,
+// with a key derived from the passphrase. The space is created if it does not exist.
+func EncryptSpace(ctx context.Context, s Ops, name, passphrase string) error {
+	if name == "" {
+		return fmt.Errorf("space cannot be empty")
+	}
+	if err := CheckSpace(name); err != nil {
+		return err
+	}
+	return s.EncryptSpace(ctx, name, passphrase)
+}
+
+func checkSpaceChange(from, to string) error {
+	if from == TrashSpace || to == TrashSpace {
+		return fmt.Errorf("the %v space cannot be renamed or merged", TrashSpace)
+	}
+	if to == "" {
+		return fmt.Errorf("space cannot be empty")
+	}
+	if IsSubspace(to, from) {
+		return fmt.Errorf("space %v cannot be moved below itself", from)
+	}
+	return CheckSpace(to)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// Store is the storage of notes, implemented by *DB
+type Store interface {
+	Ops
+	WithTx(ctx context.Context, fn func(tx *Tx) error) error
+	Close() error
+}
+
+// Ops are the operations on notes, which are shared by *DB and a transaction, *Tx
+type Ops interface {
+	AddNote(ctx context.Context, note Note, full bool) (int64, error)
+	InsertNote(ctx context.Context, note Note) error
+	UpdateNote(ctx context.Context, note Note) error
+	GetNote(ctx context.Context, id int) (*Note, error)
+	GetNotes(ctx context.Context, ids []int) (Notes, error)
+	GetIDs(ctx context.Context, spaces []string, ascending bool) ([]int, error)
+	SelectNotes(ctx context.Context, spaces []string, all bool, sortOpts *SortOpts, pageOpts *PageOpts, filterOpts *FilterOpts) (Notes, error)
+	IterateNotes(ctx context.Context, spaces []string, all bool, sortOpts *SortOpts, filterOpts *FilterOpts, batchSize int) iter.Seq2[Note, error]
+	SelectSpaces(ctx context.Context, all bool, sortOpts *SortOpts) ([]string, error)
+	Spaces(ctx context.Context, all bool, ascending bool) ([]Space, error)
+	GetSpace(ctx context.Context, name string) (*Space, error)
+	UpdateSpace(ctx context.Context, name string, update SpaceUpdate) error
+	RenameSpace(ctx context.Context, from, to string) error
+	MergeSpaces(ctx context.Context, from []string, to string) error
+	EncryptSpace(ctx context.Context, space, passphrase string) error
+	DeriveSpaceKey(ctx context.Context, space, passphrase string) (*SpaceKey, error)
+	Unlock(ctx context.Context, key SpaceKey) error
+	Lock(ctx context.Context, space string) error
+	SearchNotes(ctx context.Context, query string, opts *SearchOpts) ([]SearchResult, error)
+
+	ReplaceContent(ctx context.Context, id int, content string) error
+	MoveNotes(ctx context.Context, ids []int, toSpace string) error
+	PinNotes(ctx context.Context, ids []int, pinned bool) error
+	SetDue(ctx context.Context, ids []int, due *time.Time) error
+	SetReminder(ctx context.Context, ids []int, at *time.Time) error
+
+	TrashNotes(ctx context.Context, ids []int) error
+	SelectTrash(ctx context.Context, before time.Time) ([]TrashedNote, error)
+	LockedTrash(ctx context.Context, before time.Time) (int, error)
+	RestoreNotes(ctx context.Context, ids []int, fallback string) error
+	PermanentRemoveNotes(ctx context.Context, ids []int) error
+
+	AddTags(ctx context.Context, ids []int, tags []string) error
+	RemoveTags(ctx context.Context, ids []int, tags []string) error
+	SetTags(ctx context.Context, id int, tags []string) error
+	ListTags(ctx context.Context, ids []int, ascending bool) ([]string, error)
+
+	OutgoingLinks(ctx context.Context, id int) ([]int, error)
+	Backlinks(ctx context.Context, ids []int) ([]Link, error)
+
+	AddAttachment(ctx context.Context, a Attachment, replace bool) (int64, error)
+	Attachments(ctx context.Context, noteID int, data bool) ([]Attachment, error)
+	RemoveAttachments(ctx context.Context, noteID int, filenames []string) error
+
+	Revisions(ctx context.Context, id int) ([]Revision, error)
+	GetRevision(ctx context.Context, id, revision int) (*Revision, error)
+	PruneRevisions(ctx context.Context, id int, keep int) error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Ops   = (*Tx)(nil)
+)
+
+// inTx runs fn in a transaction if s is a *DB, which is rolled back if fn fails.
+// Otherwise, for example if s already is a *Tx, fn runs directly on s.
+func inTx(ctx context.Context, s Ops, fn func(s Ops) error) error {
+	if d, ok := s.(*DB); ok {
+		return d.WithTx(ctx, func(tx *Tx) error {
+			return fn(tx)
+		})
+	}
+	return fn(s)
+}
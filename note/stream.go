@@ -0,0 +1,233 @@
+/*
+Copyright © 2024 Jacob Peyron <jacob@peyron.io>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package note
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Encoder writes notes one at a time. Close must be called to end the stream,
+// it does not close the underlying writer.
+type Encoder interface {
+	Encode(note FileNote) error
+	Close() error
+}
+
+// NewJSONEncoder writes a JSON array, with the same indentation rules as json.Encoder
+func NewJSONEncoder(w io.Writer, prefix, indent string) Encoder {
+	return &jsonArrayEncoder{w: w, prefix: prefix, indent: indent}
+}
+
+// NewJSONLinesEncoder writes one JSON object per line (also known as NDJSON)
+func NewJSONLinesEncoder(w io.Writer) Encoder {
+	return &jsonLinesEncoder{json.NewEncoder(w)}
+}
+
+// NewYAMLEncoder writes one YAML document per note
+func NewYAMLEncoder(w io.Writer, spaces int) Encoder {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(spaces)
+	return &yamlEncoder{encoder}
+}
+
+type jsonArrayEncoder struct {
+	w      io.Writer
+	prefix string
+	indent string
+	count  int
+}
+
+func (e *jsonArrayEncoder) Encode(note FileNote) error {
+	data, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+
+	indented := e.prefix != "" || e.indent != ""
+	if indented {
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, data, e.prefix+e.indent, e.indent); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	separator := ","
+	if e.count == 0 {
+		separator = "["
+	}
+	if indented {
+		separator += "\n" + e.prefix + e.indent
+	}
+	e.count++
+
+	if _, err = io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonArrayEncoder) Close() error {
+	end := "]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	} else if e.prefix != "" || e.indent != "" {
+		end = "\n" + e.prefix + end
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+type jsonLinesEncoder struct {
+	*json.Encoder
+}
+
+func (e *jsonLinesEncoder) Encode(note FileNote) error {
+	return e.Encoder.Encode(note)
+}
+
+func (e *jsonLinesEncoder) Close() error {
+	return nil
+}
+
+type yamlEncoder struct {
+	*yaml.Encoder
+}
+
+func (e *yamlEncoder) Encode(note FileNote) error {
+	return e.Encoder.Encode(note)
+}
+
+// DecodeJSON reads notes from JSON arrays, or from a stream of JSON objects such as JSON lines.
+// Only one note at a time is held in memory.
+func DecodeJSON(r io.Reader) iter.Seq2[FileNote, error] {
+	return func(yield func(FileNote, error) bool) {
+		reader := bufio.NewReader(r)
+		first, err := firstByte(reader)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			yield(FileNote{}, err)
+			return
+		}
+
+		decoder := json.NewDecoder(reader)
+		if first != '[' {
+			for {
+				var note FileNote
+				if err := decoder.Decode(&note); err == io.EOF {
+					return
+				} else if !yield(note, err) || err != nil {
+					return
+				}
+			}
+		}
+
+		for {
+			// Each top level value is an array of notes
+			if token, err := decoder.Token(); err == io.EOF {
+				return
+			} else if err != nil {
+				yield(FileNote{}, err)
+				return
+			} else if token != json.Delim('[') {
+				yield(FileNote{}, fmt.Errorf("offset %v: expected a list of notes", decoder.InputOffset()))
+				return
+			}
+
+			for decoder.More() {
+				var note FileNote
+				err := decoder.Decode(&note)
+				if !yield(note, err) || err != nil {
+					return
+				}
+			}
+
+			if _, err := decoder.Token(); err != nil {
+				yield(FileNote{}, err)
+				return
+			}
+		}
+	}
+}
+
+// DecodeYAML reads notes from a stream of YAML documents. A document is either one note,
+// or a list of notes.
+func DecodeYAML(r io.Reader) iter.Seq2[FileNote, error] {
+	return func(yield func(FileNote, error) bool) {
+		decoder := yaml.NewDecoder(r)
+		for {
+			var doc yaml.Node
+			if err := decoder.Decode(&doc); err == io.EOF {
+				return
+			} else if err != nil {
+				yield(FileNote{}, err)
+				return
+			}
+			if len(doc.Content) == 0 {
+				continue
+			}
+
+			nodes := []*yaml.Node{doc.Content[0]}
+			switch doc.Content[0].Kind {
+			case yaml.SequenceNode:
+				nodes = doc.Content[0].Content
+			case yaml.MappingNode:
+			default:
+				yield(FileNote{}, fmt.Errorf("line %v: expected a note or a list of notes", doc.Content[0].Line))
+				return
+			}
+
+			for _, node := range nodes {
+				var note FileNote
+				err := node.Decode(&note)
+				if !yield(note, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// firstByte peeks at the first byte that is not white space
+func firstByte(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, reader.UnreadByte()
+	}
+}